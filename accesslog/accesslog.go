@@ -0,0 +1,289 @@
+//Package accesslog 每个请求一条结构化的访问日志，支持json和logfmt，写入单独的文件
+//http、grpc和HandlerFunc注册的路由都会记录，见hfw的metrics.go
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	logger "github.com/hsyan2008/hfw/logging"
+)
+
+//Fields 支持的字段，也是默认的输出顺序
+var Fields = []string{
+	"time", "trace_id", "type", "client_ip", "method", "route", "path",
+	"status", "err_no", "req_bytes", "resp_bytes", "latency_ms", "user_agent", "upstream_calls",
+}
+
+//Record 一个请求的访问日志
+type Record struct {
+	Time    time.Time
+	TraceID string
+	//http或者grpc
+	Type     string
+	ClientIP string
+	//http的method，grpc是GRPC或者Stream
+	Method string
+	//路由的模板
+	Route string
+	//原始的path
+	Path string
+	//http的状态码或者grpc的code
+	Status string
+	ErrNo  int64
+	//小于0表示未知
+	RequestBytes  int64
+	ResponseBytes int64
+	Latency       time.Duration
+	UserAgent     string
+	//请求过程中调用下游的次数，包括curl和grpc
+	UpstreamCalls int64
+	//是否成功，成功的请求按SuccessSampleRate采样
+	Success bool
+}
+
+type accessLogger struct {
+	w        io.Writer
+	isLogfmt bool
+	fields   []string
+	rate     float64
+
+	lock sync.Mutex
+	r    *rand.Rand
+}
+
+var (
+	lock      = new(sync.RWMutex)
+	curLogger *accessLogger
+)
+
+//Init 根据配置开启
+func Init(conf configs.AccessLogConfig) error {
+	if !conf.IsEnable {
+		return nil
+	}
+	file := LogFile(conf.LogFile, ".access.log")
+	w, err := newRollingWriter(file, conf.LogType, conf.LogMaxNum, conf.LogSize, conf.LogUnit)
+	if err != nil {
+		return err
+	}
+	if err = SetWriter(w, conf); err != nil {
+		w.Close()
+		return err
+	}
+	logger.Infof("access log is enabled, file: %s", file)
+
+	return nil
+}
+
+//SetWriter 写入自定义的Writer，conf里只使用Format、Fields和SuccessSampleRate
+func SetWriter(w io.Writer, conf configs.AccessLogConfig) error {
+	l := &accessLogger{
+		w:      w,
+		fields: conf.Fields,
+		rate:   conf.SuccessSampleRate,
+		r:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	switch strings.ToLower(conf.Format) {
+	case "", "json":
+	case "logfmt":
+		l.isLogfmt = true
+	default:
+		return fmt.Errorf("unsupport access log format: %s", conf.Format)
+	}
+	if len(l.fields) == 0 {
+		l.fields = Fields
+	}
+	for _, f := range l.fields {
+		if !isField(f) {
+			return fmt.Errorf("unsupport access log field: %s", f)
+		}
+	}
+	if l.rate <= 0 || l.rate > 1 {
+		l.rate = 1
+	}
+
+	lock.Lock()
+	old := curLogger
+	curLogger = l
+	lock.Unlock()
+
+	//只关闭Init打开的文件
+	if old != nil {
+		if rw, ok := old.w.(*rollingWriter); ok {
+			rw.Close()
+		}
+	}
+
+	return nil
+}
+
+func isField(f string) bool {
+	for _, v := range Fields {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+func getLogger() *accessLogger {
+	lock.RLock()
+	defer lock.RUnlock()
+	return curLogger
+}
+
+func IsEnable() bool {
+	return getLogger() != nil
+}
+
+//Log 未开启时不处理
+func Log(r *Record) {
+	l := getLogger()
+	if l == nil || !l.sample(r) {
+		return
+	}
+	if _, err := l.w.Write(l.encode(r)); err != nil {
+		logger.Warn("write access log error:", err)
+	}
+}
+
+func (l *accessLogger) sample(r *Record) bool {
+	if !r.Success || l.rate >= 1 {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.r.Float64() < l.rate
+}
+
+func (l *accessLogger) encode(r *Record) []byte {
+	buf := new(bytes.Buffer)
+	if !l.isLogfmt {
+		buf.WriteByte('{')
+	}
+	for i, f := range l.fields {
+		if i > 0 {
+			if l.isLogfmt {
+				buf.WriteByte(' ')
+			} else {
+				buf.WriteByte(',')
+			}
+		}
+		if l.isLogfmt {
+			buf.WriteString(f)
+			buf.WriteByte('=')
+		} else {
+			buf.WriteString(strconv.Quote(f))
+			buf.WriteByte(':')
+		}
+		l.writeValue(buf, r.value(f))
+	}
+	if !l.isLogfmt {
+		buf.WriteByte('}')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func (l *accessLogger) writeValue(buf *bytes.Buffer, v interface{}) {
+	switch val := v.(type) {
+	case string:
+		if l.isLogfmt {
+			if val != "" && !strings.ContainsAny(val, " =\"\t\r\n") {
+				buf.WriteString(val)
+				return
+			}
+			buf.WriteString(strconv.Quote(val))
+			return
+		}
+		b, _ := json.Marshal(val)
+		buf.Write(b)
+	case int64:
+		buf.WriteString(strconv.FormatInt(val, 10))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(val, 'f', 3, 64))
+	}
+}
+
+func (r *Record) value(f string) interface{} {
+	switch f {
+	case "time":
+		return r.Time.Format("2006-01-02T15:04:05.000Z07:00")
+	case "trace_id":
+		return r.TraceID
+	case "type":
+		return r.Type
+	case "client_ip":
+		return r.ClientIP
+	case "method":
+		return r.Method
+	case "route":
+		return r.Route
+	case "path":
+		return r.Path
+	case "status":
+		return r.Status
+	case "err_no":
+		return r.ErrNo
+	case "req_bytes":
+		return r.RequestBytes
+	case "resp_bytes":
+		return r.ResponseBytes
+	case "latency_ms":
+		return float64(r.Latency) / float64(time.Millisecond)
+	case "user_agent":
+		return r.UserAgent
+	case "upstream_calls":
+		return r.UpstreamCalls
+	}
+	return ""
+}
+
+type counterKey struct{}
+
+//ContextWithCounter 用于统计请求过程中调用下游的次数，未开启时不处理
+func ContextWithCounter(ctx context.Context) context.Context {
+	if !IsEnable() {
+		return ctx
+	}
+	return context.WithValue(ctx, counterKey{}, new(int64))
+}
+
+//ContextWithCounterFrom 和from共用一个计数，from没有则返回ctx
+func ContextWithCounterFrom(ctx, from context.Context) context.Context {
+	if c, ok := from.Value(counterKey{}).(*int64); ok {
+		return context.WithValue(ctx, counterKey{}, c)
+	}
+	return ctx
+}
+
+//AddUpstream curl和grpc的client每次调用下游时调用
+func AddUpstream(ctx context.Context) {
+	if ctx == nil {
+		return
+	}
+	if c, ok := ctx.Value(counterKey{}).(*int64); ok {
+		atomic.AddInt64(c, 1)
+	}
+}
+
+func UpstreamCalls(ctx context.Context) int64 {
+	if ctx == nil {
+		return 0
+	}
+	if c, ok := ctx.Value(counterKey{}).(*int64); ok {
+		return atomic.LoadInt64(c)
+	}
+	return 0
+}
@@ -0,0 +1,141 @@
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func newRecord() *Record {
+	return &Record{
+		Time:          time.Now(),
+		TraceID:       "abc",
+		Type:          "http",
+		Method:        "GET",
+		Route:         "/user/info",
+		Path:          "/user/info",
+		Status:        "200",
+		RequestBytes:  -1,
+		ResponseBytes: 12,
+		Latency:       1500 * time.Microsecond,
+		UserAgent:     "go test",
+		UpstreamCalls: 2,
+		Success:       true,
+	}
+}
+
+func TestJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := SetWriter(buf, configs.AccessLogConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { curLogger = nil }()
+
+	Log(newRecord())
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatal(buf.String(), err)
+	}
+	if len(m) != len(Fields) {
+		t.Fatalf("got %d fields, want %d", len(m), len(Fields))
+	}
+	if m["route"] != "/user/info" || m["latency_ms"] != 1.5 || m["upstream_calls"] != float64(2) {
+		t.Fatalf("unexpected record: %s", buf.String())
+	}
+}
+
+func TestLogfmt(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := SetWriter(buf, configs.AccessLogConfig{Format: "logfmt", Fields: []string{"status", "user_agent", "trace_id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { curLogger = nil }()
+
+	Log(newRecord())
+	if s := buf.String(); s != "status=200 user_agent=\"go test\" trace_id=abc\n" {
+		t.Fatalf("unexpected record: %q", s)
+	}
+
+	if err = SetWriter(buf, configs.AccessLogConfig{Fields: []string{"foo"}}); err == nil {
+		t.Fatal("unknown field should fail")
+	}
+}
+
+func TestSample(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := SetWriter(buf, configs.AccessLogConfig{SuccessSampleRate: 0.000001}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { curLogger = nil }()
+
+	for i := 0; i < 100; i++ {
+		Log(newRecord())
+	}
+	//失败的请求都记录
+	r := newRecord()
+	r.Success = false
+	Log(r)
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Fatalf("got %d records, want 1", n)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	ctx := ContextWithCounter(context.Background())
+	AddUpstream(ctx)
+	if n := UpstreamCalls(ctx); n != 0 {
+		t.Fatalf("counter should be disabled, got %d", n)
+	}
+
+	if err := SetWriter(ioutil.Discard, configs.AccessLogConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { curLogger = nil }()
+
+	ctx = ContextWithCounter(context.Background())
+	shared := ContextWithCounterFrom(context.Background(), ctx)
+	AddUpstream(ctx)
+	AddUpstream(shared)
+	if n := UpstreamCalls(ctx); n != 2 {
+		t.Fatalf("got %d upstream calls, want 2", n)
+	}
+}
+
+func TestRollingWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	w, err := newRollingWriter(path, "roll", 2, 1, "KB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	line := []byte(strings.Repeat("a", 600) + "\n")
+	for i := 0; i < 6; i++ {
+		if _, err = w.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{path, path + ".1", path + ".2"} {
+		if _, err = os.Stat(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = os.Stat(path + ".3"); err == nil {
+		t.Fatal("should keep at most 2 files")
+	}
+}
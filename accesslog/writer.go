@@ -0,0 +1,164 @@
+package accesslog
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsyan2008/hfw/common"
+)
+
+//dateFormat 同go-logger，按天切割的文件名是file.2006-01-02
+const dateFormat = "2006-01-02"
+
+//rollingWriter 按天或者大小切割文件，和go-logger的规则一致
+type rollingWriter struct {
+	path    string
+	daily   bool
+	maxNum  int
+	maxSize int64
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+	date string
+}
+
+//NewRollingWriter 按LoggerConfig的规则切割文件，dump等其他的文件日志也使用
+func NewRollingWriter(path, logType string, maxNum int32, size int64, unit string) (io.WriteCloser, error) {
+	return newRollingWriter(path, logType, maxNum, size, unit)
+}
+
+//LogFile 为空时是/opt/log或者程序目录下的程序名+ext，相对路径则相对于程序目录
+func LogFile(file, ext string) string {
+	if file == "" {
+		if common.IsExist("/opt/log") {
+			return filepath.Join("/opt/log", common.GetAppName()+ext)
+		}
+		return filepath.Join(common.GetAppPath(), common.GetAppName()+ext)
+	}
+	if !filepath.IsAbs(file) {
+		return filepath.Join(common.GetAppPath(), file)
+	}
+	return file
+}
+
+func newRollingWriter(path, logType string, maxNum int32, size int64, unit string) (*rollingWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return nil, err
+	}
+	w := &rollingWriter{
+		path:    path,
+		daily:   strings.ToLower(logType) != "roll",
+		maxNum:  int(maxNum),
+		maxSize: size * getUnit(unit),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	//重启后按文件的修改时间判断是否需要切割
+	if fi, err := w.file.Stat(); err == nil && fi.Size() > 0 {
+		w.date = fi.ModTime().Format(dateFormat)
+	}
+
+	return w, nil
+}
+
+func getUnit(u string) int64 {
+	switch strings.ToUpper(u) {
+	case "M", "MB":
+		return 1 << 20
+	case "G", "GB":
+		return 1 << 30
+	case "T", "TB":
+		return 1 << 40
+	default:
+		return 1 << 10
+	}
+}
+
+func (w *rollingWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file = f
+	w.size = fi.Size()
+	w.date = time.Now().Format(dateFormat)
+	return nil
+}
+
+func (w *rollingWriter) Write(p []byte) (n int, err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	w.rotate()
+
+	n, err = w.file.Write(p)
+	w.size += int64(n)
+	return
+}
+
+//rotate 切割失败时继续写当前文件
+func (w *rollingWriter) rotate() {
+	var target string
+	if w.daily {
+		if time.Now().Format(dateFormat) == w.date {
+			return
+		}
+		target = w.path + "." + w.date
+	} else {
+		if w.maxNum <= 1 || w.maxSize <= 0 || w.size < w.maxSize {
+			return
+		}
+		target = w.path + "." + strconv.Itoa(w.nextSuffix())
+	}
+	_ = os.Remove(target)
+	if err := os.Rename(w.path, target); err != nil {
+		return
+	}
+	_ = w.open()
+}
+
+//nextSuffix 覆盖最旧的文件，序号从1到maxNum
+func (w *rollingWriter) nextSuffix() int {
+	var suffix int
+	var maxTime int64
+	for i := 1; i <= w.maxNum; i++ {
+		fi, err := os.Stat(w.path + "." + strconv.Itoa(i))
+		if err != nil {
+			break
+		}
+		if fi.ModTime().UnixNano() > maxTime {
+			maxTime = fi.ModTime().UnixNano()
+			suffix = i
+		}
+	}
+	return suffix%w.maxNum + 1
+}
+
+func (w *rollingWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
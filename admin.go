@@ -0,0 +1,129 @@
+package hfw
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hsyan2008/hfw/admin"
+	"github.com/hsyan2008/hfw/encoding"
+	cron "github.com/robfig/cron/v3"
+)
+
+func init() {
+	admin.HandleFunc("/routes", routesHandler)
+	admin.HandleFunc("/cron", cronHandler)
+}
+
+//extraRoutes HandlerFunc和StaticHandler注册的路由，用于admin的/routes
+var extraRoutes = make(map[string]string)
+var extraRoutesLock = new(sync.Mutex)
+
+func addExtraRoute(pattern, handler string) {
+	extraRoutesLock.Lock()
+	defer extraRoutesLock.Unlock()
+	extraRoutes[pattern] = handler
+}
+
+type routeInfo struct {
+	Path    string
+	Method  string `json:",omitempty"`
+	Handler string
+}
+
+//routesHandler 所有注册的路由
+func routesHandler(w http.ResponseWriter, r *http.Request) {
+	var list []routeInfo
+	for path, ins := range routeMap {
+		list = append(list, routeInfo{Path: "/" + path, Handler: ins.controllerName + "." + ins.methodName})
+	}
+	for path, ins := range routeMapMethod {
+		i := strings.LastIndex(path, "for")
+		list = append(list, routeInfo{Path: "/" + path[:i], Method: path[i+3:], Handler: ins.controllerName + "." + ins.methodName})
+	}
+	extraRoutesLock.Lock()
+	for pattern, handler := range extraRoutes {
+		list = append(list, routeInfo{Path: pattern, Handler: handler})
+	}
+	extraRoutesLock.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Path == list[j].Path {
+			return list[i].Method < list[j].Method
+		}
+		return list[i].Path < list[j].Path
+	})
+
+	writeAdminJSON(w, list)
+}
+
+type cronInfo struct {
+	ID     cron.EntryID
+	Name   string
+	Spec   string
+	Next   time.Time
+	Prev   time.Time
+	Paused bool
+}
+
+//cronHandler GET查看所有的定时任务，POST的action是run、pause、resume、remove，id是任务的ID
+func cronHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		cronLock.Lock()
+		job, ok := cronJobs[cron.EntryID(id)]
+		cronLock.Unlock()
+		if !ok {
+			http.Error(w, "cron not found", http.StatusNotFound)
+			return
+		}
+		switch r.FormValue("action") {
+		case "run":
+			go job.cmd()
+		case "pause":
+			atomic.StoreInt32(&job.paused, 1)
+		case "resume":
+			atomic.StoreInt32(&job.paused, 0)
+		case "remove":
+			RemoveCron(cron.EntryID(id))
+		default:
+			http.Error(w, "invalid action", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var list []cronInfo
+	cronLock.Lock()
+	for _, e := range crontab.Entries() {
+		if job, ok := cronJobs[e.ID]; ok {
+			list = append(list, cronInfo{
+				ID:     e.ID,
+				Name:   job.name,
+				Spec:   job.spec,
+				Next:   e.Next,
+				Prev:   e.Prev,
+				Paused: atomic.LoadInt32(&job.paused) == 1,
+			})
+		}
+	}
+	cronLock.Unlock()
+
+	writeAdminJSON(w, list)
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	b, err := encoding.JSON.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,187 @@
+//Package admin 管理接口，使用单独的监听地址或者挂在http服务的前缀下，需要token或者ip白名单
+//其他包在init里通过HandleFunc注册，如breaker的/debug/breaker
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hsyan2008/hfw/configs"
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/signal"
+)
+
+const defaultPrefix = "/admin"
+
+var (
+	mux      = http.NewServeMux()
+	patterns []string
+	lock     = new(sync.Mutex)
+
+	conf    configs.AdminConfig
+	allowed []*net.IPNet
+)
+
+func init() {
+	HandleFunc("/debug/pprof/", pprof.Index)
+	HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	HandleFunc("/debug/pprof/profile", pprof.Profile)
+	HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	HandleFunc("/debug/pprof/trace", pprof.Trace)
+	HandleFunc("/goroutine", goroutineHandler)
+	HandleFunc("/", indexHandler)
+}
+
+//HandleFunc 注册管理接口，pattern相对于Prefix
+func HandleFunc(pattern string, h http.HandlerFunc) {
+	lock.Lock()
+	defer lock.Unlock()
+	mux.HandleFunc(pattern, h)
+	if pattern != "/" {
+		patterns = append(patterns, pattern)
+	}
+}
+
+//Init 校验配置，没有单独的Address时挂在http.DefaultServeMux的Prefix下
+func Init(c configs.AdminConfig) (err error) {
+	if !c.IsEnable {
+		return nil
+	}
+	if c.Prefix == "" {
+		c.Prefix = defaultPrefix
+	}
+	c.Prefix = "/" + strings.Trim(c.Prefix, "/")
+	if c.Prefix == "/" {
+		return errors.New("admin prefix can not be /")
+	}
+	//挂在http服务下时，经过本机的反向代理的请求都来自127.0.0.1，不能只靠ip白名单
+	if c.Address == "" && c.Token == "" {
+		return errors.New("admin token is required when admin has no separate address")
+	}
+	if c.Token == "" && len(c.AllowIPs) == 0 {
+		c.AllowIPs = []string{"127.0.0.1", "::1"}
+	}
+	allowed, err = parseAllowIPs(c.AllowIPs)
+	if err != nil {
+		return err
+	}
+	conf = c
+
+	if conf.Address == "" {
+		http.Handle(conf.Prefix+"/", http.StripPrefix(conf.Prefix, Handler()))
+		logger.Infof("admin is enabled on %s", conf.Prefix)
+	}
+
+	return nil
+}
+
+//Start 有单独的Address时监听，直到程序退出
+func Start() (err error) {
+	if !conf.IsEnable || conf.Address == "" {
+		return nil
+	}
+	lis, err := net.Listen("tcp", conf.Address)
+	if err != nil {
+		return fmt.Errorf("admin listen %s faild: %v", conf.Address, err)
+	}
+	srv := &http.Server{Handler: Handler()}
+	go func() {
+		<-signal.GetSignalContext().Ctx.Done()
+		srv.Close()
+	}()
+	go func() {
+		logger.Mix("Admin listen on http:", lis.Addr().String())
+		if err := srv.Serve(lis); err != nil && err != http.ErrServerClosed {
+			logger.Warn("admin server error:", err)
+		}
+	}()
+
+	return nil
+}
+
+//Handler 带认证的管理接口
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkAuth(r); err != nil {
+			logger.Warnf("admin %s from %s denied: %v", r.URL.Path, r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func parseAllowIPs(ips []string) (nets []*net.IPNet, err error) {
+	for _, v := range ips {
+		if !strings.Contains(v, "/") {
+			if strings.Contains(v, ":") {
+				v += "/128"
+			} else {
+				v += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid admin allow ip: %v", err)
+		}
+		nets = append(nets, n)
+	}
+	return
+}
+
+//checkAuth 配置了AllowIPs则ip必须在其中，配置了Token则token必须一致
+func checkAuth(r *http.Request) error {
+	if !conf.IsEnable {
+		return errors.New("admin is disabled")
+	}
+	if len(allowed) > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		ok := false
+		for _, n := range allowed {
+			if ip != nil && n.Contains(ip) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return errors.New("ip not allowed")
+		}
+	}
+	if conf.Token != "" {
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(conf.Token)) != 1 {
+			return errors.New("invalid token")
+		}
+	}
+	return nil
+}
+
+//indexHandler 列出所有的管理接口
+func indexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	lock.Lock()
+	list := append([]string(nil), patterns...)
+	lock.Unlock()
+	sort.Strings(list)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, p := range list {
+		fmt.Fprintln(w, p)
+	}
+}
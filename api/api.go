@@ -8,14 +8,17 @@ import (
 	"net/http"
 	neturl "net/url"
 	"strings"
+	"sync"
 	"time"
 
-	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw"
+	"github.com/hsyan2008/hfw/breaker"
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/curl"
 	"github.com/hsyan2008/hfw/encoding"
+	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
+	logger "github.com/hsyan2008/hfw/logging"
 	"github.com/hsyan2008/hfw/service/discovery"
 )
 
@@ -56,12 +59,23 @@ func RequestUnmarshal(httpCtx *hfw.HTTPContext, params interface{}) (err error)
 
 //用于调用内部的其他标准http服务
 //标准的http服务是指response里包含err_no、err_msg和results
+//使用Server里配置的服务发现，ResolverType默认是consul
 func StdCallByConsul(httpCtx *hfw.HTTPContext, serviceName, uri string, p interface{}, results interface{}, opts ...CallOption) (err error) {
-	resolverAddresses := configs.Config.Server.ResolverAddresses
-	if len(resolverAddresses) == 0 {
+	server := configs.Config.Server
+	resolverType := server.ResolverType
+	if resolverType == "" {
+		resolverType = dc.ConsulResolver
+	}
+	if len(server.ResolverAddresses) == 0 && resolverType != dc.K8sResolver {
 		return errors.New("nil resolverAddresses")
 	}
-	cr, err := discovery.NewConsulResolver(serviceName, resolverAddresses[0], discovery.NewBalancePolicyCallOpt(discovery.RobinPolicy))
+	cr, err := stdResolver(configs.GrpcConfig{
+		ServerName:        serviceName,
+		ResolverType:      resolverType,
+		ResolverAddresses: server.ResolverAddresses,
+		Etcd:              server.Etcd,
+		Consul:            server.Consul,
+	})
 	if err != nil {
 		return
 	}
@@ -69,6 +83,26 @@ func StdCallByConsul(httpCtx *hfw.HTTPContext, serviceName, uri string, p interf
 	return StdCall(httpCtx, cr, uri, p, results, opts...)
 }
 
+//stdResolvers StdCallByConsul使用的Resolver，每个服务只NewResolver一次，不Close
+var stdResolvers sync.Map
+
+func stdResolver(cc configs.GrpcConfig) (*discovery.Resolver, error) {
+	key := fmt.Sprintf("%s_%s_%s", cc.ResolverType, cc.ServerName, strings.Join(cc.ResolverAddresses, ","))
+	if cr, ok := stdResolvers.Load(key); ok {
+		return cr.(*discovery.Resolver), nil
+	}
+	cr, err := discovery.NewResolver(cc, discovery.NewBalancePolicyCallOpt(discovery.RobinPolicy))
+	if err != nil {
+		return nil, err
+	}
+	//并发时只保留一个引用
+	if old, loaded := stdResolvers.LoadOrStore(key, cr); loaded {
+		cr.Close()
+		return old.(*discovery.Resolver), nil
+	}
+	return cr, nil
+}
+
 //用于调用内部的其他标准http服务
 //标准的http服务是指response里包含err_no、err_msg和results
 func StdCall(httpCtx *hfw.HTTPContext, addressParams interface{}, uri string, p interface{}, results interface{}, opts ...CallOption) (err error) {
@@ -89,6 +123,7 @@ func StdCall(httpCtx *hfw.HTTPContext, addressParams interface{}, uri string, p
 }
 
 //用于任意返回json数据的http服务
+//addressParams是*discovery.Resolver或者地址列表
 func Call(httpCtxIn *hfw.HTTPContext, header map[string]string, addressParams interface{}, uri string, p interface{}, resp interface{}, opts ...CallOption) (err error) {
 	if httpCtxIn == nil || httpCtxIn.Ctx == nil {
 		return common.NewRespErr(500, "nil httpCtx")
@@ -97,11 +132,11 @@ func Call(httpCtxIn *hfw.HTTPContext, header map[string]string, addressParams in
 	defer httpCtx.Cancel()
 
 	var (
-		cr        *discovery.ConsulResolver
+		cr        *discovery.Resolver
 		addresses []string
 	)
 	switch i := addressParams.(type) {
-	case *discovery.ConsulResolver:
+	case *discovery.Resolver:
 		cr = i
 	case []string:
 		addresses = i
@@ -128,6 +163,14 @@ func Call(httpCtxIn *hfw.HTTPContext, header map[string]string, addressParams in
 			return common.NewRespErr(500, err)
 		}
 	}
+	//路由规则用到的请求头，从上游请求透传
+	if cr != nil && httpCtx.Request != nil {
+		for _, k := range dc.RouteHeaders(cr.Routes()) {
+			if v := httpCtx.Request.Header.Get(k); v != "" && c.Headers.Get(k) == "" {
+				c.Headers.Set(k, v)
+			}
+		}
+	}
 
 	if cr == nil {
 		httpCtx.Debugf("Call:%v %s %s start", addresses, uri, string(c.PostBytes))
@@ -149,8 +192,10 @@ FOR:
 		case <-httpCtx.Ctx.Done():
 			return httpCtx.Ctx.Err()
 		default:
+			done := func(error) {}
 			if cr != nil {
-				addr, err := cr.GetAddress()
+				var addr string
+				addr, done, err = cr.Pick(c.Headers)
 				if err != nil {
 					return common.NewRespErr(500, err)
 				}
@@ -158,6 +203,7 @@ FOR:
 			}
 			c.Url, err = getApiUrl(addresses, uri)
 			if err != nil {
+				done(err)
 				return common.NewRespErr(500, err)
 			}
 			err = func() (err error) {
@@ -168,11 +214,20 @@ FOR:
 				}(time.Now())
 				c.Headers.Set("Trace-Id", tmpHttpCtx.GetTraceID())
 				c.SetContext(httpCtx.Ctx)
+				if breaker.IsEnable() {
+					c.SetBreaker(getBreaker(cr, addresses, c.Url))
+				}
 				rs, err = c.Request()
 				if err != nil {
 					tmpHttpCtx.Warnf("Url:%s %s", c.Url, err.Error())
+					done(err)
 					return
 				}
+				if rs.StatusCode >= http.StatusInternalServerError {
+					done(fmt.Errorf("StatusCode:%d", rs.StatusCode))
+				} else {
+					done(nil)
+				}
 				return
 			}()
 			if err != nil {
@@ -210,6 +265,24 @@ FOR:
 	return nil
 }
 
+//getBreaker 服务发现的按服务名，否则按地址列表
+func getBreaker(cr *discovery.Resolver, addresses []string, url string) *breaker.Breaker {
+	var service string
+	if cr != nil {
+		service = cr.ServiceName()
+	} else {
+		service = strings.Join(addresses, ",")
+	}
+	conf := breaker.DefaultConfig()
+	if conf.PerEndpoint {
+		if u, err := neturl.Parse(url); err == nil {
+			return breaker.Get(breaker.Key(service, u.Host))
+		}
+	}
+
+	return breaker.Get(service)
+}
+
 func getApiUrl(addresses []string, uri string) (string, error) {
 	n := len(addresses)
 	var domain string
@@ -284,3 +357,17 @@ func (t DelHeadersCallOption) Do(c *curl.Curl) error {
 	}
 	return nil
 }
+
+//FallbackCallOption 熔断或者请求失败时调用，返回的Response作为结果，设置后失败不再重试
+type FallbackCallOption struct {
+	fallback func(error) (*curl.Response, error)
+}
+
+func NewFallbackCallOption(fallback func(error) (*curl.Response, error)) CallOption {
+	return FallbackCallOption{fallback}
+}
+
+func (t FallbackCallOption) Do(c *curl.Curl) error {
+	c.SetFallback(t.fallback)
+	return nil
+}
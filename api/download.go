@@ -6,11 +6,11 @@ import (
 	"net/http"
 	"time"
 
-	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw"
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/curl"
 	"github.com/hsyan2008/hfw/encoding"
+	logger "github.com/hsyan2008/hfw/logging"
 )
 
 func Download(httpCtx *hfw.HTTPContext, url string, p interface{}) (content []byte, err error) {
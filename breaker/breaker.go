@@ -0,0 +1,375 @@
+//Package breaker 熔断器，按服务或者节点统计失败
+//Usage:
+//b := breaker.Get("user")
+//done, err := b.Allow()
+//if err != nil {
+//	//熔断中，可以降级处理
+//}
+//err = call()
+//done(err == nil)
+//或者err = b.Do(call, fallback)
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/prometheus"
+)
+
+type State int32
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+var (
+	defaultWindow              int64   = 10
+	defaultMinRequests         int64   = 20
+	defaultErrorRate           float64 = 0.5
+	defaultConsecutiveFailures int64   = 5
+	defaultOpenTimeout         int64   = 5000
+	defaultHalfOpenRequests    int64   = 1
+)
+
+//每个窗口的统计
+type bucket struct {
+	sec      int64
+	success  int64
+	failure  int64
+	rejected int64
+}
+
+type Breaker struct {
+	name string
+	conf configs.BreakerConfig
+
+	lock                sync.Mutex
+	state               State
+	buckets             []bucket
+	consecutiveFailures int64
+	openedAt            time.Time
+	halfOpenInflight    int64
+	halfOpenSuccess     int64
+
+	now func() time.Time
+}
+
+//Stats 熔断器的当前状态，用于debug
+type Stats struct {
+	Name                string
+	State               string
+	Success             int64
+	Failure             int64
+	Rejected            int64
+	ConsecutiveFailures int64
+	OpenedAt            string
+}
+
+//New 未配置的项使用默认值
+func New(name string, conf configs.BreakerConfig) *Breaker {
+	if conf.Window <= 0 {
+		conf.Window = defaultWindow
+	}
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = defaultMinRequests
+	}
+	if conf.ErrorRate <= 0 || conf.ErrorRate > 1 {
+		conf.ErrorRate = defaultErrorRate
+	}
+	if conf.ConsecutiveFailures <= 0 {
+		conf.ConsecutiveFailures = defaultConsecutiveFailures
+	}
+	if conf.OpenTimeout <= 0 {
+		conf.OpenTimeout = defaultOpenTimeout
+	}
+	if conf.HalfOpenRequests <= 0 {
+		conf.HalfOpenRequests = defaultHalfOpenRequests
+	}
+
+	return &Breaker{
+		name:    name,
+		conf:    conf,
+		buckets: make([]bucket, conf.Window),
+		now:     time.Now,
+	}
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+func (b *Breaker) State() State {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refresh(b.now())
+
+	return b.state
+}
+
+//Allow 允许请求则返回done，请求结束后必须调用done报告结果
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	b.refresh(now)
+
+	switch b.state {
+	case StateOpen:
+		b.bucket(now).rejected++
+		prometheus.BreakerRequests(b.name, "rejected")
+		return nil, fmt.Errorf("%w: %s", ErrOpen, b.name)
+	case StateHalfOpen:
+		if b.halfOpenInflight+b.halfOpenSuccess >= b.conf.HalfOpenRequests {
+			b.bucket(now).rejected++
+			prometheus.BreakerRequests(b.name, "rejected")
+			return nil, fmt.Errorf("%w: %s", ErrOpen, b.name)
+		}
+		b.halfOpenInflight++
+	}
+
+	var once sync.Once
+	return func(success bool) {
+		once.Do(func() {
+			b.report(success)
+		})
+	}, nil
+}
+
+//Do run的错误都算失败，如果需要区分业务错误请使用Allow
+//fallback不为nil时，熔断或者失败会调用fallback
+func (b *Breaker) Do(run func() error, fallback func(error) error) error {
+	done, err := b.Allow()
+	if err == nil {
+		err = run()
+		done(err == nil)
+	}
+	if err != nil && fallback != nil {
+		return fallback(err)
+	}
+
+	return err
+}
+
+//Reset 恢复到关闭状态
+func (b *Breaker) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.buckets = make([]bucket, b.conf.Window)
+	b.consecutiveFailures = 0
+	b.setState(StateClosed, b.now())
+}
+
+func (b *Breaker) Stats() Stats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	b.refresh(now)
+	s := Stats{
+		Name:                b.name,
+		State:               b.state.String(),
+		ConsecutiveFailures: b.consecutiveFailures,
+	}
+	for _, v := range b.buckets {
+		if now.Unix()-v.sec < b.conf.Window {
+			s.Success += v.success
+			s.Failure += v.failure
+			s.Rejected += v.rejected
+		}
+	}
+	if b.state != StateClosed {
+		s.OpenedAt = b.openedAt.Format("2006-01-02 15:04:05")
+	}
+
+	return s
+}
+
+func (b *Breaker) report(success bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	b.refresh(now)
+	bk := b.bucket(now)
+
+	if success {
+		bk.success++
+		b.consecutiveFailures = 0
+		prometheus.BreakerRequests(b.name, "success")
+	} else {
+		bk.failure++
+		b.consecutiveFailures++
+		prometheus.BreakerRequests(b.name, "failure")
+	}
+
+	switch b.state {
+	case StateHalfOpen:
+		if b.halfOpenInflight > 0 {
+			b.halfOpenInflight--
+		}
+		if !success {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.halfOpenSuccess++
+		if b.halfOpenSuccess >= b.conf.HalfOpenRequests {
+			b.buckets = make([]bucket, b.conf.Window)
+			b.setState(StateClosed, now)
+		}
+	case StateClosed:
+		if !success && b.shouldOpen(now) {
+			b.setState(StateOpen, now)
+		}
+	}
+}
+
+func (b *Breaker) shouldOpen(now time.Time) bool {
+	if b.consecutiveFailures >= b.conf.ConsecutiveFailures {
+		return true
+	}
+	var total, failure int64
+	for _, v := range b.buckets {
+		if now.Unix()-v.sec < b.conf.Window {
+			total += v.success + v.failure
+			failure += v.failure
+		}
+	}
+
+	return total >= b.conf.MinRequests && float64(failure) >= float64(total)*b.conf.ErrorRate
+}
+
+//refresh 熔断超时后进入半开状态
+func (b *Breaker) refresh(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= time.Duration(b.conf.OpenTimeout)*time.Millisecond {
+		b.setState(StateHalfOpen, now)
+	}
+}
+
+func (b *Breaker) bucket(now time.Time) *bucket {
+	sec := now.Unix()
+	bk := &b.buckets[sec%int64(len(b.buckets))]
+	if bk.sec != sec {
+		*bk = bucket{sec: sec}
+	}
+
+	return bk
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	b.halfOpenInflight = 0
+	b.halfOpenSuccess = 0
+	if state == StateOpen {
+		b.openedAt = now
+	}
+	prometheus.BreakerState(b.name, int(state))
+	if hook := stateChangeHook; hook != nil {
+		go hook(b.name, from, state)
+	}
+}
+
+var (
+	defaultConfig   configs.BreakerConfig
+	breakers        = make(map[string]*Breaker)
+	breakersLock    = new(sync.RWMutex)
+	stateChangeHook func(name string, from, to State)
+)
+
+//Init 设置默认配置，由hfw.Init调用
+func Init(conf configs.BreakerConfig) {
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+	defaultConfig = conf
+}
+
+//IsEnable 默认配置是否开启
+func IsEnable() bool {
+	breakersLock.RLock()
+	defer breakersLock.RUnlock()
+	return defaultConfig.IsEnable
+}
+
+//DefaultConfig 返回默认配置
+func DefaultConfig() configs.BreakerConfig {
+	breakersLock.RLock()
+	defer breakersLock.RUnlock()
+	return defaultConfig
+}
+
+//SetStateChangeHook 状态变化时异步调用，如用于报警
+func SetStateChangeHook(f func(name string, from, to State)) {
+	stateChangeHook = f
+}
+
+//Get 使用默认配置
+func Get(name string) *Breaker {
+	return GetWithConfig(name, DefaultConfig())
+}
+
+//GetWithConfig 同一个name只会创建一次，之后的conf无效
+func GetWithConfig(name string, conf configs.BreakerConfig) *Breaker {
+	breakersLock.RLock()
+	b, ok := breakers[name]
+	breakersLock.RUnlock()
+	if ok {
+		return b
+	}
+
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+	if b, ok = breakers[name]; ok {
+		return b
+	}
+	b = New(name, conf)
+	breakers[name] = b
+
+	return b
+}
+
+//Key 按节点熔断时的名称
+func Key(service, endpoint string) string {
+	if endpoint == "" {
+		return service
+	}
+	return service + "@" + endpoint
+}
+
+//All 所有的熔断器状态，按名称排序
+func All() (list []Stats) {
+	breakersLock.RLock()
+	for _, b := range breakers {
+		list = append(list, b.Stats())
+	}
+	breakersLock.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return
+}
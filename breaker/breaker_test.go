@@ -0,0 +1,82 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := New("test", configs.BreakerConfig{ConsecutiveFailures: 3, OpenTimeout: 1000, HalfOpenRequests: 2})
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		done, err := b.Allow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		done(false)
+	}
+	if b.State() != StateOpen {
+		t.Fatalf("want:%s got:%s", StateOpen, b.State())
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("want:%v got:%v", ErrOpen, err)
+	}
+
+	now = now.Add(time.Second)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("want:%s got:%s", StateHalfOpen, b.State())
+	}
+	done1, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done2, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Allow(); err == nil {
+		t.Fatal("half open should limit requests")
+	}
+	done1(true)
+	done2(true)
+	if b.State() != StateClosed {
+		t.Fatalf("want:%s got:%s", StateClosed, b.State())
+	}
+}
+
+func TestBreakerErrorRate(t *testing.T) {
+	now := time.Now()
+	b := New("rate", configs.BreakerConfig{MinRequests: 10, ErrorRate: 0.5, ConsecutiveFailures: 100})
+	b.now = func() time.Time { return now }
+
+	fallback := func(error) error { return nil }
+	for i := 0; i < 10; i++ {
+		_ = b.Do(func() error {
+			if i%2 == 1 {
+				return errors.New("fail")
+			}
+			return nil
+		}, nil)
+	}
+	if b.State() != StateOpen {
+		t.Fatalf("want:%s got:%s stats:%+v", StateOpen, b.State(), b.Stats())
+	}
+	if err := b.Do(func() error { return nil }, fallback); err != nil {
+		t.Fatal("fallback should be called")
+	}
+	if s := b.Stats(); s.Success != 5 || s.Failure != 5 || s.Rejected != 1 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+
+	//窗口过期后，统计清零
+	now = now.Add(time.Duration(defaultOpenTimeout)*time.Millisecond + time.Duration(defaultWindow)*time.Second)
+	b.Reset()
+	if s := b.Stats(); s.State != "closed" || s.Failure != 0 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
@@ -0,0 +1,47 @@
+package breaker
+
+import (
+	"net/http"
+
+	"github.com/hsyan2008/hfw/admin"
+	"github.com/hsyan2008/hfw/encoding"
+)
+
+func init() {
+	admin.HandleFunc("/debug/breaker", Handler)
+}
+
+//Handler 输出所有熔断器的状态
+//?name=xxx只看指定的熔断器，POST并且reset=1则重置
+func Handler(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	if name != "" && r.Method == http.MethodPost && r.FormValue("reset") == "1" {
+		breakersLock.RLock()
+		b, ok := breakers[name]
+		breakersLock.RUnlock()
+		if !ok {
+			http.Error(w, "breaker not found: "+name, http.StatusNotFound)
+			return
+		}
+		b.Reset()
+	}
+
+	list := All()
+	if name != "" {
+		var tmp []Stats
+		for _, v := range list {
+			if v.Name == name {
+				tmp = append(tmp, v)
+			}
+		}
+		list = tmp
+	}
+
+	b, err := encoding.JSON.Marshal(list)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
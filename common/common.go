@@ -179,9 +179,22 @@ func GetTraceIDFromRequest(r *http.Request) (traceID string) {
 	if traceID == "" {
 		traceID = r.URL.Query().Get("trace_id")
 	}
+	//W3C traceparent
+	if traceID == "" {
+		traceID = GetTraceIDFromTraceparent(r.Header.Get("traceparent"))
+	}
 	if traceID == "" {
 		traceID = GetPureUUID()
 	}
 
 	return
 }
+
+//GetTraceIDFromTraceparent 取出W3C traceparent里的trace-id，格式不对返回空
+func GetTraceIDFromTraceparent(traceparent string) string {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	return parts[1]
+}
@@ -15,6 +15,11 @@ func GetTraceIDFromIncomingContext(ctx context.Context) string {
 	if len(traceIDs) > 0 {
 		return traceIDs[0]
 	}
+	if v := md.Get("traceparent"); len(v) > 0 {
+		if traceID := GetTraceIDFromTraceparent(v[0]); traceID != "" {
+			return traceID
+		}
+	}
 	return GetPureUUID()
 }
 
@@ -23,7 +23,19 @@ type AllConfig struct {
 	Redis      RedisConfig
 	Session    SessionConfig
 	Prometheus PrometheusConfig
-	Custom     map[string]string
+	//熔断的默认配置，用于api.Call和client.Do
+	Breaker BreakerConfig
+	//分布式追踪
+	Trace TraceConfig
+	//管理接口
+	Admin AdminConfig
+	//超过阈值时自动采集profile
+	Profiler ProfilerConfig
+	//请求和响应的完整记录，用于排查和重放
+	Dump DumpConfig
+	//curl的客户端配置，key是名字，default是默认的
+	Curl   map[string]CurlConfig
+	Custom map[string]string
 }
 
 type RedisConfig struct {
@@ -46,6 +58,128 @@ type SessionConfig struct {
 	Expiration int64
 }
 
+//TraceConfig 分布式追踪，兼容OpenTelemetry，使用W3C traceparent传递
+type TraceConfig struct {
+	IsEnable bool
+	//默认是程序名
+	ServiceName string
+	//导出方式，支持otlp、stdout、file，默认stdout
+	Exporter string
+	//otlp的地址，如http://127.0.0.1:4318/v1/traces，使用json格式
+	Endpoint string
+	//otlp请求的header，如认证
+	Headers map[string]string
+	//Exporter是file时的文件，相对路径则相对于程序目录
+	File string
+	//新trace的采样比例，0-1，默认1，有上游的跟随上游
+	SampleRate float64
+	//每批导出的数量，默认512
+	BatchSize int
+	//导出的间隔，单位毫秒，默认5000
+	FlushInterval int64
+}
+
+//AdminConfig 管理接口，包括日志级别、pprof、goroutine、路由、配置、定时任务、熔断和负载均衡
+type AdminConfig struct {
+	IsEnable bool
+	//单独监听的地址，如127.0.0.1:6060，为空则挂在http服务的Prefix下
+	Address string
+	//挂在http服务下时的前缀，默认/admin
+	Prefix string
+	//请求需要带上Authorization: Bearer xxx或者?token=xxx，没有Address时必须设置
+	Token string
+	//允许访问的ip或者网段，如127.0.0.1、10.0.0.0/8，只使用连接的地址，不信任X-Forwarded-For
+	//Token和AllowIPs都为空时只允许127.0.0.1和::1
+	AllowIPs []string
+}
+
+//ProfilerConfig 超过任一阈值时采集cpu、heap、goroutine、mutex的profile，可通过admin的/profiles查看和下载
+type ProfilerConfig struct {
+	IsEnable bool
+	//保存的目录，默认程序目录下的profiles，相对路径则相对于程序目录
+	Dir string
+	//最多保留的文件数，默认40
+	MaxFiles int
+	//检查的间隔，单位秒，默认5
+	Interval int64
+	//两次采集的最小间隔，单位秒，默认300
+	CoolDown int64
+	//cpu profile的采集时长，单位秒，默认10
+	CPUDuration int64
+	//以下是阈值，0表示不检查
+	//goroutine的数量
+	Goroutines int
+	//常驻内存，单位MB，目前只支持linux
+	RSS int64
+	//检查间隔内请求耗时的p99，单位毫秒
+	LatencyP99 int64
+	//正在处理的请求数
+	Concurrence int
+}
+
+//CurlConfig curl的客户端，相同配置的请求共用连接池，时间的单位都是毫秒
+type CurlConfig struct {
+	//请求的host匹配时自动使用，如api.example.com、*.example.com
+	Hosts []string
+	//没有调用SetTimeout时的超时时间，默认5000
+	Timeout int64
+	//所有请求都保持连接，否则需要调用SetKeepAlive
+	KeepAlive bool
+	//默认100
+	MaxIdleConns int
+	//默认8
+	MaxIdleConnsPerHost int
+	//默认0，不限制
+	MaxConnsPerHost int
+	//默认120000
+	IdleConnTimeout int64
+	//默认3000
+	DialTimeout int64
+	//tcp的keepalive，默认30000
+	DialKeepAlive int64
+	//默认10000
+	TLSHandshakeTimeout int64
+	//默认0，不限制
+	ResponseHeaderTimeout int64
+	//默认1000
+	ExpectContinueTimeout int64
+	DisableHTTP2          bool
+	//不校验服务端的证书，默认校验
+	InsecureSkipVerify bool
+	//额外信任的CA证书，相对路径则相对于程序目录
+	CAFile string
+	//客户端证书
+	CertFile string
+	KeyFile  string
+	//代理，如http://127.0.0.1:8080，为空则使用环境变量，SetProxy优先
+	Proxy string
+}
+
+//DumpConfig 记录http和grpc unary的请求和响应，每行一个json，文件的配置同LoggerConfig
+//Routes为空表示所有路由，TraceIDs、ErrNos都为空表示不过滤，否则满足其一即可
+type DumpConfig struct {
+	IsEnable bool
+	//默认是程序目录或者/opt/log下的程序名.dump.log，相对路径则相对于程序目录
+	LogFile string
+	//daily或者roll，默认daily
+	LogType   string
+	LogMaxNum int32
+	LogSize   int64
+	LogUnit   string
+	//http是路由的模板，如/index/index，grpc是完整的方法名，如/pb.Hello/Say，以*结尾表示前缀
+	Routes   []string
+	TraceIDs []string
+	ErrNos   []int64
+	//只记录失败的请求
+	OnlyError bool
+	//请求和响应的body最多记录的字节数，默认65536
+	MaxBodySize int
+	//需要隐藏的header，不区分大小写，默认Authorization、Cookie、Set-Cookie
+	RedactHeaders []string
+	//需要隐藏的json、表单和query的字段，不区分大小写，默认password、passwd、token、secret
+	RedactFields []string
+}
+
 type PrometheusConfig struct {
 	IsEnable         bool
 	RoutePath        string   //注册路由，供prometheus拉取数据
@@ -62,13 +196,21 @@ type ServerConfig struct {
 	CertFile string
 	KeyFile  string
 	Phrase   string
+	//客户端ca证书，配置后开启双向认证(mTLS)，要求客户端提供证书
+	CaFile string
+	//按方法限制调用方身份(证书的CN、DNS SAN、URI SAN，如spiffe://example.org/ns/default/sa/web)
+	//key是方法全名(/pkg.Service/Method)、服务通配(/pkg.Service/*)或者*，value支持后缀*通配
+	AllowedIdentities map[string][]string
+	//token认证配置，grpc和http共用
+	Auth AuthConfig
 
 	//grpc服务使用
 	MaxRecvMsgSize int
 	MaxSendMsgSize int
 
 	//服务注册配置
-	//服务注册类型，目前可选static、consul，默认是static
+	//服务注册类型，目前可选static、consul、etcd、k8s、memory，默认是static
+	//k8s下由service的Endpoints自动注册，不需要ResolverAddresses
 	ResolverType string
 	//服务注册的地址，如consul、etcd地址
 	ResolverAddresses []string
@@ -79,6 +221,55 @@ type ServerConfig struct {
 	//指定注册的网卡地址，或者在上方的Address里指定ip
 	Interface string
 	Tags      []string
+	//注册的权重，作为weight=N的tag，weighted_round_robin使用，默认100
+	Weight int
+	//所在的区域，作为zone=xxx的tag，zone_aware优先调用同区域的服务
+	Zone string
+	//注册的版本，默认是common.VERSION，用于灰度路由
+	Version string
+	//注册的其他元数据，consul里是service meta，etcd里存在value里
+	Meta map[string]string
+	//ResolverType是etcd时的配置
+	Etcd EtcdConfig
+	//ResolverType是consul时的配置，ResolverAddresses可以配置多个agent地址，不可用时切换
+	Consul ConsulConfig
+}
+
+//AuthConfig 认证配置，以下几种方式可同时使用，按StaticKeys、APIKeys、JWT的顺序验证
+type AuthConfig struct {
+	//grpc服务端是否自动认证，开启后handler里不需要再调用Auth
+	IsEnable bool
+	//不需要认证的方法，规则同AllowedIdentities，健康检查和反射默认不需要认证
+	ExemptMethods []string
+	//静态token，通过authorization: Bearer xxx或者旧的x传递，可配置多个用于轮换
+	StaticKeys []AuthKeyConfig
+	//通过x-api-key传递
+	APIKeys []AuthKeyConfig
+	JWT     JWTConfig
+	//方法或者路由需要的scope，key的规则同AllowedIdentities，需要全部满足
+	Scopes map[string][]string
+}
+
+type AuthKeyConfig struct {
+	Key     string
+	Subject string
+	Scopes  []string
+	//过期时间，格式2006-01-02 15:04:05，为空则不过期
+	ExpireAt string
+}
+
+type JWTConfig struct {
+	//HS256、HS384、HS512使用
+	Secret string
+	//RS*、ES*使用的公钥pem文件
+	PublicKeyFile string
+	//本地jwks文件，修改后自动重新加载
+	JWKSFile string
+	//不为空则校验iss和aud
+	Issuer   string
+	Audience string
+	//允许的时间误差，单位秒
+	Leeway int64
 }
 
 //HTTPServerConfig ..
@@ -106,6 +297,29 @@ type LoggerConfig struct {
 	LogMaxNum int32
 	LogSize   int64
 	LogUnit   string
+	//日志的输出，go-logger(默认)或者json，文件的配置相同
+	//接入其他的日志系统可以在Init之后调用logging.SetHandler
+	Handler string
+	//访问日志，写入单独的文件
+	AccessLog AccessLogConfig
+}
+
+//AccessLogConfig 每个请求一条结构化日志，文件的配置同LoggerConfig
+type AccessLogConfig struct {
+	IsEnable bool
+	//默认是程序目录或者/opt/log下的程序名.access.log，相对路径则相对于程序目录
+	LogFile string
+	//daily或者roll，默认daily
+	LogType   string
+	LogMaxNum int32
+	LogSize   int64
+	LogUnit   string
+	//json或者logfmt，默认json
+	Format string
+	//输出的字段及顺序，默认全部，见accesslog.Fields
+	Fields []string
+	//成功(http是2xx，grpc是OK，且ErrNo为0)的请求的采样比例，0-1，默认1
+	SuccessSampleRate float64
 }
 
 //DbConfig ..
@@ -172,21 +386,178 @@ type GrpcConfig struct {
 	//指定tag
 	Tag string
 
-	//服务发现类型，目前可选static、consul，默认是static
+	//服务发现类型，目前可选static、consul、etcd、file、dns、k8s、memory，默认是static
 	ResolverType string
 	//默认ResolverType+ServerName，必须保证在同个项目里所有外部服务都是唯一
 	ResolverScheme string
 	//服务发现的地址，如consul、etcd地址
+	//memory是进程内注册中心的名字
+	//file是地址文件的路径，json或者toml格式，修改后自动生效
+	//dns是可选的dns服务器地址，如8.8.8.8:53
 	ResolverAddresses []string
-	//负载均衡策略名称，支持round_robin、pick_first、p2c，默认是p2c
+	//dns重新解析的间隔，单位秒，默认30
+	ResolveInterval int64
+	//k8s的配置，ResolverAddresses是可选的api server地址，默认使用pod里的配置
+	K8s K8sConfig
+	//ResolverType是etcd时的配置
+	Etcd EtcdConfig
+	//ResolverType是consul时的配置，ResolverAddresses可以配置多个agent地址，不可用时切换
+	Consul ConsulConfig
+	//负载均衡策略名称，支持round_robin、pick_first、p2c、weighted_round_robin、zone_aware、consistent_hash，默认是p2c
 	BalancerName string
 
-	//服务地址，如果ResolverType是static，必填
+	//服务地址，如果ResolverType是static或dns，必填
+	//dns下是要解析的域名，如hello.example.com:8080，或者SRV记录，如_grpc._tcp.hello.example.com
 	Addresses []string
 
 	//调用具有证书的grpc服务，必须要指定客户端证书
+	//如果配置了CaFile和KeyFile，则作为双向认证(mTLS)的客户端证书
 	CertFile string
+	KeyFile  string
+	//服务端证书的ca，配置后开启双向认证(mTLS)
+	CaFile string
 
 	//是否需要Auth验证
 	IsAuth bool
+
+	//client.Do的重试策略
+	Retry RetryConfig
+
+	//熔断配置，不开启则使用全局的Breaker
+	Breaker BreakerConfig
+
+	//主动健康检查，使用grpc标准的健康检查协议，pick_first不支持
+	HealthCheck HealthCheckConfig
+	//被动的异常节点摘除，对所有负载均衡策略有效
+	OutlierDetection OutlierDetectionConfig
+
+	//客户端路由规则，按顺序匹配，如灰度5%的请求或者x-canary: 1的请求到version=v2的节点
+	Routes []GrpcRouteConfig
+}
+
+//GrpcRouteConfig 命中规则的请求只调用Meta匹配的节点，其他请求调用不匹配任何规则的节点
+//Headers和Percent都配置时需要同时满足
+type GrpcRouteConfig struct {
+	//请求头(grpc是metadata)全部匹配，如{"x-canary" = "1"}
+	Headers map[string]string
+	//命中的百分比，0-100，有x-hash-key时按key固定命中，0表示不按比例
+	Percent float64
+	//节点的元数据全部匹配，如{"version" = "v2"}
+	Meta map[string]string
+}
+
+//EtcdConfig 服务注册和发现共用，证书是相对路径则相对于程序目录
+type EtcdConfig struct {
+	Username string
+	Password string
+	//配置了CaFile则使用tls，CertFile和KeyFile用于双向认证
+	CaFile   string
+	CertFile string
+	KeyFile  string
+	//key的前缀，默认etcd3_naming，key是/Prefix/ServerName/ServiceId
+	Prefix string
+	//连接超时，单位秒，默认5
+	DialTimeout int64
+}
+
+//ConsulConfig 服务注册和发现共用，证书是相对路径则相对于程序目录
+type ConsulConfig struct {
+	//ACL token
+	Token string
+	//默认是agent所在的数据中心
+	Datacenter string
+	//企业版的namespace
+	Namespace string
+	//服务发现时，Datacenter没有可用节点则按顺序使用这些数据中心的节点
+	FailoverDatacenters []string
+	//配置了CaFile、CertFile或者InsecureSkipVerify则使用https，CertFile和KeyFile用于双向认证
+	CaFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+//K8sConfig ServerName是k8s的service名，也可以是service.namespace
+type K8sConfig struct {
+	//默认是pod所在的namespace
+	Namespace string
+	//使用的端口名，默认grpc，没有则使用第一个端口
+	PortName string
+	//使用EndpointSlice，默认使用Endpoints
+	EndpointSlices bool
+	//指定了ResolverAddresses时使用，默认使用pod里service account的ca和token，相对路径则相对于程序目录
+	CAFile             string
+	TokenFile          string
+	InsecureSkipVerify bool
+}
+
+//HealthCheckConfig 服务端需要注册grpc.health.v1.Health服务，hfw.RunGrpc会自动注册
+type HealthCheckConfig struct {
+	IsEnable bool
+	//检查的服务名，默认空，表示整个服务
+	ServiceName string
+}
+
+//OutlierDetectionConfig 异常节点摘除，不配置则使用默认值
+type OutlierDetectionConfig struct {
+	IsEnable bool
+	//连续失败(Unavailable、Internal、DataLoss、DeadlineExceeded)次数达到就摘除，默认5
+	ConsecutiveErrors int64
+	//检查的间隔，单位毫秒，默认10000
+	Interval int64
+	//摘除的时间，单位毫秒，每多摘除一次增加一倍BaseEjectionTime，最多MaxEjectionTime，默认30000和300000
+	BaseEjectionTime int64
+	MaxEjectionTime  int64
+	//最多摘除节点的百分比，默认10，至少可以摘除1个
+	MaxEjectionPercent int64
+	//平均耗时超过所有节点中位数的LatencyFactor倍则摘除，0表示不检查耗时
+	LatencyFactor float64
+	//一个间隔内请求数不少于MinRequests才检查耗时，默认10
+	MinRequests int64
+}
+
+//RetryConfig grpc调用的重试策略，不配置则使用默认值
+type RetryConfig struct {
+	//最大尝试次数，包含第一次，默认3，1表示不重试
+	MaxAttempts int
+	//重试的退避时间，单位毫秒，默认50和1000
+	InitialBackoff int64
+	MaxBackoff     int64
+	//退避的倍数，默认2
+	BackoffMultiplier float64
+	//退避时间的随机抖动比例，默认0.2
+	Jitter float64
+	//可重试的状态码，如Unavailable、ResourceExhausted，默认Unavailable
+	//非幂等的调用只重试Unavailable
+	//注意：以前所有的错误都会重试，现在不是grpc状态码的错误(按Unknown处理)默认不再重试
+	RetryableCodes []string
+	//单次尝试的超时，单位毫秒，0表示只受整体超时限制
+	PerAttemptTimeout int64
+	//是否幂等，幂等的调用才会重试单次尝试超时和对冲
+	Idempotent bool
+	//对冲，超过HedgingDelay毫秒没有返回，就并行发起新的请求，最多MaxAttempts个，需要Idempotent
+	Hedging      bool
+	HedgingDelay int64
+	//重试预算，按服务计算，失败一次减1，成功一次加BudgetTokenRatio，令牌少于一半时不重试
+	//BudgetMaxTokens为0表示不限制
+	BudgetMaxTokens  float64
+	BudgetTokenRatio float64
+}
+
+//BreakerConfig 熔断配置，不配置则使用默认值
+type BreakerConfig struct {
+	IsEnable bool
+	//按节点熔断，否则按服务熔断，grpc只支持按服务
+	PerEndpoint bool
+	//统计的窗口，单位秒，默认10
+	Window int64
+	//窗口内请求数不少于MinRequests，且错误率不低于ErrorRate(0-1)，则熔断，默认20和0.5
+	MinRequests int64
+	ErrorRate   float64
+	//连续失败次数达到则熔断，默认5
+	ConsecutiveFailures int64
+	//熔断后多久进入半开状态，单位毫秒，默认5000
+	OpenTimeout int64
+	//半开状态允许通过的请求数，都成功则恢复，默认1
+	HalfOpenRequests int64
 }
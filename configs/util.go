@@ -8,8 +8,8 @@ import (
 	"strings"
 
 	"github.com/BurntSushi/toml"
-	"github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/common"
+	logger "github.com/hsyan2008/hfw/logging"
 )
 
 func Load(config interface{}) (err error) {
@@ -127,6 +127,9 @@ func initDefaultConfig() error {
 	}
 	Config.Server.CertFile = certFile
 	Config.Server.KeyFile = keyFile
+	if len(Config.Server.CaFile) > 0 && !filepath.IsAbs(Config.Server.CaFile) {
+		Config.Server.CaFile = filepath.Join(common.GetAppPath(), Config.Server.CaFile)
+	}
 
 	//session
 	if Config.EnableSession {
@@ -11,8 +11,8 @@ import (
 	"strings"
 	"time"
 
-	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/common"
+	logger "github.com/hsyan2008/hfw/logging"
 	"github.com/hsyan2008/hfw/session"
 	"github.com/hsyan2008/hfw/signal"
 )
@@ -1,9 +1,14 @@
 package hfw
 
 import (
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/prometheus"
 	cron "github.com/robfig/cron/v3"
 )
 
@@ -14,8 +19,44 @@ func init() {
 	crontab.Start()
 }
 
+//cronJob 用于admin的/cron查看和控制
+type cronJob struct {
+	name   string
+	spec   string
+	cmd    func()
+	paused int32
+}
+
+var cronJobs = make(map[cron.EntryID]*cronJob)
+var cronLock = new(sync.Mutex)
+
 func AddCron(spec string, cmd func()) (cron.EntryID, error) {
-	return crontab.AddFunc(spec, cmd)
+	return addCron(spec, cronJobName(cmd), cmd)
+}
+
+func addCron(spec, name string, cmd func()) (cron.EntryID, error) {
+	job := &cronJob{name: name, spec: spec, cmd: cmd}
+	id, err := crontab.AddFunc(spec, func() {
+		if atomic.LoadInt32(&job.paused) == 1 {
+			return
+		}
+		cmd()
+	})
+	if err != nil {
+		return id, err
+	}
+	cronLock.Lock()
+	cronJobs[id] = job
+	cronLock.Unlock()
+	return id, nil
+}
+
+//RemoveCron 删除后不再执行，正在执行的不受影响
+func RemoveCron(id cron.EntryID) {
+	crontab.Remove(id)
+	cronLock.Lock()
+	delete(cronJobs, id)
+	cronLock.Unlock()
 }
 
 func StopCron() {
@@ -23,31 +64,51 @@ func StopCron() {
 }
 
 func AddWrapCron(spec string, cmd func(httpCtx *HTTPContext) error) (cron.EntryID, error) {
-	return AddCron(spec, WrapCron(cmd))
+	return addCron(spec, cronJobName(cmd), WrapCron(cmd))
 }
 
 func DoWrapCron(spec string, cmd func(httpCtx *HTTPContext) error) (cron.EntryID, error) {
 	f := WrapCron(cmd)
 	go f()
-	return AddCron(spec, f)
+	return addCron(spec, cronJobName(cmd), f)
 }
 
+//WrapCron 任务名是cmd的函数名，用于prometheus
 func WrapCron(cmd func(httpCtx *HTTPContext) error) func() {
+	job := cronJobName(cmd)
 	return func() {
 		httpCtx := NewHTTPContext()
 		defer httpCtx.Cancel()
+		result := "panic"
 		defer func(now time.Time) {
 			if err := recover(); err != nil {
 				if err != ErrStopRun {
 					httpCtx.Warn(err, string(common.GetStack()))
+				} else if httpCtx.ErrNo != 0 {
+					//ThrowCheck设置了ErrNo
+					result = "failure"
+				} else {
+					result = "success"
 				}
 			}
-			httpCtx.Infof("CostTime: %s", time.Since(now))
+			costTime := time.Since(now)
+			httpCtx.Infof("CostTime: %s", costTime)
+			prometheus.CronJob(job, result, costTime)
 		}(time.Now())
 
 		err := cmd(httpCtx)
 		if err != nil {
 			httpCtx.Warn(err)
+			result = "failure"
+		} else {
+			result = "success"
 		}
 	}
 }
+
+func cronJobName(cmd interface{}) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(cmd).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "unknown"
+}
@@ -0,0 +1,343 @@
+package curl
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	neturl "net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/prometheus"
+)
+
+//DefaultProfile 没有指定且host没有匹配时使用
+const DefaultProfile = "default"
+
+//profile 一个客户端配置，transport按keepAlive缓存，client再按autoRedirect缓存
+type profile struct {
+	name      string
+	conf      configs.CurlConfig
+	tlsConfig *tls.Config
+	proxy     *neturl.URL
+	dialer    *net.Dialer
+
+	open, dials, dialErrors, reused, notReused int64
+}
+
+var (
+	profileLock = new(sync.RWMutex)
+	profiles    map[string]*profile
+	transports  = make(map[string]*http.Transport)
+	clients     = make(map[string]*http.Client)
+)
+
+func init() {
+	_ = Init(nil)
+}
+
+//Init 设置客户端配置，没有default时使用默认值，旧的空闲连接会被关闭
+func Init(conf map[string]configs.CurlConfig) error {
+	m := make(map[string]*profile, len(conf)+1)
+	for name, c := range conf {
+		p, err := newProfile(name, c)
+		if err != nil {
+			return fmt.Errorf("curl %s: %v", name, err)
+		}
+		m[name] = p
+	}
+	if _, ok := m[DefaultProfile]; !ok {
+		m[DefaultProfile], _ = newProfile(DefaultProfile, configs.CurlConfig{})
+	}
+
+	profileLock.Lock()
+	oldProfiles, oldTransports := profiles, transports
+	profiles = m
+	transports = make(map[string]*http.Transport)
+	clients = make(map[string]*http.Client)
+	profileLock.Unlock()
+
+	for _, t := range oldTransports {
+		t.CloseIdleConnections()
+	}
+	for name := range oldProfiles {
+		prometheus.UnregisterCurlStats(name)
+	}
+	for name, p := range m {
+		prometheus.RegisterCurlStats(name, p.stats)
+	}
+
+	return nil
+}
+
+func newProfile(name string, c configs.CurlConfig) (p *profile, err error) {
+	if c.Timeout <= 0 {
+		c.Timeout = 5000
+	}
+	if c.MaxIdleConns <= 0 {
+		c.MaxIdleConns = 100
+	}
+	if c.MaxIdleConnsPerHost <= 0 {
+		c.MaxIdleConnsPerHost = 8
+	}
+	if c.IdleConnTimeout <= 0 {
+		c.IdleConnTimeout = 120000
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = 3000
+	}
+	if c.DialKeepAlive <= 0 {
+		c.DialKeepAlive = 30000
+	}
+	if c.TLSHandshakeTimeout <= 0 {
+		c.TLSHandshakeTimeout = 10000
+	}
+	if c.ExpectContinueTimeout <= 0 {
+		c.ExpectContinueTimeout = 1000
+	}
+
+	p = &profile{
+		name: name,
+		conf: c,
+		dialer: &net.Dialer{
+			Timeout:   ms(c.DialTimeout),
+			KeepAlive: ms(c.DialKeepAlive),
+		},
+	}
+	if p.tlsConfig, err = newTLSConfig(c); err != nil {
+		return nil, err
+	}
+	if c.Proxy != "" {
+		if p.proxy, err = neturl.Parse(c.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+func newTLSConfig(c configs.CurlConfig) (*tls.Config, error) {
+	conf := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		b, err := ioutil.ReadFile(appPath(c.CAFile))
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("no certificate found in " + c.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(appPath(c.CertFile), appPath(c.KeyFile))
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+func appPath(file string) string {
+	if file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(common.GetAppPath(), file)
+}
+
+func ms(t int64) time.Duration {
+	return time.Duration(t) * time.Millisecond
+}
+
+func (p *profile) stats() prometheus.CurlStats {
+	return prometheus.CurlStats{
+		OpenConnections: atomic.LoadInt64(&p.open),
+		Dials:           atomic.LoadInt64(&p.dials),
+		DialErrors:      atomic.LoadInt64(&p.dialErrors),
+		Reused:          atomic.LoadInt64(&p.reused),
+		NotReused:       atomic.LoadInt64(&p.notReused),
+	}
+}
+
+//dialContext 统计打开的连接数
+func (p *profile) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	atomic.AddInt64(&p.dials, 1)
+	conn, err := p.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		atomic.AddInt64(&p.dialErrors, 1)
+		return nil, err
+	}
+	atomic.AddInt64(&p.open, 1)
+	return &countConn{Conn: conn, p: p}, nil
+}
+
+type countConn struct {
+	net.Conn
+	p    *profile
+	once sync.Once
+}
+
+func (c *countConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.p.open, -1)
+	})
+	return c.Conn.Close()
+}
+
+//withTrace 统计连接是否复用
+func (p *profile) withTrace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&p.reused, 1)
+			} else {
+				atomic.AddInt64(&p.notReused, 1)
+			}
+		},
+	})
+}
+
+//matchHost 支持*.example.com，返回匹配的长度，完全相同的优先，其次是最长的通配，0表示不匹配
+func matchHost(patterns []string, host string) (n int) {
+	for _, v := range patterns {
+		if v == host {
+			return math.MaxInt32
+		}
+		if strings.HasPrefix(v, "*.") && strings.HasSuffix(host, v[1:]) && len(v) > n {
+			n = len(v)
+		}
+	}
+	return
+}
+
+//getProfile SetProfile优先，其次按host匹配，最后是default
+func (curls *Curl) getProfile() (*profile, error) {
+	profileLock.RLock()
+	defer profileLock.RUnlock()
+	if curls.profile != "" {
+		p, ok := profiles[curls.profile]
+		if !ok {
+			return nil, fmt.Errorf("curl profile not found: %s", curls.profile)
+		}
+		return p, nil
+	}
+	if u, err := neturl.Parse(curls.Url); err == nil {
+		host := u.Hostname()
+		//map是无序的，多个匹配时取最长的，长度相同按名字，保证结果固定
+		var matched *profile
+		var max int
+		for name, p := range profiles {
+			if name == DefaultProfile {
+				continue
+			}
+			if n := matchHost(p.conf.Hosts, host); n > max || (n > 0 && n == max && name < matched.name) {
+				matched, max = p, n
+			}
+		}
+		if matched != nil {
+			return matched, nil
+		}
+	}
+	return profiles[DefaultProfile], nil
+}
+
+func (curls *Curl) getHttpClient(p *profile) (hc *http.Client, err error) {
+	keepAlive := curls.keepAlive || p.conf.KeepAlive
+	if curls.proxyURL != "" {
+		proxy, err := neturl.Parse(curls.proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		//请求里指定的代理不缓存，轮换代理时会一直增加，不使用长连接，请求结束后连接关闭
+		if proxy.Host != "" && (p.proxy == nil || proxy.String() != p.proxy.String()) {
+			return withJar(newClient(p.newTransport(false, proxy), curls.autoRedirect), curls.jar), nil
+		}
+	}
+	tKey := fmt.Sprintf("%s||%t", p.name, keepAlive)
+	key := fmt.Sprintf("%s||%t", tKey, curls.autoRedirect)
+
+	profileLock.RLock()
+	hc, ok := clients[key]
+	profileLock.RUnlock()
+	if ok {
+		return withJar(hc, curls.jar), nil
+	}
+
+	profileLock.Lock()
+	defer profileLock.Unlock()
+	if hc, ok = clients[key]; ok {
+		return withJar(hc, curls.jar), nil
+	}
+	t, ok := transports[tKey]
+	if !ok {
+		t = p.newTransport(keepAlive, p.proxy)
+	}
+	hc = newClient(t, curls.autoRedirect)
+	//Init之后旧的配置不再缓存
+	if profiles[p.name] == p {
+		transports[tKey] = t
+		clients[key] = hc
+	}
+
+	return withJar(hc, curls.jar), nil
+}
+
+func newClient(t *http.Transport, autoRedirect bool) *http.Client {
+	return &http.Client{
+		Transport: t,
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			if autoRedirect {
+				return nil
+			}
+			return ErrStopRedirect
+		},
+	}
+}
+
+//withJar 缓存的client不带jar，有jar时复制一份，共用连接池
+func withJar(hc *http.Client, jar http.CookieJar) *http.Client {
+	if jar == nil {
+		return hc
+	}
+	c := *hc
+	c.Jar = jar
+	return &c
+}
+
+func (p *profile) newTransport(keepAlive bool, proxy *neturl.URL) *http.Transport {
+	c := p.conf
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           p.dialContext,
+		TLSClientConfig:       p.tlsConfig,
+		DisableKeepAlives:     !keepAlive,
+		TLSHandshakeTimeout:   ms(c.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: ms(c.ResponseHeaderTimeout),
+		ForceAttemptHTTP2:     !c.DisableHTTP2,
+		MaxIdleConns:          c.MaxIdleConns,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+		IdleConnTimeout:       ms(c.IdleConnTimeout),
+		ExpectContinueTimeout: ms(c.ExpectContinueTimeout),
+	}
+	if proxy != nil {
+		t.Proxy = http.ProxyURL(proxy)
+	}
+	return t
+}
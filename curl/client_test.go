@@ -0,0 +1,174 @@
+package curl
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestProfileTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	defer func() { _ = Init(nil) }()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := neturl.Parse(ts.URL)
+	err := Init(map[string]configs.CurlConfig{
+		"insecure": {InsecureSkipVerify: true},
+		"ca":       {CAFile: caFile, Hosts: []string{u.Hostname()}, KeepAlive: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(profile string) error {
+		c := NewGet(context.Background(), ts.URL)
+		c.SetProfile(profile)
+		rs, err := c.Request()
+		if err == nil {
+			rs.Close()
+		}
+		return err
+	}
+	//默认校验证书
+	if err := get(DefaultProfile); err == nil {
+		t.Fatal("default profile should verify certificate")
+	}
+	if err := get("insecure"); err != nil {
+		t.Fatal(err)
+	}
+	//按host匹配到ca
+	if err := get(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := get("xxx"); err == nil {
+		t.Fatal("unknown profile should fail")
+	}
+
+	c := NewGet(context.Background(), ts.URL)
+	p, err := c.getProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.name != "ca" {
+		t.Fatalf("profile = %s, want ca", p.name)
+	}
+	hc1, _ := c.getHttpClient(p)
+	hc2, _ := c.getHttpClient(p)
+	if hc1 != hc2 {
+		t.Fatal("client should be cached")
+	}
+	if s := p.stats(); s.Dials == 0 || s.OpenConnections == 0 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	patterns := []string{"api.example.com", "*.test.com"}
+	for host, want := range map[string]bool{
+		"api.example.com": true,
+		"www.example.com": false,
+		"a.test.com":      true,
+		"test.com":        false,
+	} {
+		if got := matchHost(patterns, host) > 0; got != want {
+			t.Errorf("matchHost(%s) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestProfileOverlap(t *testing.T) {
+	defer func() { _ = Init(nil) }()
+	err := Init(map[string]configs.CurlConfig{
+		"wildcard": {Hosts: []string{"*.example.com"}},
+		"sub":      {Hosts: []string{"*.api.example.com"}},
+		"exact":    {Hosts: []string{"api.example.com"}},
+		"a":        {Hosts: []string{"*.test.com"}},
+		"b":        {Hosts: []string{"*.test.com"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for url, want := range map[string]string{
+		"http://api.example.com/":   "exact",
+		"http://v1.api.example.com": "sub",
+		"http://www.example.com":    "wildcard",
+		"http://a.test.com":         "a",
+		"http://other.com":          DefaultProfile,
+	} {
+		//map的遍历顺序是随机的，多次验证
+		for i := 0; i < 20; i++ {
+			p, err := NewGet(context.Background(), url).getProfile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.name != want {
+				t.Fatalf("%s: profile = %s, want %s", url, p.name, want)
+			}
+		}
+	}
+}
+
+func TestProxyNotCached(t *testing.T) {
+	//作为http代理，收到的是完整的url
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("proxy:" + r.URL.Host))
+	}))
+	defer proxy.Close()
+	defer func() { _ = Init(nil) }()
+	_ = Init(nil)
+
+	for i := 0; i < 3; i++ {
+		c := NewGet(context.Background(), "http://example.invalid/")
+		//每次不同的代理地址
+		c.SetProxy(proxy.URL + "/?" + string(rune('a'+i)))
+		rs, err := c.Request()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(rs.Body)
+		rs.Close()
+		if string(b) != "proxy:example.invalid" {
+			t.Fatalf("unexpected body %s", b)
+		}
+	}
+	profileLock.RLock()
+	defer profileLock.RUnlock()
+	if len(transports) != 0 || len(clients) != 0 {
+		t.Fatalf("per request proxy should not be cached: %d transports, %d clients", len(transports), len(clients))
+	}
+}
+
+func TestFallbackCanceled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	//调用方取消的不调用fallback
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	c := NewGet(ctx, ts.URL)
+	c.SetFallback(func(err error) (*Response, error) {
+		called = true
+		return nil, err
+	})
+	if _, err := c.Request(); !errors.Is(err, context.Canceled) || called {
+		t.Fatalf("want canceled without fallback, got %v %v", err, called)
+	}
+}
@@ -5,19 +5,18 @@ import (
 	"compress/flate"
 	"compress/gzip"
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"mime/multipart"
-	"net"
 	"net/http"
 	neturl "net/url"
-	"os"
 	"strings"
-	"sync"
 	"time"
+
+	"github.com/hsyan2008/hfw/accesslog"
+	"github.com/hsyan2008/hfw/breaker"
+	"github.com/hsyan2008/hfw/trace"
 )
 
 type Response struct {
@@ -29,6 +28,14 @@ type Response struct {
 
 func (response *Response) wrap(curls *Curl) (err error) {
 	response.cancel = curls.cancel
+	//在解压之前，和Content-Length一致
+	if curls.downloadProgress != nil && response.Response != nil && response.Response.Body != nil {
+		response.Response.Body = &progressReader{
+			ReadCloser: response.Response.Body,
+			f:          curls.downloadProgress,
+			total:      response.Response.ContentLength,
+		}
+	}
 	response.Body, err = response.getReader()
 	if err != nil {
 		response.Body = nil
@@ -52,8 +59,14 @@ func (response *Response) getReader() (r io.ReadCloser, err error) {
 	return response.Response.Body, nil
 }
 
+//Close 先读完body再cancel，否则连接不能复用
 func (response *Response) Close() {
-	response.cancel()
+	if response.cancel != nil {
+		defer response.cancel()
+	}
+	if response.Response == nil {
+		return
+	}
 	if response.Body != nil && response.Response.Body != nil {
 		io.Copy(ioutil.Discard, response.Body)
 		response.Body.Close()
@@ -95,6 +108,18 @@ type Curl struct {
 	cancel context.CancelFunc
 
 	proxyURL string
+	//客户端配置的名字，见configs.CurlConfig
+	profile string
+	jar     http.CookieJar
+
+	postFiles []*PostFile
+	//PostReader的长度，小于等于0表示未知
+	postReaderSize   int64
+	uploadProgress   Progress
+	downloadProgress Progress
+
+	breaker  *breaker.Breaker
+	fallback func(error) (*Response, error)
 }
 
 func New(ctx context.Context, method string, url string) (curls *Curl) {
@@ -169,11 +194,27 @@ func (curls *Curl) SetProxy(proxyURL string) {
 	curls.proxyURL = proxyURL
 }
 
+//SetJar 保存响应的cookie，后续请求自动带上，见NewJar和Session
+func (curls *Curl) SetJar(jar http.CookieJar) {
+	curls.jar = jar
+}
+
+//SetProfile 使用指定的客户端配置，默认按host匹配
+func (curls *Curl) SetProfile(name string) {
+	curls.profile = name
+}
+
 //以字节流的方式
 func (curls *Curl) SetPostReader(r io.Reader) {
 	curls.PostReader = r
 }
 
+//SetPostReaderSize 已知长度的流，用于设置Content-Length
+func (curls *Curl) SetPostReaderSize(r io.Reader, size int64) {
+	curls.PostReader = r
+	curls.postReaderSize = size
+}
+
 //以字节的方式
 func (curls *Curl) SetPostBytes(b []byte) {
 	curls.PostBytes = b
@@ -199,28 +240,79 @@ func (curls *Curl) SetPostFile(key, path string) {
 	curls.PostFiles.Add(key, path)
 }
 
+//SetBreaker 请求失败或者返回5xx都算失败
+func (curls *Curl) SetBreaker(b *breaker.Breaker) {
+	curls.breaker = b
+}
+
+//SetFallback 熔断或者请求失败时调用，可以返回默认的Response
+func (curls *Curl) SetFallback(f func(error) (*Response, error)) {
+	curls.fallback = f
+}
+
 func (curls *Curl) Request() (rs *Response, err error) {
+	if curls.breaker == nil {
+		rs, err = curls.request()
+	} else {
+		var done func(bool)
+		done, err = curls.breaker.Allow()
+		if err == nil {
+			rs, err = curls.request()
+			//调用方取消的不算失败
+			done((err == nil && rs.StatusCode < http.StatusInternalServerError) || errors.Is(err, context.Canceled))
+		}
+	}
+	if err != nil && curls.fallback != nil && !errors.Is(err, context.Canceled) {
+		return curls.fallback(err)
+	}
+
+	return
+}
 
+func (curls *Curl) request() (rs *Response, err error) {
+
+	p, err := curls.getProfile()
+	if err != nil {
+		return
+	}
 	if curls.timeout <= 0 {
-		curls.SetTimeout(5)
+		curls.SetTimeoutMS(int(p.conf.Timeout))
 	}
 
 	rs = &Response{
 		// cancel: curls.cancel,
 	}
 
-	httpRequest, err := curls.CreateRequest()
+	//先创建client，否则出错返回时body没有关闭，写multipart的goroutine会一直阻塞
+	httpClient, err := curls.getHttpClient(p)
 	if err != nil {
 		return
 	}
 
-	httpRequest = httpRequest.WithContext(curls.ctx)
-
-	httpClient, err := curls.getHttpClient()
+	httpRequest, err := curls.CreateRequest()
 	if err != nil {
 		return
 	}
 
+	httpRequest = httpRequest.WithContext(p.withTrace(curls.ctx))
+	accesslog.AddUpstream(curls.ctx)
+
+	//ctx里有span时作为子span，并通过traceparent传递给下游
+	spanCtx, span := trace.Start(curls.ctx, "HTTP "+httpRequest.Method, trace.SpanKindClient)
+	span.SetAttribute("http.method", httpRequest.Method)
+	span.SetAttribute("http.url", curls.Url)
+	defer func() {
+		if err == nil && rs.Response != nil {
+			span.SetAttribute("http.status_code", rs.StatusCode)
+			if rs.StatusCode >= http.StatusInternalServerError {
+				span.SetError(fmt.Errorf("StatusCode:%d", rs.StatusCode))
+			}
+		}
+		span.SetError(err)
+		span.End()
+	}()
+	trace.Inject(spanCtx, httpRequest.Header.Set)
+
 	c := make(chan struct{}, 1)
 	go func() {
 		rs.Response, err = httpClient.Do(httpRequest)
@@ -259,7 +351,7 @@ func (curls *Curl) Request() (rs *Response, err error) {
 func (curls *Curl) CreateRequest() (httpRequest *http.Request, err error) {
 	if curls.PostReader != nil || len(curls.PostBytes) > 0 ||
 		curls.PostString != "" || len(curls.PostFields) > 0 ||
-		len(curls.PostFieldReaders) > 0 || len(curls.PostFiles) > 0 {
+		len(curls.PostFieldReaders) > 0 || len(curls.PostFiles) > 0 || len(curls.postFiles) > 0 {
 		httpRequest, err = curls.createPostRequest()
 	} else {
 		httpRequest, err = http.NewRequest(curls.method, curls.Url, nil)
@@ -280,118 +372,46 @@ func (curls *Curl) CreateRequest() (httpRequest *http.Request, err error) {
 }
 
 func (curls *Curl) createPostRequest() (httpRequest *http.Request, err error) {
+	length := curls.postReaderSize
 	if curls.PostReader != nil {
-		// httpRequest, err = http.NewRequest(curls.method, curls.Url, curls.PostReader)
+		if length <= 0 {
+			length = readerSize(curls.PostReader)
+		}
 	} else if len(curls.PostBytes) > 0 {
 		curls.PostReader = bytes.NewReader(curls.PostBytes)
+		length = int64(len(curls.PostBytes))
 	} else if len(curls.PostString) > 0 {
 		curls.PostReader = strings.NewReader(curls.PostString)
-	} else if len(curls.PostFields) > 0 || len(curls.PostFieldReaders) > 0 || len(curls.PostFiles) > 0 {
-		var b = &bytes.Buffer{}
-		bodyWriter := multipart.NewWriter(b)
-
-		for key, val := range curls.PostFields {
-			for _, v := range val {
-				_ = bodyWriter.WriteField(key, v)
-			}
-		}
-		for key, val := range curls.PostFieldReaders {
-			fileWriter, err := bodyWriter.CreateFormField(key)
-			_, err = io.Copy(fileWriter, val)
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		//文件
-		for key, val := range curls.PostFiles {
-			for _, v := range val {
-				fileWriter, err := bodyWriter.CreateFormFile(key, v)
-				if err != nil {
-					return nil, err
-				}
-
-				fh, err := os.Open(v)
-				if err != nil {
-					return nil, err
-				}
-
-				_, err = io.Copy(fileWriter, fh)
-				fh.Close()
-				if err != nil {
-					return nil, err
-				}
-			}
-		}
-		//必须在这里，不能defer
-		err = bodyWriter.Close()
+		length = int64(len(curls.PostString))
+	} else if len(curls.PostFields) > 0 || len(curls.PostFieldReaders) > 0 ||
+		len(curls.PostFiles) > 0 || len(curls.postFiles) > 0 {
+		//边读边发，不在内存里缓存整个body
+		var contentType string
+		curls.PostReader, contentType, length, err = curls.multipartBody()
 		if err != nil {
 			return
 		}
-		curls.Headers.Set("Content-Type", bodyWriter.FormDataContentType())
-		curls.PostReader = b
+		curls.Headers.Set("Content-Type", contentType)
 	}
 
-	return http.NewRequest(curls.method, curls.Url, curls.PostReader)
-}
-
-var clientMap = new(sync.Map)
-var tlsConfig = &tls.Config{InsecureSkipVerify: true}
-var dialer = &net.Dialer{
-	Timeout:   3 * time.Second,
-	KeepAlive: 30 * time.Second,
-}
-
-func (curls *Curl) getHttpClient() (hc *http.Client, err error) {
-
-	proxy := http.ProxyFromEnvironment
-	var key string
-	if curls.proxyURL == "" {
-		key = fmt.Sprintf("%t||%t", curls.keepAlive, curls.autoRedirect)
-		if i, ok := clientMap.Load(key); ok {
-			hc = i.(*http.Client)
-			// hc.CloseIdleConnections()
-			return
-		}
-		defer func() {
-			clientMap.Store(key, hc)
-		}()
-	} else {
-		urlParse, err := neturl.Parse(curls.proxyURL)
-		if err != nil {
-			return nil, err
-		}
-		if urlParse != nil && urlParse.Host != "" {
-			proxy = http.ProxyURL(urlParse)
+	httpRequest, err = http.NewRequest(curls.method, curls.Url, curls.PostReader)
+	if err != nil {
+		//结束写multipart的goroutine
+		if pr, ok := curls.PostReader.(*io.PipeReader); ok {
+			pr.Close()
 		}
+		return
 	}
-
-	hc = &http.Client{
-		Transport: &http.Transport{
-			Proxy:               proxy,
-			Dial:                dialer.Dial,
-			TLSClientConfig:     tlsConfig,
-			DisableKeepAlives:   curls.keepAlive == false,
-			TLSHandshakeTimeout: 10 * time.Second,
-			// ResponseHeaderTimeout: 1 * time.Second,
-
-			ForceAttemptHTTP2: true,
-
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 8,
-			IdleConnTimeout:     120 * time.Second,
-
-			ExpectContinueTimeout: 1 * time.Second,
-		},
-		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
-			if curls.autoRedirect {
-				return nil
-			}
-			return ErrStopRedirect
-		},
-		Jar:     nil,
-		Timeout: 0,
+	if length > 0 {
+		httpRequest.ContentLength = length
+	}
+	if curls.uploadProgress != nil && httpRequest.Body != nil && httpRequest.Body != http.NoBody {
+		total := httpRequest.ContentLength
+		if total <= 0 {
+			total = -1
+		}
+		httpRequest.Body = &progressReader{ReadCloser: httpRequest.Body, f: curls.uploadProgress, total: total}
 	}
 
-	return hc, nil
+	return
 }
@@ -0,0 +1,196 @@
+package curl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/redis"
+	radix "github.com/mediocregopher/radix/v3"
+	"golang.org/x/net/publicsuffix"
+)
+
+//CookieEntry 持久化的cookie，URL是设置cookie时的地址
+type CookieEntry struct {
+	URL    string
+	Cookie *http.Cookie
+}
+
+//CookieStore 保存和加载cookie，每次有cookie变化时Save全部
+type CookieStore interface {
+	Load() ([]*CookieEntry, error)
+	Save([]*CookieEntry) error
+}
+
+//Jar 使用公共后缀列表匹配域名的cookie jar，有store时持久化
+type Jar struct {
+	lock    sync.Mutex
+	jar     *cookiejar.Jar
+	store   CookieStore
+	entries map[string]*CookieEntry
+}
+
+//NewJar 只保存在内存
+func NewJar() *Jar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &Jar{jar: jar, entries: make(map[string]*CookieEntry)}
+}
+
+//NewPersistentJar 从store加载，过期的cookie会被丢弃
+func NewPersistentJar(store CookieStore) (*Jar, error) {
+	j := NewJar()
+	j.store = store
+	list, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, e := range list {
+		if e.Cookie == nil || (!e.Cookie.Expires.IsZero() && e.Cookie.Expires.Before(now)) {
+			continue
+		}
+		u, err := neturl.Parse(e.URL)
+		if err != nil {
+			continue
+		}
+		j.jar.SetCookies(u, []*http.Cookie{e.Cookie})
+		j.entries[entryKey(u, e.Cookie)] = e
+	}
+	return j, nil
+}
+
+//NewFileJar 保存到json文件
+func NewFileJar(file string) (*Jar, error) {
+	return NewPersistentJar(&FileCookieStore{File: file})
+}
+
+//NewRedisJar 保存到redis的key，expiration是过期时间，单位秒，0表示不过期
+func NewRedisJar(c *redis.Client, key string, expiration int64) (*Jar, error) {
+	return NewPersistentJar(&RedisCookieStore{Client: c, Key: key, Expiration: expiration})
+}
+
+func (j *Jar) Cookies(u *neturl.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+func (j *Jar) SetCookies(u *neturl.URL, cookies []*http.Cookie) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.jar.SetCookies(u, cookies)
+	if j.store == nil {
+		return
+	}
+
+	now := time.Now()
+	origin := &neturl.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}
+	for _, c := range cookies {
+		key := entryKey(u, c)
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			delete(j.entries, key)
+			continue
+		}
+		cc := *c
+		//MaxAge是相对时间，转为Expires
+		if cc.MaxAge > 0 {
+			cc.Expires = now.Add(time.Duration(cc.MaxAge) * time.Second)
+			cc.MaxAge = 0
+		}
+		j.entries[key] = &CookieEntry{URL: origin.String(), Cookie: &cc}
+	}
+
+	list := make([]*CookieEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		list = append(list, e)
+	}
+	if err := j.store.Save(list); err != nil {
+		logger.Warn("save cookie error:", err)
+	}
+}
+
+//entryKey 同一个域名、路径和名字的cookie会覆盖
+func entryKey(u *neturl.URL, c *http.Cookie) string {
+	domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+	if domain == "" {
+		domain = u.Hostname()
+	}
+	p := c.Path
+	if p == "" || p[0] != '/' {
+		p = path.Dir(u.Path)
+		if p == "." || p == "" {
+			p = "/"
+		}
+	}
+	return domain + ";" + p + ";" + c.Name
+}
+
+//FileCookieStore 保存到json文件，相对路径则相对于程序目录
+type FileCookieStore struct {
+	File string
+}
+
+func (s *FileCookieStore) Load() (list []*CookieEntry, err error) {
+	b, err := ioutil.ReadFile(appPath(s.File))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &list)
+	return
+}
+
+//Save 先写临时文件再改名，避免写了一半
+func (s *FileCookieStore) Save(list []*CookieEntry) error {
+	b, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	file := appPath(s.File)
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+//RedisCookieStore 以json保存在一个key里，多个进程可以共用
+type RedisCookieStore struct {
+	Client *redis.Client
+	Key    string
+	//单位秒，0表示不过期
+	Expiration int64
+}
+
+func (s *RedisCookieStore) Load() (list []*CookieEntry, err error) {
+	var b []byte
+	mn := radix.MaybeNil{Rcv: &b}
+	if err = s.Client.Do(radix.Cmd(&mn, "GET", s.Client.AddPrefix(s.Key))); err != nil || mn.Nil {
+		return
+	}
+	err = json.Unmarshal(b, &list)
+	return
+}
+
+func (s *RedisCookieStore) Save(list []*CookieEntry) error {
+	b, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	if s.Expiration > 0 {
+		return s.Client.Do(radix.FlatCmd(nil, "SET", s.Client.AddPrefix(s.Key), b, "EX", s.Expiration))
+	}
+	return s.Client.Do(radix.FlatCmd(nil, "SET", s.Client.AddPrefix(s.Key), b))
+}
@@ -0,0 +1,90 @@
+package curl
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestJarPublicSuffix(t *testing.T) {
+	j := NewJar()
+	u, _ := neturl.Parse("http://a.example.co.uk/")
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "ok", Value: "1", Domain: "example.co.uk"},
+		//公共后缀不能设置
+		{Name: "bad", Value: "1", Domain: "co.uk"},
+	})
+	other, _ := neturl.Parse("http://b.example.co.uk/")
+	if cookies := j.Cookies(other); len(cookies) != 1 || cookies[0].Name != "ok" {
+		t.Fatalf("unexpected cookies: %v", cookies)
+	}
+	evil, _ := neturl.Parse("http://evil.co.uk/")
+	if cookies := j.Cookies(evil); len(cookies) != 0 {
+		t.Fatalf("cookie leaked to public suffix: %v", cookies)
+	}
+}
+
+func TestSessionFileJar(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "abc", Path: "/", MaxAge: 3600})
+			http.SetCookie(w, &http.Cookie{Name: "tmp", Value: "1", Path: "/"})
+			http.Redirect(w, r, "/me", http.StatusFound)
+		case "/logout":
+			http.SetCookie(w, &http.Cookie{Name: "tmp", Path: "/", MaxAge: -1})
+		case "/me":
+			c, err := r.Cookie("sid")
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(c.Value))
+		}
+	}))
+	defer ts.Close()
+
+	file := filepath.Join(t.TempDir(), "cookies.json")
+	get := func(s *Session, path string) (int, string) {
+		c := s.NewGet(context.Background(), ts.URL+path)
+		c.SetAutoRedirect()
+		rs, err := c.Request()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Close()
+		b, _ := ioutil.ReadAll(rs.Body)
+		return rs.StatusCode, string(b)
+	}
+
+	jar, err := NewFileJar(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession(jar)
+	if code, body := get(s, "/login"); code != http.StatusOK || body != "abc" {
+		t.Fatalf("login: %d %s", code, body)
+	}
+	get(s, "/logout")
+
+	//重新加载后仍然是登录状态
+	jar, err = NewFileJar(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := neturl.Parse(ts.URL)
+	cookies := jar.Cookies(u)
+	if len(cookies) != 1 || cookies[0].Name != "sid" {
+		t.Fatalf("unexpected cookies: %v", cookies)
+	}
+	if code, body := get(NewSession(jar), "/me"); code != http.StatusOK || body != "abc" {
+		t.Fatalf("me: %d %s", code, body)
+	}
+	if code, _ := get(NewSession(nil), "/me"); code != http.StatusUnauthorized {
+		t.Fatalf("new session should not be logged in, got %d", code)
+	}
+}
@@ -0,0 +1,224 @@
+package curl
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//PostFile 上传的文件，Path和Reader二选一
+type PostFile struct {
+	//表单的字段名
+	Field string
+	Path  string
+	//Reader没有Len方法时需要设置Size，否则不能计算Content-Length，使用chunked
+	Reader io.Reader
+	Size   int64
+	//默认是Path的文件名
+	FileName string
+	//默认是application/octet-stream
+	ContentType string
+}
+
+//AddPostFile 自定义文件名和类型的上传，可以和SetPostFile共同使用
+func (curls *Curl) AddPostFile(f *PostFile) {
+	curls.postFiles = append(curls.postFiles, f)
+}
+
+//part multipart的一部分，size小于0表示未知
+type part struct {
+	header textproto.MIMEHeader
+	open   func() (io.ReadCloser, error)
+	size   int64
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func formDataHeader(field, fileName, contentType string) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	if fileName == "" {
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(field)))
+		return h
+	}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(field), quoteEscaper.Replace(fileName)))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	return h
+}
+
+//readerSize 返回-1表示未知
+func readerSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len())
+	case *io.SectionReader:
+		return v.Size()
+	case *os.File:
+		if fi, err := v.Stat(); err == nil && fi.Mode().IsRegular() {
+			if pos, err := v.Seek(0, io.SeekCurrent); err == nil {
+				return fi.Size() - pos
+			}
+		}
+	}
+	return -1
+}
+
+func (curls *Curl) parts() (parts []part, err error) {
+	for key, val := range curls.PostFields {
+		for _, v := range val {
+			v := v
+			parts = append(parts, part{
+				header: formDataHeader(key, "", ""),
+				open:   func() (io.ReadCloser, error) { return ioutil.NopCloser(strings.NewReader(v)), nil },
+				size:   int64(len(v)),
+			})
+		}
+	}
+	for key, val := range curls.PostFieldReaders {
+		r := val
+		parts = append(parts, part{
+			header: formDataHeader(key, "", ""),
+			open:   func() (io.ReadCloser, error) { return ioutil.NopCloser(r), nil },
+			size:   readerSize(r),
+		})
+	}
+
+	files := make([]*PostFile, 0, len(curls.PostFiles)+len(curls.postFiles))
+	for key, val := range curls.PostFiles {
+		for _, v := range val {
+			files = append(files, &PostFile{Field: key, Path: v})
+		}
+	}
+	files = append(files, curls.postFiles...)
+	for _, f := range files {
+		p := part{size: -1}
+		name := f.FileName
+		if f.Reader != nil {
+			r := f.Reader
+			p.open = func() (io.ReadCloser, error) { return ioutil.NopCloser(r), nil }
+			if p.size = readerSize(r); p.size < 0 && f.Size > 0 {
+				p.size = f.Size
+			}
+		} else {
+			//提前检查文件，错误时不发送请求
+			fi, err := os.Stat(f.Path)
+			if err != nil {
+				return nil, err
+			}
+			path := f.Path
+			p.open = func() (io.ReadCloser, error) { return os.Open(path) }
+			p.size = fi.Size()
+			if name == "" {
+				name = filepath.Base(f.Path)
+			}
+		}
+		if name == "" {
+			name = f.Field
+		}
+		p.header = formDataHeader(f.Field, name, f.ContentType)
+		parts = append(parts, p)
+	}
+
+	return parts, nil
+}
+
+//multipartBody 通过io.Pipe边读边发，所有部分的大小都已知时返回Content-Length，否则是-1
+func (curls *Curl) multipartBody() (body io.Reader, contentType string, length int64, err error) {
+	parts, err := curls.parts()
+	if err != nil {
+		return
+	}
+
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	contentType = w.FormDataContentType()
+	length = multipartLength(w.Boundary(), parts)
+
+	go func() {
+		var err error
+		defer func() {
+			pw.CloseWithError(err)
+		}()
+		for _, p := range parts {
+			var partWriter io.Writer
+			if partWriter, err = w.CreatePart(p.header); err != nil {
+				return
+			}
+			var r io.ReadCloser
+			if r, err = p.open(); err != nil {
+				return
+			}
+			_, err = io.Copy(partWriter, r)
+			r.Close()
+			if err != nil {
+				return
+			}
+		}
+		err = w.Close()
+	}()
+
+	return pr, contentType, length, nil
+}
+
+//multipartLength 用相同的boundary写一遍header计算长度
+func multipartLength(boundary string, parts []part) int64 {
+	var c countWriter
+	w := multipart.NewWriter(&c)
+	_ = w.SetBoundary(boundary)
+	var size int64
+	for _, p := range parts {
+		if p.size < 0 {
+			return -1
+		}
+		_, _ = w.CreatePart(p.header)
+		size += p.size
+	}
+	_ = w.Close()
+	return c.n + size
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+//Progress 上传或者下载的进度，total小于0表示未知
+type Progress func(done, total int64)
+
+//SetUploadProgress 发送body时回调
+func (curls *Curl) SetUploadProgress(f Progress) {
+	curls.uploadProgress = f
+}
+
+//SetDownloadProgress 读取响应的body时回调，total是Content-Length
+func (curls *Curl) SetDownloadProgress(f Progress) {
+	curls.downloadProgress = f
+}
+
+type progressReader struct {
+	io.ReadCloser
+	f     Progress
+	done  int64
+	total int64
+}
+
+func (r *progressReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	if n > 0 {
+		r.done += int64(n)
+		r.f(r.done, r.total)
+	}
+	return
+}
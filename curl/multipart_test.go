@@ -0,0 +1,178 @@
+package curl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMultipartStream(t *testing.T) {
+	var lengths []int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lengths = append(lengths, r.ContentLength)
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f, h, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		b, _ := ioutil.ReadAll(f)
+		fmt.Fprintf(w, "%s|%s|%s|%s", r.FormValue("name"), h.Filename, h.Header.Get("Content-Type"), b)
+	}))
+	defer ts.Close()
+
+	file := filepath.Join(t.TempDir(), "a.txt")
+	if err := ioutil.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		f      *PostFile
+		expect string
+		known  bool
+	}{
+		{&PostFile{Field: "file", Path: file}, "x|a.txt|application/octet-stream|hello", true},
+		{&PostFile{Field: "file", Reader: strings.NewReader("abc"), FileName: "b.csv", ContentType: "text/csv"}, "x|b.csv|text/csv|abc", true},
+		//没有Len方法，使用chunked
+		{&PostFile{Field: "file", Reader: ioutil.NopCloser(strings.NewReader("abc")), FileName: "c"}, "x|c|application/octet-stream|abc", false},
+	}
+	for i, c := range cases {
+		var mu sync.Mutex
+		var done, total int64
+		curls := NewPost(context.Background(), ts.URL)
+		curls.SetPostField("name", "x")
+		curls.AddPostFile(c.f)
+		curls.SetUploadProgress(func(d, t int64) {
+			mu.Lock()
+			done, total = d, t
+			mu.Unlock()
+		})
+		rs, err := curls.Request()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(rs.Body)
+		rs.Close()
+		if string(b) != c.expect {
+			t.Fatalf("case %d: unexpected body %q", i, b)
+		}
+		if (lengths[i] > 0) != c.known {
+			t.Fatalf("case %d: unexpected Content-Length %d", i, lengths[i])
+		}
+		mu.Lock()
+		if done == 0 || (c.known && (done != lengths[i] || total != lengths[i])) || (!c.known && total != -1) {
+			t.Fatalf("case %d: unexpected progress %d/%d, Content-Length %d", i, done, total, lengths[i])
+		}
+		mu.Unlock()
+	}
+}
+
+func TestDownloadProgress(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 10000)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		_, _ = w.Write(body)
+	}))
+	defer ts.Close()
+
+	var done, total int64
+	curls := NewGet(context.Background(), ts.URL)
+	curls.SetDownloadProgress(func(d, t int64) {
+		done, total = d, t
+	})
+	rs, err := curls.Request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	_, _ = ioutil.ReadAll(rs.Body)
+	if done != int64(len(body)) || total != int64(len(body)) {
+		t.Fatalf("unexpected progress %d/%d", done, total)
+	}
+}
+
+func TestChunkUpload(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	//服务端已经有前4个字节
+	received := append([]byte(nil), content[:4]...)
+	var ranges []string
+	failed := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		//第一次失败，测试重试
+		if !failed {
+			failed = true
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		contentRange := r.Header.Get("Content-Range")
+		ranges = append(ranges, contentRange)
+		if !strings.HasPrefix(contentRange, fmt.Sprintf("bytes %d-", len(received))) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		//每次最多只保存6个字节
+		if len(b) > 6 {
+			b = b[:6]
+		}
+		received = append(received, b...)
+		if len(received) == len(content) {
+			return
+		}
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(received)-1))
+		w.WriteHeader(http.StatusPermanentRedirect)
+	}))
+	defer ts.Close()
+
+	file := filepath.Join(t.TempDir(), "chunk.bin")
+	if err := ioutil.WriteFile(file, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []int64
+	u := &ChunkUpload{
+		URL:           ts.URL,
+		File:          file,
+		ChunkSize:     8,
+		RetryInterval: time.Millisecond,
+		Offset:        func(context.Context) (int64, error) { return int64(len(received)), nil },
+		Progress:      func(done, total int64) { progress = append(progress, done) },
+	}
+	if err := u.Do(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, content) {
+		t.Fatalf("unexpected content %q", received)
+	}
+	expect := []string{"bytes 4-11/20", "bytes 10-17/20", "bytes 16-19/20"}
+	if fmt.Sprint(ranges) != fmt.Sprint(expect) {
+		t.Fatalf("unexpected ranges %v", ranges)
+	}
+	if fmt.Sprint(progress) != "[10 16 20]" {
+		t.Fatalf("unexpected progress %v", progress)
+	}
+
+	//一直失败时，重试Retry次后返回错误
+	var calls int
+	fail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer fail.Close()
+	u = &ChunkUpload{URL: fail.URL, File: file, Retry: 2, RetryInterval: time.Millisecond}
+	if err := u.Do(context.Background()); err == nil || calls != 3 {
+		t.Fatalf("want 3 calls and error, got %d %v", calls, err)
+	}
+}
@@ -0,0 +1,46 @@
+package curl
+
+import (
+	"context"
+	"net/http"
+)
+
+//Session 多次请求共用cookie、header和客户端配置，用于登录等多个步骤的流程
+type Session struct {
+	Jar http.CookieJar
+	//每个请求都会带上，请求里设置的优先
+	Headers http.Header
+
+	profile string
+}
+
+//NewSession jar为nil时使用内存的NewJar
+func NewSession(jar http.CookieJar) *Session {
+	if jar == nil {
+		jar = NewJar()
+	}
+	return &Session{Jar: jar, Headers: http.Header{}}
+}
+
+//SetProfile 见Curl.SetProfile
+func (s *Session) SetProfile(name string) {
+	s.profile = name
+}
+
+func (s *Session) New(ctx context.Context, method, url string) *Curl {
+	curls := New(ctx, method, url)
+	curls.SetJar(s.Jar)
+	curls.profile = s.profile
+	for k, v := range s.Headers {
+		curls.Headers[k] = append([]string(nil), v...)
+	}
+	return curls
+}
+
+func (s *Session) NewGet(ctx context.Context, url string) *Curl {
+	return s.New(ctx, http.MethodGet, url)
+}
+
+func (s *Session) NewPost(ctx context.Context, url string) *Curl {
+	return s.New(ctx, http.MethodPost, url)
+}
@@ -0,0 +1,173 @@
+package curl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ChunkUpload 分片上传文件，每片一个请求，带Content-Range: bytes start-end/total
+type ChunkUpload struct {
+	URL string
+	//默认是PUT
+	Method string
+	File   string
+	//默认4MB
+	ChunkSize int64
+	//每片失败时的重试次数，不包括第一次，默认3
+	Retry int
+	//第一次重试前等待的时间，之后每次翻倍，默认1秒
+	RetryInterval time.Duration
+	Headers       map[string]string
+	//见Curl.SetProfile
+	Profile string
+	//Offset 返回服务端已经收到的长度，用于断点续传，nil表示从头开始
+	Offset func(ctx context.Context) (int64, error)
+	//每片上传成功后回调
+	Progress Progress
+}
+
+//Do 服务端返回2xx表示这一片成功，返回308时从Range: bytes=0-n的n+1继续，没有Range表示没有收到任何数据
+func (u *ChunkUpload) Do(ctx context.Context) (err error) {
+	if u.Method == "" {
+		u.Method = http.MethodPut
+	}
+	if u.ChunkSize <= 0 {
+		u.ChunkSize = 4 << 20
+	}
+	if u.Retry <= 0 {
+		u.Retry = 3
+	}
+	if u.RetryInterval <= 0 {
+		u.RetryInterval = time.Second
+	}
+
+	f, err := os.Open(u.File)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	total := fi.Size()
+
+	var start int64
+	if u.Offset != nil {
+		if start, err = u.Offset(ctx); err != nil {
+			return
+		}
+		if start < 0 || start > total {
+			return fmt.Errorf("invalid upload offset %d of %d", start, total)
+		}
+	}
+	if total == 0 {
+		return u.retry(ctx, func() (err error) {
+			_, err = u.upload(ctx, nil, "bytes */0", 0)
+			return
+		})
+	}
+
+	for start < total {
+		end := start + u.ChunkSize
+		if end > total {
+			end = total
+		}
+		err = u.retry(ctx, func() (err error) {
+			next, err := u.upload(ctx, io.NewSectionReader(f, start, end-start),
+				fmt.Sprintf("bytes %d-%d/%d", start, end-1, total), end)
+			if err != nil {
+				return
+			}
+			//服务端可能只保存了一部分，从服务端的位置继续
+			if next <= start || next > end {
+				return fmt.Errorf("upload bytes %d-%d/%d: unexpected server offset %d", start, end-1, total, next)
+			}
+			start = next
+			return
+		})
+		if err != nil {
+			return
+		}
+		if u.Progress != nil {
+			u.Progress(start, total)
+		}
+	}
+
+	return
+}
+
+func (u *ChunkUpload) retry(ctx context.Context, f func() error) (err error) {
+	interval := u.RetryInterval
+	for i := 0; ; i++ {
+		if err = f(); err == nil || ctx.Err() != nil || i >= u.Retry {
+			return
+		}
+		if e := sleepCtx(ctx, interval); e != nil {
+			return
+		}
+		interval *= 2
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+//upload 返回服务端已经收到的长度，end是这一片全部成功时的长度
+func (u *ChunkUpload) upload(ctx context.Context, r *io.SectionReader, contentRange string, end int64) (next int64, err error) {
+	curls := New(ctx, u.Method, u.URL)
+	curls.SetHeaders(u.Headers)
+	curls.Headers.Set("Content-Range", contentRange)
+	if curls.Headers.Get("Content-Type") == "" {
+		curls.Headers.Set("Content-Type", "application/octet-stream")
+	}
+	if u.Profile != "" {
+		curls.SetProfile(u.Profile)
+	}
+	if r != nil {
+		curls.SetPostReaderSize(r, r.Size())
+	}
+	rs, err := curls.Request()
+	if err != nil {
+		return
+	}
+	defer rs.Close()
+	if rs.StatusCode == http.StatusPermanentRedirect {
+		return parseRange(rs.Header.Get("Range"))
+	}
+	if rs.StatusCode < 200 || rs.StatusCode >= 300 {
+		return 0, fmt.Errorf("upload %s failed: StatusCode:%d", contentRange, rs.StatusCode)
+	}
+
+	return end, nil
+}
+
+//parseRange 解析bytes=0-n，返回n+1，为空返回0
+func parseRange(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	i := strings.LastIndexByte(s, '-')
+	if !strings.HasPrefix(s, "bytes=") || i < 0 {
+		return 0, fmt.Errorf("invalid range: %s", s)
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s[i+1:]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid range: %s", s)
+	}
+	return n + 1, nil
+}
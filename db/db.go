@@ -8,11 +8,12 @@ import (
 	"time"
 
 	"github.com/go-xorm/cachestore"
-	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/db/cache"
 	"github.com/hsyan2008/hfw/encoding"
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/prometheus"
 	"github.com/hsyan2008/hfw/signal"
 	"xorm.io/xorm"
 	"xorm.io/xorm/caches"
@@ -96,9 +97,14 @@ func getEngine(config configs.DbStdConfig) (engine *xorm.Engine, isNew bool, err
 		return engine, isNew, fmt.Errorf("NewEngine dbConfig: %v failed: %v", config, err)
 	}
 
+	engine.AddHook(traceHook{driver: driver})
 	engineMap.Store(common.Md5(dbDsn), engine)
 	isNew = true
 
+	//连接池的状态，名字不包含密码
+	prometheus.RegisterDBStats(fmt.Sprintf("%s://%s:%s/%s", driver, config.Address, config.Port, config.Dbname),
+		engine.DB().Stats)
+
 	return
 }
 
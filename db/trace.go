@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+
+	"github.com/hsyan2008/hfw/trace"
+	"xorm.io/xorm/contexts"
+)
+
+type sqlSpanKey struct{}
+
+//traceHook ctx里有span时，每条sql创建一个子span
+type traceHook struct {
+	driver string
+}
+
+func (h traceHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	if !trace.SpanContextFromContext(c.Ctx).IsValid() {
+		return c.Ctx, nil
+	}
+	ctx, span := trace.Start(c.Ctx, "SQL", trace.SpanKindClient)
+	span.SetAttribute("db.system", h.driver)
+	span.SetAttribute("db.statement", c.SQL)
+
+	return context.WithValue(ctx, sqlSpanKey{}, span), nil
+}
+
+func (h traceHook) AfterProcess(c *contexts.ContextHook) error {
+	if span, ok := c.Ctx.Value(sqlSpanKey{}).(*trace.Span); ok {
+		span.SetError(c.Err)
+		span.End()
+	}
+	return nil
+}
@@ -1,15 +1,16 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 
-	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
+	logger "github.com/hsyan2008/hfw/logging"
 	"xorm.io/xorm"
 	"xorm.io/xorm/caches"
 )
@@ -47,6 +48,25 @@ type XormDao struct {
 	isCache bool
 	cacher  *caches.LRUCacher
 	sess    *xorm.Session
+
+	//用于追踪，ctx里有span时每条sql是一个子span
+	ctx context.Context
+}
+
+//WithContext 返回使用ctx的XormDao，共用连接和事务，如db.DefaultDao.WithContext(httpCtx.Ctx).Search(...)
+//只对事务外的调用生效，事务的session是共用的，仍使用NewSession时的ctx，需要时先WithContext再NewSession
+func (d *XormDao) WithContext(ctx context.Context) *XormDao {
+	nd := *d
+	nd.ctx = ctx
+	return &nd
+}
+
+func (d *XormDao) newSession() *xorm.Session {
+	sess := d.engine.NewSession()
+	if d.ctx != nil {
+		sess = sess.Context(d.ctx)
+	}
+	return sess
 }
 
 func (d *XormDao) GetConf() configs.DbConfig {
@@ -67,7 +87,7 @@ func (d *XormDao) UpdateByIds(t Model, params interface{},
 
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	if len(cols) > 0 {
@@ -94,7 +114,7 @@ func (d *XormDao) UpdateByWhere(t Model, params Cond,
 
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, where, false, false)
@@ -113,7 +133,7 @@ func (d *XormDao) UpdateByWhere(t Model, params Cond,
 func (d *XormDao) Insert(m, t Model) (affected int64, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 
@@ -128,7 +148,7 @@ func (d *XormDao) Insert(m, t Model) (affected int64, err error) {
 func (d *XormDao) InsertMulti(m Model, t interface{}) (affected int64, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 
@@ -143,7 +163,7 @@ func (d *XormDao) InsertMulti(m Model, t interface{}) (affected int64, err error
 func (d *XormDao) SearchOne(t Model, cond Cond) (has bool, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, cond, true, false)
@@ -327,7 +347,7 @@ FOR:
 func (d *XormDao) Search(t Model, ts interface{}, cond Cond) (err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, cond, true, true)
@@ -347,7 +367,7 @@ func (d *XormDao) Search(t Model, ts interface{}, cond Cond) (err error) {
 func (d *XormDao) SearchAndCount(t Model, ts interface{}, cond Cond) (total int64, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, cond, true, true)
@@ -367,7 +387,7 @@ func (d *XormDao) SearchAndCount(t Model, ts interface{}, cond Cond) (total int6
 func (d *XormDao) Rows(t Model, cond Cond) (rows *xorm.Rows, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, cond, true, true)
@@ -387,7 +407,7 @@ func (d *XormDao) Rows(t Model, cond Cond) (rows *xorm.Rows, err error) {
 func (d *XormDao) Iterate(t Model, cond Cond, f xorm.IterFunc) (err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, cond, true, true)
@@ -407,7 +427,7 @@ func (d *XormDao) Iterate(t Model, cond Cond, f xorm.IterFunc) (err error) {
 func (d *XormDao) GetByIds(t Model, ts interface{}, ids []interface{}, cols ...string) (err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	if len(cols) > 0 {
@@ -426,7 +446,7 @@ func (d *XormDao) GetByIds(t Model, ts interface{}, ids []interface{}, cols ...s
 func (d *XormDao) Count(t Model, cond Cond) (total int64, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, cond, false, false)
@@ -472,7 +492,7 @@ func (d *XormDao) Exec(sqlStr string, args ...interface{}) (rs sql.Result, err e
 
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	rs, err = sess.Exec(tmp...)
@@ -487,7 +507,7 @@ func (d *XormDao) Exec(sqlStr string, args ...interface{}) (rs sql.Result, err e
 func (d *XormDao) Query(t Model, args ...interface{}) (rs []map[string][]byte, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	if len(args) > 0 {
@@ -513,7 +533,7 @@ func (d *XormDao) Query(t Model, args ...interface{}) (rs []map[string][]byte, e
 func (d *XormDao) QueryString(t Model, args ...interface{}) (rs []map[string]string, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	if len(args) > 0 {
@@ -539,7 +559,7 @@ func (d *XormDao) QueryString(t Model, args ...interface{}) (rs []map[string]str
 func (d *XormDao) QueryInterface(t Model, args ...interface{}) (rs []map[string]interface{}, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	if len(args) > 0 {
@@ -570,7 +590,7 @@ func (d *XormDao) DeleteByIds(t Model, ids interface{}) (affected int64, err err
 
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 
@@ -590,7 +610,7 @@ func (d *XormDao) DeleteByWhere(t Model, where Cond) (affected int64, err error)
 
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, where, false, false)
@@ -632,7 +652,7 @@ func (d *XormDao) ClearCache(t Model) {
 //Notice: 注意并发不安全，请勿在全局上使用
 func (d *XormDao) NewSession() {
 	if d.sess == nil {
-		d.sess = d.engine.NewSession()
+		d.sess = d.newSession()
 	}
 }
 
@@ -1,7 +1,10 @@
 package db
 
 import (
-	"github.com/hsyan2008/go-logger"
+	"sync/atomic"
+
+	"github.com/hsyan2008/hfw/admin"
+	logger "github.com/hsyan2008/hfw/logging"
 	"xorm.io/xorm/log"
 )
 
@@ -11,12 +14,18 @@ type xormLog struct {
 }
 
 func newXormLog() *xormLog {
-	return &xormLog{
+	l := &xormLog{
 		Logger: logger.NewLogger(),
 	}
+	//下面的方法多了一层调用
+	l.Logger.SetCallDepth(3)
+	return l
 }
 
 func (this *xormLog) Level() log.LogLevel {
+	if l := atomic.LoadInt32(&sqlLevel); l >= 0 && logger.LEVEL(l) > logger.Level() {
+		return log.LogLevel(l)
+	}
 	return log.LogLevel(logger.Level())
 }
 
@@ -31,3 +40,76 @@ func (this *xormLog) ShowSQL(show ...bool) {
 func (this *xormLog) IsShowSQL() bool {
 	return this.isShowSQL
 }
+
+//sqlLevel db模块的日志级别，-1表示跟随全局，可通过admin的/logger?module=db调整
+var sqlLevel int32 = -1
+
+func init() {
+	admin.RegisterLogModule("db", func() string {
+		l := atomic.LoadInt32(&sqlLevel)
+		if l < 0 {
+			return "default"
+		}
+		return admin.LevelName(logger.LEVEL(l))
+	}, func(level string) {
+		l, ok := admin.ParseLevel(level)
+		if !ok {
+			atomic.StoreInt32(&sqlLevel, -1)
+			return
+		}
+		atomic.StoreInt32(&sqlLevel, int32(l))
+	})
+}
+
+func (this *xormLog) enabled(l logger.LEVEL) bool {
+	sl := atomic.LoadInt32(&sqlLevel)
+	return sl < 0 || (logger.LEVEL(sl) != logger.OFF && l >= logger.LEVEL(sl))
+}
+
+func (this *xormLog) Debug(v ...interface{}) {
+	if this.enabled(logger.DEBUG) {
+		this.Logger.Debug(v...)
+	}
+}
+
+func (this *xormLog) Debugf(format string, v ...interface{}) {
+	if this.enabled(logger.DEBUG) {
+		this.Logger.Debugf(format, v...)
+	}
+}
+
+func (this *xormLog) Info(v ...interface{}) {
+	if this.enabled(logger.INFO) {
+		this.Logger.Info(v...)
+	}
+}
+
+func (this *xormLog) Infof(format string, v ...interface{}) {
+	if this.enabled(logger.INFO) {
+		this.Logger.Infof(format, v...)
+	}
+}
+
+func (this *xormLog) Warn(v ...interface{}) {
+	if this.enabled(logger.WARN) {
+		this.Logger.Warn(v...)
+	}
+}
+
+func (this *xormLog) Warnf(format string, v ...interface{}) {
+	if this.enabled(logger.WARN) {
+		this.Logger.Warnf(format, v...)
+	}
+}
+
+func (this *xormLog) Error(v ...interface{}) {
+	if this.enabled(logger.ERROR) {
+		this.Logger.Error(v...)
+	}
+}
+
+func (this *xormLog) Errorf(format string, v ...interface{}) {
+	if this.enabled(logger.ERROR) {
+		this.Logger.Errorf(format, v...)
+	}
+}
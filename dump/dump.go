@@ -0,0 +1,264 @@
+//Package dump 按路由、trace_id或者错误码记录完整的请求和响应，每行一个json，可以用Replay重放
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsyan2008/hfw/accesslog"
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/grpc/auth"
+	logger "github.com/hsyan2008/hfw/logging"
+)
+
+const defaultMaxBodySize = 64 << 10
+
+var (
+	//包括grpc的metadata里auth支持的凭证
+	defaultRedactHeaders = []string{"Authorization", "Cookie", "Set-Cookie", auth.APIKeyKey, auth.LegacyKey}
+	defaultRedactFields  = []string{"password", "passwd", "token", "secret"}
+)
+
+//Message 请求或者响应，grpc的Header是metadata，Body是消息的json
+type Message struct {
+	Header    map[string][]string `json:",omitempty"`
+	Body      string              `json:",omitempty"`
+	Truncated bool                `json:",omitempty"`
+}
+
+//Record 一次请求
+type Record struct {
+	Time    time.Time
+	TraceID string
+	//http或者grpc
+	Type string
+	//http是路由的模板，grpc是完整的方法名
+	Route  string
+	Method string
+	//http的RequestURI和Host
+	URL      string `json:",omitempty"`
+	Host     string `json:",omitempty"`
+	Status   string
+	ErrNo    int64
+	Latency  time.Duration
+	Request  Message
+	Response Message
+}
+
+type dumper struct {
+	w        io.Writer
+	closer   io.Closer
+	routes   []string
+	traceIDs map[string]bool
+	errNos   map[int64]bool
+	onlyErr  bool
+	maxBody  int
+	headers  map[string]bool
+	fields   map[string]bool
+
+	lock sync.Mutex
+}
+
+var (
+	lock      = new(sync.RWMutex)
+	curDumper *dumper
+)
+
+//Init 根据配置开启
+func Init(conf configs.DumpConfig) error {
+	if !conf.IsEnable {
+		return nil
+	}
+	file := accesslog.LogFile(conf.LogFile, ".dump.log")
+	w, err := accesslog.NewRollingWriter(file, conf.LogType, conf.LogMaxNum, conf.LogSize, conf.LogUnit)
+	if err != nil {
+		return err
+	}
+	SetWriter(w, conf)
+	lock.Lock()
+	curDumper.closer = w
+	lock.Unlock()
+	logger.Infof("dump is enabled, file: %s", file)
+
+	return nil
+}
+
+//SetWriter 写入自定义的Writer，conf里不使用文件相关的配置
+func SetWriter(w io.Writer, conf configs.DumpConfig) {
+	d := &dumper{
+		w:        w,
+		routes:   conf.Routes,
+		traceIDs: make(map[string]bool),
+		errNos:   make(map[int64]bool),
+		onlyErr:  conf.OnlyError,
+		maxBody:  conf.MaxBodySize,
+		headers:  make(map[string]bool),
+		fields:   make(map[string]bool),
+	}
+	for _, v := range conf.TraceIDs {
+		d.traceIDs[v] = true
+	}
+	for _, v := range conf.ErrNos {
+		d.errNos[v] = true
+	}
+	if d.maxBody <= 0 {
+		d.maxBody = defaultMaxBodySize
+	}
+	if len(conf.RedactHeaders) == 0 {
+		conf.RedactHeaders = defaultRedactHeaders
+	}
+	for _, v := range conf.RedactHeaders {
+		d.headers[strings.ToLower(v)] = true
+	}
+	if len(conf.RedactFields) == 0 {
+		conf.RedactFields = defaultRedactFields
+	}
+	for _, v := range conf.RedactFields {
+		d.fields[strings.ToLower(v)] = true
+	}
+
+	lock.Lock()
+	old := curDumper
+	curDumper = d
+	lock.Unlock()
+
+	//只关闭Init打开的文件
+	if old != nil && old.closer != nil {
+		old.closer.Close()
+	}
+}
+
+func getDumper() *dumper {
+	lock.RLock()
+	defer lock.RUnlock()
+	return curDumper
+}
+
+//IsEnable 没有开启时不需要缓存body
+func IsEnable() bool {
+	return getDumper() != nil
+}
+
+//Match 是否需要记录，success是请求是否成功
+func Match(route, traceID string, errNo int64, success bool) bool {
+	d := getDumper()
+	if d == nil {
+		return false
+	}
+	if d.onlyErr && success {
+		return false
+	}
+	if len(d.routes) > 0 {
+		ok := false
+		for _, v := range d.routes {
+			if v == route || (strings.HasSuffix(v, "*") && strings.HasPrefix(route, strings.TrimSuffix(v, "*"))) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(d.traceIDs) == 0 && len(d.errNos) == 0 {
+		return true
+	}
+
+	return d.traceIDs[traceID] || (errNo != 0 && d.errNos[errNo])
+}
+
+//Log 隐藏敏感的header和字段后写入，调用前先用Match判断
+func Log(r *Record) {
+	d := getDumper()
+	if d == nil {
+		return
+	}
+	r.URL = d.redactURL(r.URL)
+	d.redactMessage(&r.Request)
+	d.redactMessage(&r.Response)
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		logger.Warn("dump marshal error:", err)
+		return
+	}
+	b = append(b, '\n')
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, err = d.w.Write(b); err != nil {
+		logger.Warn("dump write error:", err)
+	}
+}
+
+//MaxBodySize 记录的body的最大字节数
+func MaxBodySize() int {
+	if d := getDumper(); d != nil {
+		return d.maxBody
+	}
+	return defaultMaxBodySize
+}
+
+//Buffer 最多保存MaxBodySize字节，超过的部分丢弃
+type Buffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func NewBuffer() *Buffer {
+	return &Buffer{max: MaxBodySize()}
+}
+
+func (b *Buffer) Write(p []byte) (int, error) {
+	if left := b.max - b.buf.Len(); len(p) > left {
+		b.truncated = true
+		if left > 0 {
+			b.buf.Write(p[:left])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *Buffer) String() string {
+	return b.buf.String()
+}
+
+func (b *Buffer) Truncated() bool {
+	return b.truncated
+}
+
+//ReadBody 先读取MaxBodySize字节的body，再放回r.Body，handler没有读取body也能记录
+func ReadBody(r *http.Request) *Buffer {
+	b := NewBuffer()
+	if r.Body == nil || r.Body == http.NoBody {
+		return b
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, int64(b.max)+1))
+	_, _ = b.Write(data)
+	var rest io.Reader = r.Body
+	if err != nil {
+		rest = errReader{err}
+	}
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(data), rest), r.Body}
+	return b
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,149 @@
+package dump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMatch(t *testing.T) {
+	defer func() { curDumper = nil }()
+
+	SetWriter(ioutil.Discard, configs.DumpConfig{Routes: []string{"/user/*", "/index/index"}, ErrNos: []int64{500}})
+	tests := []struct {
+		route   string
+		traceID string
+		errNo   int64
+		want    bool
+	}{
+		{"/user/login", "", 500, true},
+		{"/index/index", "", 500, true},
+		{"/order/list", "", 500, false},
+		{"/user/login", "", 0, false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.route, tt.traceID, tt.errNo, tt.errNo == 0); got != tt.want {
+			t.Errorf("Match(%s, %d) = %v, want %v", tt.route, tt.errNo, got, tt.want)
+		}
+	}
+
+	SetWriter(ioutil.Discard, configs.DumpConfig{TraceIDs: []string{"abc"}, OnlyError: true})
+	if Match("/a", "abc", 0, true) {
+		t.Error("success request should be skipped")
+	}
+	if !Match("/a", "abc", 0, false) {
+		t.Error("trace id should match")
+	}
+}
+
+func TestLogAndReplay(t *testing.T) {
+	defer func() { curDumper = nil }()
+
+	var buf bytes.Buffer
+	SetWriter(&buf, configs.DumpConfig{MaxBodySize: 1024})
+
+	r := httptest.NewRequest("POST", "/user/login?token=t1&page=1", strings.NewReader(`{"name":"a","Password":"p1"}`))
+	r.Header.Set("Authorization", "Bearer xxx")
+	r.Header.Set("Content-Type", "application/json")
+	body := ReadBody(r)
+	if b, _ := ioutil.ReadAll(r.Body); string(b) != `{"name":"a","Password":"p1"}` {
+		t.Fatalf("body should be kept, got %s", b)
+	}
+	Log(&Record{
+		TraceID: "abc",
+		Type:    "http",
+		Route:   "/user/login",
+		Method:  r.Method,
+		URL:     r.RequestURI,
+		Host:    r.Host,
+		Status:  "200",
+		Request: Message{Header: r.Header.Clone(), Body: body.String()},
+		//截断的json
+		Response: Message{Body: `{"token":"t2","list":[1,2`, Truncated: true},
+	})
+	s := buf.String()
+	for _, secret := range []string{"Bearer xxx", "p1", "t1", "t2"} {
+		if strings.Contains(s, secret) {
+			t.Fatalf("%s should be redacted: %s", secret, s)
+		}
+	}
+
+	list, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("len = %d, want 1", len(list))
+	}
+	var got *http.Request
+	var gotBody string
+	w, err := ReplayHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		b, _ := ioutil.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusTeapot)
+	}), list[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("code = %d", w.Code)
+	}
+	if got.URL.Path != "/user/login" || got.URL.Query().Get("page") != "1" || got.Method != "POST" {
+		t.Fatalf("unexpected request: %s %s", got.Method, got.URL)
+	}
+	if got.Header.Get("Authorization") != "" || got.Header.Get(ReplayHeader) != "abc" {
+		t.Fatalf("unexpected header: %v", got.Header)
+	}
+	if !strings.Contains(gotBody, `"name":"a"`) {
+		t.Fatalf("unexpected body: %s", gotBody)
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	b := &Buffer{max: 4}
+	_, _ = b.Write([]byte("ab"))
+	_, _ = b.Write([]byte("cdef"))
+	if b.String() != "abcd" || !b.Truncated() {
+		t.Fatalf("got %s %v", b.String(), b.Truncated())
+	}
+}
+
+func TestLogGrpcRedactMetadata(t *testing.T) {
+	defer func() { curDumper = nil }()
+
+	var buf bytes.Buffer
+	SetWriter(&buf, configs.DumpConfig{})
+
+	md := metadata.Pairs("authorization", "Bearer b1", "x-api-key", "k1", "x", "legacy1", "x-scope", "a")
+	Log(&Record{
+		Type:    "grpc",
+		Route:   "/user.User/Login",
+		Method:  "Login",
+		Status:  "OK",
+		Request: Message{Header: md, Body: `{"name":"a"}`},
+	})
+
+	list, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("got %d records, want 1", len(list))
+	}
+	h := list[0].Request.Header
+	for _, k := range []string{"authorization", "x-api-key", "x"} {
+		if len(h[k]) != 1 || h[k][0] != redacted {
+			t.Fatalf("%s should be redacted, got %v", k, h[k])
+		}
+	}
+	if len(h["x-scope"]) != 1 || h["x-scope"][0] != "a" {
+		t.Fatalf("x-scope should be kept, got %v", h["x-scope"])
+	}
+}
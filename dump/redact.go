@@ -0,0 +1,100 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const redacted = "******"
+
+//jsonField 解析失败时(如被截断)按"key":"value"替换
+var jsonField = regexp.MustCompile(`"([^"\\]+)"\s*:\s*"(?:[^"\\]|\\.)*"`)
+
+func (d *dumper) redactMessage(m *Message) {
+	for k, v := range m.Header {
+		if d.headers[strings.ToLower(k)] {
+			list := make([]string, len(v))
+			for i := range list {
+				list[i] = redacted
+			}
+			m.Header[k] = list
+		}
+	}
+	m.Body = d.redactBody(m.Body)
+}
+
+func (d *dumper) redactURL(s string) string {
+	i := strings.IndexByte(s, '?')
+	if i < 0 {
+		return s
+	}
+	return s[:i+1] + d.redactForm(s[i+1:])
+}
+
+func (d *dumper) redactBody(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return s
+	}
+	if trimmed[0] == '{' || trimmed[0] == '[' {
+		dec := json.NewDecoder(strings.NewReader(trimmed))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err == nil && !dec.More() {
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if err = enc.Encode(d.redactJSON(v)); err == nil {
+				return strings.TrimSuffix(buf.String(), "\n")
+			}
+		}
+		return jsonField.ReplaceAllStringFunc(s, func(pair string) string {
+			key := jsonField.FindStringSubmatch(pair)[1]
+			if !d.fields[strings.ToLower(key)] {
+				return pair
+			}
+			return `"` + key + `":"` + redacted + `"`
+		})
+	}
+	if strings.Contains(s, "=") && !strings.ContainsAny(trimmed, " \n<") {
+		return d.redactForm(s)
+	}
+	return s
+}
+
+func (d *dumper) redactJSON(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, vv := range val {
+			if d.fields[strings.ToLower(k)] {
+				val[k] = redacted
+			} else {
+				val[k] = d.redactJSON(vv)
+			}
+		}
+	case []interface{}:
+		for i, vv := range val {
+			val[i] = d.redactJSON(vv)
+		}
+	}
+	return v
+}
+
+//redactForm 保持原来的顺序，只替换值
+func (d *dumper) redactForm(s string) string {
+	pairs := strings.Split(s, "&")
+	for i, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		key, err := url.QueryUnescape(kv[0])
+		if err != nil {
+			key = kv[0]
+		}
+		if len(kv) == 2 && d.fields[strings.ToLower(key)] {
+			pairs[i] = kv[0] + "=" + url.QueryEscape(redacted)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,104 @@
+package dump
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+//ReplayHeader 重放的请求会带上这个header
+const ReplayHeader = "X-Dump-Replay"
+
+//Read 读取dump的内容，每行一个Record
+func Read(r io.Reader) (list []*Record, err error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64<<10), 64<<20)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		rec := new(Record)
+		if err = json.Unmarshal([]byte(line), rec); err != nil {
+			return nil, err
+		}
+		list = append(list, rec)
+	}
+	return list, s.Err()
+}
+
+//ReadFile 读取dump的文件
+func ReadFile(file string) ([]*Record, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+//ReplayHTTP 通过h重新执行，如http.HandlerFunc(hfw.Router)，返回新的响应
+//被隐藏的header不会发送，被隐藏的字段按******发送，截断的body不能重放
+func ReplayHTTP(h http.Handler, rec *Record) (*httptest.ResponseRecorder, error) {
+	if rec.Type != "http" {
+		return nil, fmt.Errorf("not http record: %s", rec.Type)
+	}
+	if rec.Request.Truncated {
+		return nil, fmt.Errorf("request body of %s is truncated", rec.TraceID)
+	}
+	r, err := http.NewRequest(rec.Method, "http://"+rec.Host+rec.URL, strings.NewReader(rec.Request.Body))
+	if err != nil {
+		return nil, err
+	}
+	r.RequestURI = rec.URL
+	r.RemoteAddr = "127.0.0.1:0"
+	for k, v := range rec.Request.Header {
+		if isRedacted(v) {
+			continue
+		}
+		r.Header[k] = v
+	}
+	r.Header.Set(ReplayHeader, rec.TraceID)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w, nil
+}
+
+//ReplayGRPC 把请求的json解析到req，通过conn调用，resp是方法的响应类型
+func ReplayGRPC(ctx context.Context, conn grpc.ClientConnInterface, rec *Record,
+	req, resp interface{}, opts ...grpc.CallOption) error {
+	if rec.Type != "grpc" {
+		return fmt.Errorf("not grpc record: %s", rec.Type)
+	}
+	if rec.Request.Truncated {
+		return fmt.Errorf("request body of %s is truncated", rec.TraceID)
+	}
+	if err := json.Unmarshal([]byte(rec.Request.Body), req); err != nil {
+		return err
+	}
+	md := metadata.MD{}
+	for k, v := range rec.Request.Header {
+		//由grpc自己设置的
+		if isRedacted(v) || strings.HasPrefix(k, ":") || k == "content-type" || k == "user-agent" {
+			continue
+		}
+		md[k] = v
+	}
+	md.Set(strings.ToLower(ReplayHeader), rec.TraceID)
+
+	return conn.Invoke(metadata.NewOutgoingContext(ctx, md), rec.Route, req, resp, opts...)
+}
+
+func isRedacted(v []string) bool {
+	return len(v) > 0 && v[0] == redacted
+}
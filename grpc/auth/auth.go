@@ -30,7 +30,7 @@ func NewAuth(value string) *Auth {
 
 func (this *Auth) getKey() string {
 	//固定为x
-	return "x"
+	return LegacyKey
 }
 
 func (this *Auth) getValue() string {
@@ -67,3 +67,43 @@ func (this *Auth) Auth(ctx context.Context) error {
 
 	return nil
 }
+
+//BearerAuth 客户端使用，通过authorization: Bearer xxx传递token，服务端用Authenticator验证
+type BearerAuth struct {
+	isHTTPS bool
+	token   string
+	//如果不为nil，每次请求都调用，用于刷新token
+	tokenFunc func(ctx context.Context) (string, error)
+}
+
+func NewBearerAuth(token string, isHTTPS bool) *BearerAuth {
+	return &BearerAuth{
+		isHTTPS: isHTTPS,
+		token:   token,
+	}
+}
+
+func NewBearerAuthWithFunc(f func(ctx context.Context) (string, error), isHTTPS bool) *BearerAuth {
+	return &BearerAuth{
+		isHTTPS:   isHTTPS,
+		tokenFunc: f,
+	}
+}
+
+func (this *BearerAuth) GetRequestMetadata(ctx context.Context, uri ...string) (
+	map[string]string, error,
+) {
+	token := this.token
+	if this.tokenFunc != nil {
+		var err error
+		token, err = this.tokenFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return map[string]string{AuthorizationKey: "Bearer " + token}, nil
+}
+
+func (this *BearerAuth) RequireTransportSecurity() bool {
+	return this.isHTTPS
+}
@@ -0,0 +1,199 @@
+//Authenticator 用于grpc和http的token认证
+//Usage:
+//a, err := auth.NewAuthenticator(hfw.Config.Server.Auth)
+//grpc的handler里
+//ctx, err = a.AuthenticateGrpc(ctx, "/hello.HelloService/Say")
+//http的controller里，如Before
+//claims, err := a.AuthenticateRequest(httpCtx.Request, httpCtx.Request.URL.Path)
+//httpCtx.ThrowCheck(int64(auth.HTTPStatus(err)), err)
+//或者hfw.Handle("/api/", a.Middleware(handler))
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/hsyan2008/hfw/configs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	AuthorizationKey = "authorization"
+	APIKeyKey        = "x-api-key"
+	//LegacyKey 旧的Auth使用的key
+	LegacyKey = "x"
+)
+
+type Authenticator struct {
+	verifier Verifier
+	scopes   methodRules
+	exempt   methodRules
+}
+
+//NewAuthenticator 根据配置创建，没有配置任何认证方式则返回nil
+func NewAuthenticator(conf configs.AuthConfig) (*Authenticator, error) {
+	var chain ChainVerifier
+	if len(conf.StaticKeys) > 0 {
+		v, err := NewStaticVerifier(conf.StaticKeys)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, v)
+	}
+	if len(conf.APIKeys) > 0 {
+		v, err := NewAPIKeyVerifier(conf.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, v)
+	}
+	if conf.JWT.Secret != "" || conf.JWT.PublicKeyFile != "" || conf.JWT.JWKSFile != "" {
+		v, err := NewJWTVerifier(conf.JWT)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, v)
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+
+	a := NewAuthenticatorWithVerifier(chain, conf.Scopes)
+	a.SetExemptMethods(conf.ExemptMethods)
+
+	return a, nil
+}
+
+//NewAuthenticatorWithVerifier 使用自定义的Verifier
+func NewAuthenticatorWithVerifier(verifier Verifier, scopes map[string][]string) *Authenticator {
+	a := &Authenticator{
+		verifier: verifier,
+		scopes:   newMethodRules(scopes),
+	}
+	a.SetExemptMethods(nil)
+
+	return a
+}
+
+//Verify 依次验证凭证，返回第一个通过的结果
+func (a *Authenticator) Verify(ctx context.Context, creds []Credential) (claims *Claims, err error) {
+	if len(creds) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "not found token")
+	}
+	for _, cred := range creds {
+		claims, err = a.verifier.Verify(ctx, cred)
+		if err == nil {
+			return
+		}
+	}
+
+	return nil, status.Errorf(codes.Unauthenticated, "%s", err.Error())
+}
+
+//CheckScopes fullMethod是grpc的方法全名或者http的路由
+func (a *Authenticator) CheckScopes(fullMethod string, claims *Claims) error {
+	required, ok := a.scopes.get(fullMethod)
+	if !ok || claims.HasScopes(required...) {
+		return nil
+	}
+
+	return status.Errorf(codes.PermissionDenied, "%s need scopes: %s", fullMethod, strings.Join(required, " "))
+}
+
+//AuthenticateGrpc 验证grpc请求，并把Claims放入ctx
+func (a *Authenticator) AuthenticateGrpc(ctx context.Context, fullMethod string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	claims, err := a.Verify(ctx, CredentialsFromMetadata(md))
+	if err != nil {
+		return ctx, err
+	}
+	if err = a.CheckScopes(fullMethod, claims); err != nil {
+		return ctx, err
+	}
+
+	return NewContextWithClaims(ctx, claims), nil
+}
+
+//AuthenticateRequest 验证http请求，route一般是r.URL.Path
+func (a *Authenticator) AuthenticateRequest(r *http.Request, route string) (*Claims, error) {
+	claims, err := a.Verify(r.Context(), CredentialsFromRequest(r))
+	if err != nil {
+		return nil, err
+	}
+	if err = a.CheckScopes(route, claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+//Middleware http中间件，验证通过后Claims放入r.Context()
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := a.AuthenticateRequest(r, r.URL.Path)
+		if err != nil {
+			http.Error(w, status.Convert(err).Message(), HTTPStatus(err))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContextWithClaims(r.Context(), claims)))
+	})
+}
+
+//HTTPStatus 把认证错误转为http状态码
+func HTTPStatus(err error) int {
+	switch status.Code(err) {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+//CredentialsFromMetadata 支持authorization、x-api-key和旧的x
+func CredentialsFromMetadata(md metadata.MD) (creds []Credential) {
+	for _, v := range md.Get(AuthorizationKey) {
+		if cred, ok := parseAuthorization(v); ok {
+			creds = append(creds, cred)
+		}
+	}
+	for _, v := range md.Get(APIKeyKey) {
+		creds = append(creds, Credential{Type: CredentialAPIKey, Token: v})
+	}
+	for _, v := range md.Get(LegacyKey) {
+		creds = append(creds, Credential{Type: CredentialBearer, Token: v})
+	}
+
+	return
+}
+
+//CredentialsFromRequest 支持Authorization和X-Api-Key
+func CredentialsFromRequest(r *http.Request) (creds []Credential) {
+	if cred, ok := parseAuthorization(r.Header.Get(AuthorizationKey)); ok {
+		creds = append(creds, cred)
+	}
+	if v := r.Header.Get(APIKeyKey); v != "" {
+		creds = append(creds, Credential{Type: CredentialAPIKey, Token: v})
+	}
+
+	return
+}
+
+func parseAuthorization(v string) (cred Credential, ok bool) {
+	pos := strings.IndexByte(v, ' ')
+	if pos < 0 || !strings.EqualFold(v[:pos], "Bearer") {
+		return
+	}
+	token := strings.TrimSpace(v[pos+1:])
+	if token == "" {
+		return
+	}
+
+	return Credential{Type: CredentialBearer, Token: token}, true
+}
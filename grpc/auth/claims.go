@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+//Claims 认证通过后的调用方信息
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	Scopes    []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	//JWT里的其他字段
+	Extra map[string]interface{}
+	//认证方式，如static、apikey、jwt
+	Method string
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	if c == nil {
+		return false
+	}
+	for _, v := range c.Scopes {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+//HasScopes 需要全部满足
+func (c *Claims) HasScopes(scopes ...string) bool {
+	for _, v := range scopes {
+		if !c.HasScope(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Claims) HasAudience(aud string) bool {
+	if c == nil {
+		return false
+	}
+	for _, v := range c.Audience {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+//Valid 检查时间，leeway是允许的误差
+func (c *Claims) Valid(now time.Time, leeway time.Duration) error {
+	if !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt.Add(leeway)) {
+		return ErrTokenExpired
+	}
+	if !c.NotBefore.IsZero() && now.Add(leeway).Before(c.NotBefore) {
+		return ErrTokenNotValidYet
+	}
+	return nil
+}
+
+func (c *Claims) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.Method + ":" + c.Subject + "[" + strings.Join(c.Scopes, " ") + "]"
+}
+
+type claimsKey struct{}
+
+func NewContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+//ClaimsFromContext 获取认证通过后放入的Claims
+func ClaimsFromContext(ctx context.Context) (claims *Claims, ok bool) {
+	claims, ok = ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
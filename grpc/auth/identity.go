@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+//PeerIdentity 双向认证下，已验证的客户端证书身份
+type PeerIdentity struct {
+	CommonName string
+	DNSNames   []string
+	//URI SAN，如spiffe://example.org/ns/default/sa/web
+	URIs []string
+	IPs  []string
+}
+
+//Names 返回所有可用于匹配的身份，URI在前
+func (id *PeerIdentity) Names() (names []string) {
+	if id == nil {
+		return
+	}
+	names = append(names, id.URIs...)
+	names = append(names, id.DNSNames...)
+	if id.CommonName != "" {
+		names = append(names, id.CommonName)
+	}
+	names = append(names, id.IPs...)
+
+	return
+}
+
+//SpiffeID 返回第一个spiffe://开头的URI SAN
+func (id *PeerIdentity) SpiffeID() string {
+	if id == nil {
+		return ""
+	}
+	for _, v := range id.URIs {
+		if strings.HasPrefix(v, "spiffe://") {
+			return v
+		}
+	}
+	return ""
+}
+
+func (id *PeerIdentity) String() string {
+	if id == nil {
+		return ""
+	}
+	if s := id.SpiffeID(); s != "" {
+		return s
+	}
+	if id.CommonName != "" {
+		return id.CommonName
+	}
+	names := id.Names()
+	if len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+func NewPeerIdentity(cert *x509.Certificate) *PeerIdentity {
+	if cert == nil {
+		return nil
+	}
+	id := &PeerIdentity{
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+	}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		id.IPs = append(id.IPs, ip.String())
+	}
+
+	return id
+}
+
+type peerIdentityKey struct{}
+
+func NewContextWithPeerIdentity(ctx context.Context, id *PeerIdentity) context.Context {
+	return context.WithValue(ctx, peerIdentityKey{}, id)
+}
+
+//PeerIdentityFromContext 获取拦截器放入的身份，handler里使用
+func PeerIdentityFromContext(ctx context.Context) (id *PeerIdentity, ok bool) {
+	id, ok = ctx.Value(peerIdentityKey{}).(*PeerIdentity)
+	return id, ok && id != nil
+}
+
+//GetPeerIdentity 从grpc的peer信息里解析客户端证书
+//没有使用TLS或者客户端没有提供证书，返回nil
+func GetPeerIdentity(ctx context.Context) *PeerIdentity {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.AuthInfo == nil {
+		return nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	//优先取已验证的证书链
+	if len(tlsInfo.State.VerifiedChains) > 0 && len(tlsInfo.State.VerifiedChains[0]) > 0 {
+		return NewPeerIdentity(tlsInfo.State.VerifiedChains[0][0])
+	}
+	if len(tlsInfo.State.PeerCertificates) > 0 {
+		return NewPeerIdentity(tlsInfo.State.PeerCertificates[0])
+	}
+
+	return nil
+}
+
+//IdentityACL 按方法配置的调用方白名单
+type IdentityACL struct {
+	rules methodRules
+}
+
+//NewIdentityACL key是方法全名(/pkg.Service/Method)、服务通配(/pkg.Service/*)或者*
+//value是允许的身份，支持后缀*通配，如spiffe://example.org/*
+func NewIdentityACL(rules map[string][]string) *IdentityACL {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	return &IdentityACL{rules: newMethodRules(rules)}
+}
+
+//Check 没有配置规则的方法不做限制
+func (acl *IdentityACL) Check(fullMethod string, id *PeerIdentity) error {
+	if acl == nil {
+		return nil
+	}
+	allowed, ok := acl.rules.get(fullMethod)
+	if !ok {
+		return nil
+	}
+	if id == nil {
+		return status.Errorf(codes.Unauthenticated, "%s require client certificate", fullMethod)
+	}
+	for _, name := range id.Names() {
+		for _, pattern := range allowed {
+			if matchIdentity(pattern, name) {
+				return nil
+			}
+		}
+	}
+
+	return status.Errorf(codes.PermissionDenied, "%s is not allowed to call %s", id, fullMethod)
+}
+
+func matchIdentity(pattern, name string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(name, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == name
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIdentityACL(t *testing.T) {
+	acl := NewIdentityACL(map[string][]string{
+		"/hello.HelloService/Admin": {"spiffe://example.org/ns/ops/*"},
+		"/hello.HelloService/*":     {"web.example.org", "spiffe://example.org/ns/default/sa/web"},
+	})
+
+	web := &PeerIdentity{CommonName: "web.example.org"}
+	ops := &PeerIdentity{URIs: []string{"spiffe://example.org/ns/ops/sa/admin"}}
+
+	cases := []struct {
+		method string
+		id     *PeerIdentity
+		code   codes.Code
+	}{
+		{"/hello.HelloService/Say", web, codes.OK},
+		{"/hello.HelloService/Say", ops, codes.PermissionDenied},
+		{"/hello.HelloService/Say", nil, codes.Unauthenticated},
+		{"/hello.HelloService/Admin", ops, codes.OK},
+		{"/hello.HelloService/Admin", web, codes.PermissionDenied},
+		{"/other.OtherService/Say", nil, codes.OK},
+	}
+	for _, c := range cases {
+		if code := status.Code(acl.Check(c.method, c.id)); code != c.code {
+			t.Fatalf("method:%s id:%s want:%s got:%s", c.method, c.id, c.code, code)
+		}
+	}
+
+	var nilACL *IdentityACL
+	if err := nilACL.Check("/hello.HelloService/Say", nil); err != nil {
+		t.Fatalf("nil acl want nil got:%v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//DefaultExemptMethods 健康检查和反射默认不需要认证
+var DefaultExemptMethods = []string{
+	"/grpc.health.v1.Health/*",
+	"/grpc.reflection.v1alpha.ServerReflection/*",
+}
+
+//SetExemptMethods 设置不需要认证的方法，会加上DefaultExemptMethods
+func (a *Authenticator) SetExemptMethods(methods []string) {
+	rules := make(map[string][]string, len(methods)+len(DefaultExemptMethods))
+	for _, v := range DefaultExemptMethods {
+		rules[v] = nil
+	}
+	for _, v := range methods {
+		rules[v] = nil
+	}
+	a.exempt = newMethodRules(rules)
+}
+
+func (a *Authenticator) IsExempt(fullMethod string) bool {
+	_, ok := a.exempt.get(fullMethod)
+	return ok
+}
+
+//Check 用于服务端拦截器，认证通过后返回带有Claims的ctx
+//返回的错误统一是codes.Unauthenticated或codes.PermissionDenied
+func (a *Authenticator) Check(ctx context.Context, fullMethod string) (context.Context, error) {
+	if a == nil || a.IsExempt(fullMethod) {
+		return ctx, nil
+	}
+	newCtx, err := a.AuthenticateGrpc(ctx, fullMethod)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Unauthenticated, codes.PermissionDenied:
+		default:
+			err = status.Error(codes.Unauthenticated, err.Error())
+		}
+		return ctx, err
+	}
+
+	return newCtx, nil
+}
+
+//UnaryServerInterceptor 不使用hfw.NewGrpcServer时可以单独使用
+//和其他拦截器一起用grpc.ChainUnaryInterceptor，放在日志和监控之后
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, err := a.Check(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		ctx, err := a.Check(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w *serverStream) Context() context.Context {
+	return w.ctx
+}
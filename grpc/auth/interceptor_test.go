@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestInterceptor(t *testing.T) {
+	a, err := NewAuthenticator(configs.AuthConfig{
+		ExemptMethods: []string{"/public.Public/*", "/user.User/Ping"},
+		StaticKeys:    []configs.AuthKeyConfig{{Key: "static-token", Subject: "svc"}},
+		APIKeys:       []configs.AuthKeyConfig{{Key: "api-key", Subject: "partner"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unary := a.UnaryServerInterceptor()
+	stream := a.StreamServerInterceptor()
+
+	//返回Claims的Subject，没有则是空
+	var subject string
+	unaryHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		subject = ""
+		if claims, ok := ClaimsFromContext(ctx); ok {
+			subject = claims.Subject
+		}
+		return "ok", nil
+	}
+	streamHandler := func(srv interface{}, ss grpc.ServerStream) error {
+		_, err := unaryHandler(ss.Context(), nil)
+		return err
+	}
+
+	tests := []struct {
+		method  string
+		md      metadata.MD
+		code    codes.Code
+		subject string
+	}{
+		{"/user.User/Get", nil, codes.Unauthenticated, ""},
+		{"/user.User/Get", metadata.Pairs(AuthorizationKey, "Bearer bad"), codes.Unauthenticated, ""},
+		{"/user.User/Get", metadata.Pairs(AuthorizationKey, "Bearer static-token"), codes.OK, "svc"},
+		{"/user.User/Get", metadata.Pairs(LegacyKey, "static-token"), codes.OK, "svc"},
+		{"/user.User/Get", metadata.Pairs(APIKeyKey, "api-key"), codes.OK, "partner"},
+		//ExemptMethods
+		{"/user.User/Ping", nil, codes.OK, ""},
+		{"/public.Public/List", nil, codes.OK, ""},
+		{"/user.User/Pings", nil, codes.Unauthenticated, ""},
+		//健康检查和反射默认不需要认证
+		{"/grpc.health.v1.Health/Check", nil, codes.OK, ""},
+		{"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", nil, codes.OK, ""},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.md != nil {
+			ctx = metadata.NewIncomingContext(ctx, tt.md)
+		}
+
+		subject = "-"
+		_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, unaryHandler)
+		if status.Code(err) != tt.code {
+			t.Fatalf("unary %s %v: want %s got %v", tt.method, tt.md, tt.code, err)
+		}
+		if err == nil && subject != tt.subject {
+			t.Fatalf("unary %s %v: want subject %q got %q", tt.method, tt.md, tt.subject, subject)
+		}
+
+		subject = "-"
+		err = stream(nil, &testServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: tt.method}, streamHandler)
+		if status.Code(err) != tt.code {
+			t.Fatalf("stream %s %v: want %s got %v", tt.method, tt.md, tt.code, err)
+		}
+		if err == nil && subject != tt.subject {
+			t.Fatalf("stream %s %v: want subject %q got %q", tt.method, tt.md, tt.subject, subject)
+		}
+		if err != nil && subject != "-" {
+			t.Fatalf("%s: handler should not be called", tt.method)
+		}
+	}
+}
+
+func TestInterceptorNilAuthenticator(t *testing.T) {
+	//没有配置任何认证方式时不检查
+	a, err := NewAuthenticator(configs.AuthConfig{})
+	if err != nil || a != nil {
+		t.Fatalf("want nil authenticator, got %v %v", a, err)
+	}
+	ctx, err := a.Check(context.Background(), "/user.User/Get")
+	if err != nil || ctx == nil {
+		t.Fatalf("nil authenticator should allow all, got %v", err)
+	}
+}
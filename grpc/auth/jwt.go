@@ -0,0 +1,416 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+//jwks文件检查修改的间隔
+var jwksCheckInterval = 10 * time.Second
+
+//JWTVerifier 支持HS256/384/512、RS256/384/512、ES256/384/512
+//key按kid查找，没有kid的token会尝试所有key
+type JWTVerifier struct {
+	issuer   string
+	audience string
+	leeway   time.Duration
+
+	//静态配置的key
+	keys []*jwk
+
+	jwksFile      string
+	jwksKeys      []*jwk
+	jwksModTime   time.Time
+	jwksCheckTime time.Time
+
+	lock *sync.RWMutex
+}
+
+var _ Verifier = &JWTVerifier{}
+
+type jwk struct {
+	kid string
+	//为空则不限制
+	alg string
+	key interface{}
+}
+
+func NewJWTVerifier(conf configs.JWTConfig) (v *JWTVerifier, err error) {
+	v = &JWTVerifier{
+		issuer:   conf.Issuer,
+		audience: conf.Audience,
+		leeway:   time.Duration(conf.Leeway) * time.Second,
+		jwksFile: conf.JWKSFile,
+		lock:     new(sync.RWMutex),
+	}
+	if conf.Secret != "" {
+		v.keys = append(v.keys, &jwk{key: []byte(conf.Secret)})
+	}
+	if conf.PublicKeyFile != "" {
+		key, err := loadPublicKeyFile(conf.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = append(v.keys, &jwk{key: key})
+	}
+	if v.jwksFile != "" {
+		err = v.loadJWKS(true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(v.keys) == 0 && v.jwksFile == "" {
+		return nil, errors.New("jwt verifier need Secret, PublicKeyFile or JWKSFile")
+	}
+
+	return v, nil
+}
+
+//AddKey 运行时增加key，key可以是[]byte、*rsa.PublicKey、*ecdsa.PublicKey
+func (v *JWTVerifier) AddKey(kid string, key interface{}) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.keys = append(v.keys, &jwk{kid: kid, key: key})
+}
+
+func (v *JWTVerifier) Verify(ctx context.Context, cred Credential) (*Claims, error) {
+	if cred.Type != CredentialBearer || strings.Count(cred.Token, ".") != 2 {
+		return nil, ErrNotSupported
+	}
+	parts := strings.Split(cred.Token, ".")
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	hash, ok := jwtHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported jwt alg: %s", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	_ = v.loadJWKS(false)
+
+	verified := false
+	signingInput := []byte(parts[0] + "." + parts[1])
+	for _, k := range v.getKeys(header.Kid) {
+		if k.alg != "" && k.alg != header.Alg {
+			continue
+		}
+		if verifySignature(header.Alg, hash, k.key, signingInput, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidToken
+	}
+
+	payload := make(map[string]interface{})
+	err = decodeSegment(parts[1], &payload)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := parseClaims(payload)
+	if err = claims.Valid(time.Now(), v.leeway); err != nil {
+		return nil, err
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, fmt.Errorf("invalid jwt issuer: %s", claims.Issuer)
+	}
+	if v.audience != "" && !claims.HasAudience(v.audience) {
+		return nil, fmt.Errorf("invalid jwt audience: %v", claims.Audience)
+	}
+
+	return claims, nil
+}
+
+func (v *JWTVerifier) getKeys(kid string) (keys []*jwk) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	for _, list := range [][]*jwk{v.keys, v.jwksKeys} {
+		for _, k := range list {
+			if kid == "" || k.kid == "" || k.kid == kid {
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	return
+}
+
+//loadJWKS 文件修改后重新加载，加载失败则继续使用旧的key
+func (v *JWTVerifier) loadJWKS(force bool) (err error) {
+	if v.jwksFile == "" {
+		return
+	}
+	now := time.Now()
+	v.lock.RLock()
+	if !force && now.Sub(v.jwksCheckTime) < jwksCheckInterval {
+		v.lock.RUnlock()
+		return
+	}
+	v.lock.RUnlock()
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if !force && now.Sub(v.jwksCheckTime) < jwksCheckInterval {
+		return
+	}
+	v.jwksCheckTime = now
+
+	fi, err := os.Stat(v.jwksFile)
+	if err != nil {
+		return
+	}
+	if !force && fi.ModTime().Equal(v.jwksModTime) {
+		return
+	}
+	keys, err := loadJWKSFile(v.jwksFile)
+	if err != nil {
+		return
+	}
+	v.jwksKeys = keys
+	v.jwksModTime = fi.ModTime()
+
+	return
+}
+
+//loadJWKSFile 解析本地的jwks文件，支持RSA、EC和oct
+func loadJWKSFile(file string) (keys []*jwk, err error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	err = json.Unmarshal(b, &set)
+	if err != nil {
+		return nil, fmt.Errorf("parse jwks file %s failed: %v", file, err)
+	}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key interface{}
+		switch k.Kty {
+		case "RSA":
+			n, e1 := decodeBigInt(k.N)
+			e, e2 := decodeBigInt(k.E)
+			if e1 != nil || e2 != nil {
+				return nil, fmt.Errorf("invalid RSA jwk: %s", k.Kid)
+			}
+			key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("unsupported EC curve: %s", k.Crv)
+			}
+			x, e1 := decodeBigInt(k.X)
+			y, e2 := decodeBigInt(k.Y)
+			if e1 != nil || e2 != nil {
+				return nil, fmt.Errorf("invalid EC jwk: %s", k.Kid)
+			}
+			key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.K, "="))
+			if err != nil {
+				return nil, fmt.Errorf("invalid oct jwk: %s", k.Kid)
+			}
+			key = secret
+		default:
+			continue
+		}
+		keys = append(keys, &jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+
+	return
+}
+
+func loadPublicKeyFile(file string) (interface{}, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no pem data in %s", file)
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
+
+var jwtHashes = map[string]crypto.Hash{
+	"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512,
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+//verifySignature key的类型必须和alg匹配，防止用公钥当作HMAC的secret
+func verifySignature(alg string, hash crypto.Hash, key interface{}, signingInput, sig []byte) bool {
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(hash.New, secret)
+		_, _ = mac.Write(signingInput)
+		return hmac.Equal(sig, mac.Sum(nil))
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		h := hash.New()
+		_, _ = h.Write(signingInput)
+		return rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), sig) == nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		h := hash.New()
+		_, _ = h.Write(signingInput)
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(pub, h.Sum(nil), r, s)
+	}
+
+	return false
+}
+
+//token的解析不使用encoding.JSON，避免模糊解析把字符串当成数字
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func parseClaims(payload map[string]interface{}) *Claims {
+	claims := &Claims{
+		Method: "jwt",
+		Extra:  make(map[string]interface{}),
+	}
+	for k, v := range payload {
+		switch k {
+		case "sub":
+			claims.Subject, _ = v.(string)
+		case "iss":
+			claims.Issuer, _ = v.(string)
+		case "aud":
+			claims.Audience = toStrings(v)
+		case "exp":
+			claims.ExpiresAt = toTime(v)
+		case "nbf":
+			claims.NotBefore = toTime(v)
+		case "iat":
+			claims.IssuedAt = toTime(v)
+		case "scope":
+			//rfc8693，空格分隔
+			if s, ok := v.(string); ok {
+				claims.Scopes = append(claims.Scopes, strings.Fields(s)...)
+			} else {
+				claims.Scopes = append(claims.Scopes, toStrings(v)...)
+			}
+		case "scp", "scopes":
+			claims.Scopes = append(claims.Scopes, toStrings(v)...)
+		default:
+			claims.Extra[k] = v
+		}
+	}
+
+	return claims
+}
+
+func toStrings(v interface{}) (list []string) {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		for _, i := range t {
+			if s, ok := i.(string); ok {
+				list = append(list, s)
+			}
+		}
+	}
+	return
+}
+
+func toTime(v interface{}) time.Time {
+	if f, ok := v.(float64); ok {
+		return time.Unix(int64(f), 0)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func signJWT(t *testing.T, header, payload map[string]interface{}, sign func([]byte) []byte) string {
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(input)))
+}
+
+func TestJWTVerifierHS256(t *testing.T) {
+	secret := []byte("secret")
+	hs256 := func(b []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(b)
+		return mac.Sum(nil)
+	}
+	v, err := NewJWTVerifier(configs.JWTConfig{Secret: string(secret), Issuer: "hfw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	token := signJWT(t, map[string]interface{}{"alg": "HS256"},
+		map[string]interface{}{"sub": "u1", "iss": "hfw", "exp": exp, "scope": "read write"}, hs256)
+	claims, err := v.Verify(context.Background(), Credential{Type: CredentialBearer, Token: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "u1" || !claims.HasScopes("read", "write") {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+
+	expired := signJWT(t, map[string]interface{}{"alg": "HS256"},
+		map[string]interface{}{"sub": "u1", "iss": "hfw", "exp": time.Now().Add(-time.Hour).Unix()}, hs256)
+	if _, err = v.Verify(context.Background(), Credential{Type: CredentialBearer, Token: expired}); err != ErrTokenExpired {
+		t.Fatalf("want:%v got:%v", ErrTokenExpired, err)
+	}
+
+	none := signJWT(t, map[string]interface{}{"alg": "none"},
+		map[string]interface{}{"sub": "u1", "iss": "hfw"}, func([]byte) []byte { return nil })
+	if _, err = v.Verify(context.Background(), Credential{Type: CredentialBearer, Token: none}); err == nil {
+		t.Fatal("alg none must be rejected")
+	}
+}
+
+func TestJWTVerifierJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"k1","alg":"RS256","n":"%s","e":"%s"}]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "jwks.json")
+	if err = ioutil.WriteFile(file, []byte(jwks), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewAuthenticator(configs.AuthConfig{
+		StaticKeys: []configs.AuthKeyConfig{{Key: "static-token", Subject: "legacy"}},
+		JWT:        configs.JWTConfig{JWKSFile: file},
+		Scopes:     map[string][]string{"/hello.HelloService/*": {"hello"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs256 := func(b []byte) []byte {
+		h := sha256.Sum256(b)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	token := signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "k1"},
+		map[string]interface{}{"sub": "u2", "scp": []string{"hello"}}, rs256)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AuthorizationKey, "Bearer "+token))
+	ctx, err = a.AuthenticateGrpc(ctx, "/hello.HelloService/Say")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, ok := ClaimsFromContext(ctx); !ok || claims.Subject != "u2" {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+
+	//静态token没有hello的scope
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x", "static-token"))
+	if _, err = a.AuthenticateGrpc(ctx, "/hello.HelloService/Say"); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("want:%s got:%v", codes.PermissionDenied, err)
+	}
+	if _, err = a.AuthenticateGrpc(ctx, "/other.OtherService/Say"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(AuthorizationKey, "Bearer bad"))
+	if _, err = a.AuthenticateGrpc(ctx, "/other.OtherService/Say"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("want:%s got:%v", codes.Unauthenticated, err)
+	}
+}
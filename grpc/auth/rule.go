@@ -0,0 +1,39 @@
+package auth
+
+import "strings"
+
+//methodRules 按方法或者路由配置的规则
+//key是方法全名(/pkg.Service/Method)或路由(/user/info)、通配(/pkg.Service/*)或者*
+type methodRules map[string][]string
+
+func newMethodRules(rules map[string][]string) methodRules {
+	m := make(methodRules, len(rules))
+	for k, v := range rules {
+		m[k] = v
+	}
+
+	return m
+}
+
+//get 精确匹配优先，然后逐级向上通配，最后是*
+func (m methodRules) get(fullMethod string) (values []string, ok bool) {
+	if len(m) == 0 {
+		return
+	}
+	if values, ok = m[fullMethod]; ok {
+		return
+	}
+	for prefix := fullMethod; ; {
+		pos := strings.LastIndex(prefix, "/")
+		if pos <= 0 {
+			break
+		}
+		prefix = prefix[:pos]
+		if values, ok = m[prefix+"/*"]; ok {
+			return
+		}
+	}
+	values, ok = m["*"]
+
+	return
+}
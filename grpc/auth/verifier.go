@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+const (
+	//authorization: Bearer xxx
+	CredentialBearer = "bearer"
+	//x-api-key: xxx
+	CredentialAPIKey = "apikey"
+)
+
+var (
+	ErrNotSupported     = errors.New("credential not supported")
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
+)
+
+//Credential 请求里携带的凭证
+type Credential struct {
+	Type  string
+	Token string
+}
+
+//Verifier 验证凭证，不支持的凭证类型返回ErrNotSupported
+type Verifier interface {
+	Verify(ctx context.Context, cred Credential) (*Claims, error)
+}
+
+type keyInfo struct {
+	key      []byte
+	subject  string
+	scopes   []string
+	expireAt time.Time
+}
+
+//KeyVerifier 固定的key，支持同时配置多个，用于轮换
+type KeyVerifier struct {
+	credType string
+	method   string
+
+	keys []keyInfo
+	lock *sync.RWMutex
+}
+
+var _ Verifier = &KeyVerifier{}
+
+//NewStaticVerifier 通过authorization: Bearer xxx或者旧的x传递
+func NewStaticVerifier(keys []configs.AuthKeyConfig) (*KeyVerifier, error) {
+	return newKeyVerifier(CredentialBearer, "static", keys)
+}
+
+//NewAPIKeyVerifier 通过x-api-key传递
+func NewAPIKeyVerifier(keys []configs.AuthKeyConfig) (*KeyVerifier, error) {
+	return newKeyVerifier(CredentialAPIKey, "apikey", keys)
+}
+
+func newKeyVerifier(credType, method string, keys []configs.AuthKeyConfig) (*KeyVerifier, error) {
+	v := &KeyVerifier{
+		credType: credType,
+		method:   method,
+		lock:     new(sync.RWMutex),
+	}
+
+	return v, v.SetKeys(keys)
+}
+
+//SetKeys 替换全部key，用于运行时轮换
+func (v *KeyVerifier) SetKeys(keys []configs.AuthKeyConfig) (err error) {
+	list, err := parseKeys(keys)
+	if err != nil {
+		return
+	}
+
+	v.lock.Lock()
+	v.keys = list
+	v.lock.Unlock()
+
+	return nil
+}
+
+//AddKey 增加新key，旧key可以设置ExpireAt后自然过期
+func (v *KeyVerifier) AddKey(key configs.AuthKeyConfig) error {
+	list, err := parseKeys([]configs.AuthKeyConfig{key})
+	if err != nil {
+		return err
+	}
+
+	//读取和修改都在写锁里，并发AddKey不会丢失
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	keys := make([]keyInfo, 0, len(v.keys)+1)
+	v.keys = append(append(keys, v.keys...), list...)
+
+	return nil
+}
+
+func parseKeys(keys []configs.AuthKeyConfig) (list []keyInfo, err error) {
+	list = make([]keyInfo, 0, len(keys))
+	for _, k := range keys {
+		if k.Key == "" {
+			return nil, errors.New("empty auth key")
+		}
+		info := keyInfo{
+			key:     []byte(k.Key),
+			subject: k.Subject,
+			scopes:  k.Scopes,
+		}
+		if k.ExpireAt != "" {
+			info.expireAt, err = time.ParseInLocation("2006-01-02 15:04:05", k.ExpireAt, time.Local)
+			if err != nil {
+				return nil, err
+			}
+		}
+		list = append(list, info)
+	}
+
+	return
+}
+
+func (v *KeyVerifier) Verify(ctx context.Context, cred Credential) (*Claims, error) {
+	if cred.Type != v.credType {
+		return nil, ErrNotSupported
+	}
+	token := []byte(cred.Token)
+
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	for _, k := range v.keys {
+		if subtle.ConstantTimeCompare(k.key, token) != 1 {
+			continue
+		}
+		claims := &Claims{
+			Subject:   k.subject,
+			Scopes:    k.scopes,
+			ExpiresAt: k.expireAt,
+			Method:    v.method,
+		}
+		if err := claims.Valid(time.Now(), 0); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+
+	return nil, ErrInvalidToken
+}
+
+//ChainVerifier 按顺序验证，任意一个通过即可
+type ChainVerifier []Verifier
+
+func (chain ChainVerifier) Verify(ctx context.Context, cred Credential) (*Claims, error) {
+	err := ErrNotSupported
+	for _, v := range chain {
+		claims, e := v.Verify(ctx, cred)
+		if e == nil {
+			return claims, nil
+		}
+		if e != ErrNotSupported {
+			err = e
+		}
+	}
+
+	return nil, err
+}
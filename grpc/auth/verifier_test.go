@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestKeyVerifierAddKeyConcurrent(t *testing.T) {
+	v, err := NewStaticVerifier(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := v.AddKey(configs.AuthKeyConfig{Key: fmt.Sprintf("key-%d", i)}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 50; i++ {
+		if _, err := v.Verify(context.Background(), Credential{Type: CredentialBearer, Token: fmt.Sprintf("key-%d", i)}); err != nil {
+			t.Fatalf("key-%d lost: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+//Package consistenthash 一致性hash，相同的key总是调用同一个节点，节点变化时只影响少部分key
+//key放在outgoing metadata的x-hash-key里，可以用NewContext设置，没有key则随机
+//Usage:
+//ctx = consistenthash.NewContext(ctx, userID)
+//resp, err = client.Say(ctx, req)
+package consistenthash
+
+import (
+	"context"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	Name    = "consistent_hash"
+	HashKey = dc.HashKey
+	//权重为DefaultWeight的节点的虚拟节点数
+	replicas = 160
+)
+
+func init() {
+	balancer.Register(newBuilder())
+}
+
+//NewContext 设置本次调用的hash key
+func NewContext(ctx context.Context, key string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, HashKey, key)
+}
+
+type hashPickerBuilder struct {
+}
+
+func newBuilder() balancer.Builder {
+	return base.NewBalancerBuilder(Name, new(hashPickerBuilder), base.Config{HealthCheck: true})
+}
+
+func (b *hashPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	p := new(hashPicker)
+	for conn, connInfo := range info.ReadySCs {
+		p.conns = append(p.conns, conn)
+		n := replicas * dc.GetAddressWeight(connInfo.Address) / dc.DefaultWeight
+		if n < 1 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			p.ring = append(p.ring, ringNode{
+				hash: hash(connInfo.Address.Addr + "#" + strconv.Itoa(i)),
+				conn: conn,
+			})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool {
+		return p.ring[i].hash < p.ring[j].hash
+	})
+
+	return p
+}
+
+type ringNode struct {
+	hash uint32
+	conn balancer.SubConn
+}
+
+type hashPicker struct {
+	ring  []ringNode
+	conns []balancer.SubConn
+}
+
+func (p *hashPicker) Pick(info balancer.PickInfo) (result balancer.PickResult, err error) {
+	key := keyFromContext(info.Ctx)
+	if key == "" {
+		result.SubConn = p.conns[rand.Intn(len(p.conns))]
+		return
+	}
+
+	result.SubConn = p.get(key)
+	return
+}
+
+func (p *hashPicker) get(key string) balancer.SubConn {
+	h := hash(key)
+	i := sort.Search(len(p.ring), func(i int) bool {
+		return p.ring[i].hash >= h
+	})
+	if i == len(p.ring) {
+		i = 0
+	}
+
+	return p.ring[i].conn
+}
+
+func keyFromContext(ctx context.Context) string {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if v := md.Get(HashKey); len(v) > 0 {
+		return v[len(v)-1]
+	}
+	return ""
+}
+
+func hash(s string) uint32 {
+	return crc32.ChecksumIEEE([]byte(s))
+}
@@ -0,0 +1,56 @@
+package consistenthash
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+type testSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+func build(addrs ...string) balancer.Picker {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for _, s := range addrs {
+		info.ReadySCs[&testSubConn{addr: s}] = base.SubConnInfo{Address: resolver.Address{Addr: s}}
+	}
+	return new(hashPickerBuilder).Build(info)
+}
+
+func pick(t *testing.T, p balancer.Picker, key string) string {
+	result, err := p.Pick(balancer.PickInfo{Ctx: NewContext(context.Background(), key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.SubConn.(*testSubConn).addr
+}
+
+func TestConsistentHash(t *testing.T) {
+	p1 := build("a:1", "b:1", "c:1")
+	p2 := build("a:1", "b:1", "c:1", "d:1")
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		addr := pick(t, p1, key)
+		if addr != pick(t, p1, key) {
+			t.Fatalf("key %s is not sticky", key)
+		}
+		if addr2 := pick(t, p2, key); addr2 != addr {
+			if addr2 != "d:1" {
+				t.Fatalf("key %s moved from %s to %s", key, addr, addr2)
+			}
+			moved++
+		}
+	}
+	//新增一个节点，大约1/4的key会迁移
+	if moved == 0 || moved > 400 {
+		t.Fatalf("unexpected moved: %d", moved)
+	}
+}
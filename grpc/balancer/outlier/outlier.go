@@ -0,0 +1,440 @@
+//Package outlier 被动的异常节点摘除，包装任意的负载均衡策略
+//连续失败或者耗时明显高于其他节点的，在一段时间内从子策略的地址里去掉
+//通过service config使用，client会根据GrpcConfig.OutlierDetection自动配置
+//{"loadBalancingConfig":[{"outlier_detection":{"ChildPolicy":"p2c","ConsecutiveErrors":5}}]}
+package outlier
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/grpc/balancer/p2c"
+	logger "github.com/hsyan2008/hfw/logging"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+const Name = "outlier_detection"
+
+var (
+	defaultConsecutiveErrors  int64 = 5
+	defaultInterval           int64 = 10000
+	defaultBaseEjectionTime   int64 = 30000
+	defaultMaxEjectionTime    int64 = 300000
+	defaultMaxEjectionPercent int64 = 10
+	defaultMinRequests        int64 = 10
+)
+
+func init() {
+	balancer.Register(new(builder))
+}
+
+//LBConfig service config里的配置
+type LBConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+	configs.OutlierDetectionConfig
+	//被包装的负载均衡策略
+	ChildPolicy string
+}
+
+//ServiceConfig 生成用于grpc.WithDefaultServiceConfig的loadBalancingConfig
+func ServiceConfig(childPolicy string, conf configs.OutlierDetectionConfig) (string, error) {
+	b, err := json.Marshal(LBConfig{OutlierDetectionConfig: conf, ChildPolicy: childPolicy})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`[{"%s":%s}]`, Name, b), nil
+}
+
+type builder struct {
+}
+
+func (b *builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	ob := &outlierBalancer{
+		opts:      opts,
+		endpoints: make(map[string]*endpoint),
+		scAddrs:   make(map[balancer.SubConn]string),
+		trigger:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	ob.cc = &wrappedClientConn{ClientConn: cc, b: ob}
+
+	return ob
+}
+
+func (b *builder) Name() string {
+	return Name
+}
+
+func (b *builder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	conf := new(LBConfig)
+	if err := json.Unmarshal(js, conf); err != nil {
+		return nil, fmt.Errorf("%s: parse config failed: %v", Name, err)
+	}
+	if conf.ChildPolicy == "" {
+		conf.ChildPolicy = p2c.Name
+	}
+	if balancer.Get(conf.ChildPolicy) == nil {
+		return nil, fmt.Errorf("%s: child policy %s not registered", Name, conf.ChildPolicy)
+	}
+	if conf.ConsecutiveErrors <= 0 {
+		conf.ConsecutiveErrors = defaultConsecutiveErrors
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = defaultInterval
+	}
+	if conf.BaseEjectionTime <= 0 {
+		conf.BaseEjectionTime = defaultBaseEjectionTime
+	}
+	if conf.MaxEjectionTime < conf.BaseEjectionTime {
+		conf.MaxEjectionTime = defaultMaxEjectionTime
+		if conf.MaxEjectionTime < conf.BaseEjectionTime {
+			conf.MaxEjectionTime = conf.BaseEjectionTime
+		}
+	}
+	if conf.MaxEjectionPercent <= 0 || conf.MaxEjectionPercent > 100 {
+		conf.MaxEjectionPercent = defaultMaxEjectionPercent
+	}
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = defaultMinRequests
+	}
+
+	return conf, nil
+}
+
+//endpoint 每个地址的统计
+type endpoint struct {
+	addr string
+	//连续失败次数
+	consecutive int64
+	//当前间隔内的统计
+	requests int64
+	latency  time.Duration
+	//被摘除的次数，决定摘除时间，没有被摘除的间隔会减1
+	ejections    int64
+	ejectedUntil time.Time
+	//连续失败达到阈值，等待检查
+	pending bool
+}
+
+func (e *endpoint) ejected() bool {
+	return !e.ejectedUntil.IsZero()
+}
+
+type outlierBalancer struct {
+	cc   *wrappedClientConn
+	opts balancer.BuildOptions
+	//修改时需要同时持有mu和statsLock
+	conf *LBConfig
+
+	//保证对子策略的调用是串行的
+	mu        sync.Mutex
+	child     balancer.Balancer
+	lastState balancer.ClientConnState
+	closed    bool
+
+	statsLock sync.Mutex
+	endpoints map[string]*endpoint
+	scAddrs   map[balancer.SubConn]string
+
+	once    sync.Once
+	trigger chan struct{}
+	done    chan struct{}
+}
+
+func (b *outlierBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	conf, ok := s.BalancerConfig.(*LBConfig)
+	if !ok {
+		return fmt.Errorf("%s: unexpected balancer config: %T", Name, s.BalancerConfig)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+
+	if b.child == nil || b.conf.ChildPolicy != conf.ChildPolicy {
+		if b.child != nil {
+			b.child.Close()
+		}
+		b.child = balancer.Get(conf.ChildPolicy).Build(b.cc, b.opts)
+	}
+	b.lastState = s
+	b.lastState.BalancerConfig = nil
+
+	b.statsLock.Lock()
+	b.conf = conf
+	addrs := make(map[string]struct{})
+	for _, a := range s.ResolverState.Addresses {
+		addrs[a.Addr] = struct{}{}
+		if _, ok := b.endpoints[a.Addr]; !ok {
+			b.endpoints[a.Addr] = &endpoint{addr: a.Addr}
+		}
+	}
+	for addr := range b.endpoints {
+		if _, ok := addrs[addr]; !ok {
+			delete(b.endpoints, addr)
+		}
+	}
+	b.statsLock.Unlock()
+
+	b.once.Do(func() {
+		go b.run()
+	})
+
+	return b.child.UpdateClientConnState(b.filter())
+}
+
+func (b *outlierBalancer) ResolverError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.child != nil && !b.closed {
+		b.child.ResolverError(err)
+	}
+}
+
+func (b *outlierBalancer) UpdateSubConnState(sc balancer.SubConn, state balancer.SubConnState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.child != nil && !b.closed {
+		b.child.UpdateSubConnState(sc, state)
+	}
+}
+
+func (b *outlierBalancer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.done)
+	if b.child != nil {
+		b.child.Close()
+	}
+}
+
+//filter 去掉被摘除的地址，需要持有mu
+func (b *outlierBalancer) filter() balancer.ClientConnState {
+	s := b.lastState
+	b.statsLock.Lock()
+	defer b.statsLock.Unlock()
+
+	addrs := make([]resolver.Address, 0, len(s.ResolverState.Addresses))
+	for _, a := range s.ResolverState.Addresses {
+		if e, ok := b.endpoints[a.Addr]; ok && e.ejected() {
+			continue
+		}
+		addrs = append(addrs, a)
+	}
+	//全部被摘除时不摘除
+	if len(addrs) > 0 {
+		s.ResolverState.Addresses = addrs
+	}
+
+	return s
+}
+
+//record picker的Done里调用
+func (b *outlierBalancer) record(sc balancer.SubConn, err error, latency time.Duration) {
+	b.statsLock.Lock()
+	defer b.statsLock.Unlock()
+
+	e, ok := b.endpoints[b.scAddrs[sc]]
+	if !ok || b.conf == nil {
+		return
+	}
+	e.requests++
+	e.latency += latency
+	if err != nil && !p2c.Acceptable(err) {
+		e.consecutive++
+		if e.consecutive >= b.conf.ConsecutiveErrors && !e.ejected() && !e.pending {
+			e.pending = true
+			select {
+			case b.trigger <- struct{}{}:
+			default:
+			}
+		}
+	} else {
+		e.consecutive = 0
+	}
+}
+
+func (b *outlierBalancer) run() {
+	b.mu.Lock()
+	interval := time.Duration(b.conf.Interval) * time.Millisecond
+	b.mu.Unlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		isInterval := false
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			isInterval = true
+		case <-b.trigger:
+		}
+
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return
+		}
+		if b.evaluate(time.Now(), isInterval) {
+			_ = b.child.UpdateClientConnState(b.filter())
+		}
+		b.mu.Unlock()
+	}
+}
+
+//evaluate 返回摘除的节点是否有变化，需要持有mu
+func (b *outlierBalancer) evaluate(now time.Time, isInterval bool) (changed bool) {
+	b.statsLock.Lock()
+	defer b.statsLock.Unlock()
+
+	conf := b.conf
+	var ejected int64
+	for _, e := range b.endpoints {
+		if e.ejected() {
+			if now.After(e.ejectedUntil) {
+				e.ejectedUntil = time.Time{}
+				e.consecutive = 0
+				changed = true
+				logger.Infof("%s: %s uneject %s", Name, b.cc.Target(), e.addr)
+			} else {
+				ejected++
+			}
+		}
+	}
+
+	var candidates []*endpoint
+	for _, e := range b.endpoints {
+		if e.pending && !e.ejected() {
+			candidates = append(candidates, e)
+		}
+		e.pending = false
+	}
+	if isInterval {
+		candidates = append(candidates, b.latencyOutliers()...)
+		for _, e := range b.endpoints {
+			if !e.ejected() && e.ejections > 0 {
+				e.ejections--
+			}
+			e.requests = 0
+			e.latency = 0
+		}
+	}
+
+	total := int64(len(b.endpoints))
+	for _, e := range candidates {
+		if e.ejected() {
+			continue
+		}
+		//至少可以摘除1个
+		if ejected > 0 && (ejected+1)*100 > total*conf.MaxEjectionPercent {
+			break
+		}
+		e.ejections++
+		d := time.Duration(conf.BaseEjectionTime*e.ejections) * time.Millisecond
+		if max := time.Duration(conf.MaxEjectionTime) * time.Millisecond; d > max {
+			d = max
+		}
+		e.ejectedUntil = now.Add(d)
+		ejected++
+		changed = true
+		logger.Warnf("%s: %s eject %s for %s", Name, b.cc.Target(), e.addr, d)
+	}
+
+	return
+}
+
+//latencyOutliers 平均耗时超过中位数的LatencyFactor倍的节点，需要持有statsLock
+func (b *outlierBalancer) latencyOutliers() (list []*endpoint) {
+	if b.conf.LatencyFactor <= 0 {
+		return
+	}
+	var eps []*endpoint
+	var avgs []float64
+	for _, e := range b.endpoints {
+		if !e.ejected() && e.requests >= b.conf.MinRequests {
+			eps = append(eps, e)
+			avgs = append(avgs, float64(e.latency)/float64(e.requests))
+		}
+	}
+	//节点太少时，中位数没有意义
+	if len(eps) < 3 {
+		return
+	}
+	sorted := append([]float64{}, avgs...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+	for i, e := range eps {
+		if avgs[i] > median*b.conf.LatencyFactor {
+			list = append(list, e)
+		}
+	}
+
+	return
+}
+
+//wrappedClientConn 记录SubConn对应的地址，并包装picker
+type wrappedClientConn struct {
+	balancer.ClientConn
+	b *outlierBalancer
+}
+
+func (cc *wrappedClientConn) NewSubConn(addrs []resolver.Address, opts balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	sc, err := cc.ClientConn.NewSubConn(addrs, opts)
+	if err != nil || len(addrs) == 0 {
+		return sc, err
+	}
+	cc.b.statsLock.Lock()
+	cc.b.scAddrs[sc] = addrs[0].Addr
+	cc.b.statsLock.Unlock()
+
+	return sc, nil
+}
+
+func (cc *wrappedClientConn) RemoveSubConn(sc balancer.SubConn) {
+	cc.b.statsLock.Lock()
+	delete(cc.b.scAddrs, sc)
+	cc.b.statsLock.Unlock()
+	cc.ClientConn.RemoveSubConn(sc)
+}
+
+func (cc *wrappedClientConn) UpdateState(state balancer.State) {
+	if state.Picker != nil {
+		state.Picker = &picker{child: state.Picker, b: cc.b}
+	}
+	cc.ClientConn.UpdateState(state)
+}
+
+type picker struct {
+	child balancer.Picker
+	b     *outlierBalancer
+}
+
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	result, err := p.child.Pick(info)
+	if err != nil || result.SubConn == nil {
+		return result, err
+	}
+	start := time.Now()
+	sc, done := result.SubConn, result.Done
+	result.Done = func(di balancer.DoneInfo) {
+		p.b.record(sc, di.Err, time.Since(start))
+		if done != nil {
+			done(di)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package outlier
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+)
+
+func startServer(t *testing.T, fail bool) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if fail {
+			return nil, status.Error(codes.Unavailable, "fail")
+		}
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+
+	return lis.Addr().String(), s.Stop
+}
+
+func TestOutlierDetection(t *testing.T) {
+	var addrs []resolver.Address
+	for i := 0; i < 3; i++ {
+		addr, stop := startServer(t, i == 0)
+		defer stop()
+		addrs = append(addrs, resolver.Address{Addr: addr})
+	}
+
+	r := manual.NewBuilderWithScheme("outlier")
+	r.InitialState(resolver.State{Addresses: addrs})
+	lbConfig, err := ServiceConfig(roundrobin.Name, configs.OutlierDetectionConfig{
+		ConsecutiveErrors: 2,
+		Interval:          60000,
+		//只允许摘除1个
+		MaxEjectionPercent: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.Dial(r.Scheme()+":///test", grpc.WithInsecure(), grpc.WithResolvers(r),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig":`+lbConfig+`}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := healthpb.NewHealthClient(conn)
+	check := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+		return err
+	}
+
+	failed := 0
+	for i := 0; i < 20; i++ {
+		if check() != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		t.Fatal("bad server should be called before ejection")
+	}
+
+	//等待摘除生效
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		if err := check(); err != nil {
+			t.Fatalf("bad server should be ejected: %v", err)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/hsyan2008/hfw"
+	"github.com/hsyan2008/hfw/prometheus"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
 	"google.golang.org/grpc/resolver"
@@ -30,16 +31,45 @@ func init() {
 	balancer.Register(newBuilder())
 }
 
-type p2cPickerBuilder struct {
+//p2cBuilder 每个ClientConn单独的PickerBuilder，用于统计
+type p2cBuilder struct {
 }
 
 func newBuilder() balancer.Builder {
-	return base.NewBalancerBuilder(Name, new(p2cPickerBuilder), base.Config{HealthCheck: true})
+	return new(p2cBuilder)
+}
+
+func (b *p2cBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	stats := newConnStats(opts.Target)
+	pb := &p2cPickerBuilder{stats: stats}
+	return &p2cBalancer{
+		Balancer: base.NewBalancerBuilder(Name, pb, base.Config{HealthCheck: true}).Build(cc, opts),
+		stats:    stats,
+	}
+}
+
+func (b *p2cBuilder) Name() string {
+	return Name
+}
+
+type p2cBalancer struct {
+	balancer.Balancer
+	stats *connStats
+}
+
+func (b *p2cBalancer) Close() {
+	b.stats.close()
+	b.Balancer.Close()
+}
+
+type p2cPickerBuilder struct {
+	stats *connStats
 }
 
 func (b *p2cPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
 	readySCs := info.ReadySCs
 	if len(readySCs) == 0 {
+		b.stats.setPicker(nil)
 		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
 	}
 
@@ -52,18 +82,23 @@ func (b *p2cPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
 		})
 	}
 
-	return &p2cPicker{
-		conns: conns,
-		r:     rand.New(rand.NewSource(time.Now().UnixNano())),
-		stamp: NewAtomicDuration(),
+	p := &p2cPicker{
+		service: b.stats.service,
+		conns:   conns,
+		r:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		stamp:   NewAtomicDuration(),
 	}
+	b.stats.setPicker(p)
+
+	return p
 }
 
 type p2cPicker struct {
-	conns []*subConn
-	r     *rand.Rand
-	stamp *AtomicDuration
-	lock  sync.Mutex
+	service string
+	conns   []*subConn
+	r       *rand.Rand
+	stamp   *AtomicDuration
+	lock    sync.Mutex
 }
 
 func (p *p2cPicker) Pick(info balancer.PickInfo) (
@@ -99,6 +134,8 @@ func (p *p2cPicker) Pick(info balancer.PickInfo) (
 
 	atomic.AddInt64(&chosen.inflight, 1)
 	atomic.AddInt64(&chosen.requests, 1)
+	atomic.AddInt64(&chosen.picks, 1)
+	prometheus.BalancerPicks(p.service, chosen.addr.Addr)
 
 	httpCtx := hfw.NewHTTPContextWithGrpcOutgoingCtx(info.Ctx)
 	defer httpCtx.Cancel()
@@ -136,6 +173,7 @@ func (p *p2cPicker) buildDoneFunc(httpCtx *hfw.HTTPContext, c *subConn) func(inf
 		}
 		osucc := atomic.LoadUint64(&c.success)
 		atomic.StoreUint64(&c.success, uint64(float64(osucc)*w+float64(success)*(1-w)))
+		c.report(p.service)
 
 		stamp := p.stamp.Load()
 		if now-stamp >= logInterval {
@@ -189,6 +227,8 @@ type subConn struct {
 	requests int64
 	last     int64
 	pick     int64
+	//累计的选中次数，requests会在打印日志时清零
+	picks int64
 }
 
 func (c *subConn) healthy() bool {
@@ -0,0 +1,192 @@
+package p2c
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hsyan2008/hfw/admin"
+	"github.com/hsyan2008/hfw/encoding"
+	"github.com/hsyan2008/hfw/prometheus"
+	"google.golang.org/grpc/resolver"
+)
+
+func init() {
+	admin.HandleFunc("/debug/balancer", Handler)
+}
+
+//ConnStats 每个ClientConn的picker状态
+type ConnStats struct {
+	Target    string
+	Service   string
+	Endpoints []EndpointStats
+}
+
+type EndpointStats struct {
+	Addr string
+	//纳秒
+	Lag      uint64
+	Inflight int64
+	//0-1
+	Success float64
+	Healthy bool
+	Load    int64
+	Picks   int64
+}
+
+type connStats struct {
+	target  string
+	service string
+	picker  *p2cPicker
+	addrs   map[string]struct{}
+	lock    sync.Mutex
+}
+
+var (
+	allConnStats = make(map[*connStats]struct{})
+	statsLock    = new(sync.RWMutex)
+	//同一个服务的节点可能被多个ClientConn使用，都不用时才删除监控数据
+	endpointRefs = make(map[[2]string]int)
+	refsLock     = new(sync.Mutex)
+)
+
+func newConnStats(target resolver.Target) *connStats {
+	cs := &connStats{
+		target:  target.Scheme + ":///" + target.Endpoint,
+		service: target.Endpoint,
+		addrs:   make(map[string]struct{}),
+	}
+	statsLock.Lock()
+	allConnStats[cs] = struct{}{}
+	statsLock.Unlock()
+
+	return cs
+}
+
+//setPicker 节点变化后，删除下线节点的监控数据
+func (cs *connStats) setPicker(p *p2cPicker) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	addrs := make(map[string]struct{})
+	if p != nil {
+		for _, c := range p.conns {
+			addrs[c.addr.Addr] = struct{}{}
+		}
+	}
+	refsLock.Lock()
+	for addr := range addrs {
+		if _, ok := cs.addrs[addr]; !ok {
+			endpointRefs[[2]string{cs.service, addr}]++
+		}
+	}
+	for addr := range cs.addrs {
+		if _, ok := addrs[addr]; !ok {
+			key := [2]string{cs.service, addr}
+			if endpointRefs[key]--; endpointRefs[key] <= 0 {
+				delete(endpointRefs, key)
+				prometheus.DeleteBalancerEndpoint(cs.service, addr)
+			}
+		}
+	}
+	refsLock.Unlock()
+	cs.addrs = addrs
+	cs.picker = p
+}
+
+func (cs *connStats) close() {
+	cs.setPicker(nil)
+	statsLock.Lock()
+	delete(allConnStats, cs)
+	statsLock.Unlock()
+}
+
+func (cs *connStats) stats() ConnStats {
+	cs.lock.Lock()
+	p := cs.picker
+	cs.lock.Unlock()
+
+	s := ConnStats{Target: cs.target, Service: cs.service}
+	if p == nil {
+		return s
+	}
+	p.lock.Lock()
+	conns := p.conns
+	p.lock.Unlock()
+	for _, c := range conns {
+		s.Endpoints = append(s.Endpoints, c.stats())
+	}
+	sort.Slice(s.Endpoints, func(i, j int) bool {
+		return s.Endpoints[i].Addr < s.Endpoints[j].Addr
+	})
+
+	return s
+}
+
+func (c *subConn) stats() EndpointStats {
+	return EndpointStats{
+		Addr:     c.addr.Addr,
+		Lag:      atomic.LoadUint64(&c.lag),
+		Inflight: atomic.LoadInt64(&c.inflight),
+		Success:  float64(atomic.LoadUint64(&c.success)) / initSuccess,
+		Healthy:  c.healthy(),
+		Load:     c.load(),
+		Picks:    atomic.LoadInt64(&c.picks),
+	}
+}
+
+//report 每次调用结束后更新prometheus
+func (c *subConn) report(service string) {
+	if !prometheus.IsEnable() {
+		return
+	}
+	s := c.stats()
+	healthy := 0.0
+	if s.Healthy {
+		healthy = 1
+	}
+	prometheus.BalancerEndpoint(service, s.Addr, map[string]float64{
+		"lag":      float64(s.Lag),
+		"inflight": float64(s.Inflight),
+		"success":  s.Success,
+		"healthy":  healthy,
+		"load":     float64(s.Load),
+	})
+}
+
+//Stats 所有使用p2c的ClientConn的状态
+func Stats() (list []ConnStats) {
+	statsLock.RLock()
+	for cs := range allConnStats {
+		list = append(list, cs.stats())
+	}
+	statsLock.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Target < list[j].Target
+	})
+
+	return
+}
+
+//Handler 输出p2c的状态，?service=xxx只看指定的服务
+func Handler(w http.ResponseWriter, r *http.Request) {
+	list := Stats()
+	if service := r.FormValue("service"); service != "" {
+		var tmp []ConnStats
+		for _, v := range list {
+			if v.Service == service {
+				tmp = append(tmp, v)
+			}
+		}
+		list = tmp
+	}
+
+	b, err := encoding.JSON.Marshal(list)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
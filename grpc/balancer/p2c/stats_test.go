@@ -0,0 +1,91 @@
+package p2c
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+type testSubConn struct {
+	balancer.SubConn
+}
+
+func TestStats(t *testing.T) {
+	cs := newConnStats(resolver.Target{Scheme: "static_hello", Endpoint: "hello"})
+	defer cs.close()
+
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for _, addr := range []string{"127.0.0.1:1", "127.0.0.1:2"} {
+		info.ReadySCs[new(testSubConn)] = base.SubConnInfo{Address: resolver.Address{Addr: addr}}
+	}
+	p := (&p2cPickerBuilder{stats: cs}).Build(info)
+	for i := 0; i < 10; i++ {
+		result, err := p.Pick(balancer.PickInfo{Ctx: context.Background()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result.Done(balancer.DoneInfo{})
+	}
+
+	var picks int64
+	for _, s := range Stats() {
+		if s.Service != "hello" {
+			continue
+		}
+		if len(s.Endpoints) != 2 {
+			t.Fatalf("unexpected endpoints: %+v", s.Endpoints)
+		}
+		for _, e := range s.Endpoints {
+			picks += e.Picks
+			if !e.Healthy || e.Inflight != 0 {
+				t.Fatalf("unexpected endpoint: %+v", e)
+			}
+		}
+	}
+	if picks != 10 {
+		t.Fatalf("want:10 got:%d", picks)
+	}
+
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest("GET", "/debug/balancer?service=hello", nil))
+	if !strings.Contains(w.Body.String(), "127.0.0.1:2") {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
+
+func TestEndpointRefs(t *testing.T) {
+	build := func(cs *connStats) {
+		info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+		info.ReadySCs[new(testSubConn)] = base.SubConnInfo{Address: resolver.Address{Addr: "127.0.0.1:1"}}
+		(&p2cPickerBuilder{stats: cs}).Build(info)
+	}
+	refs := func() int {
+		refsLock.Lock()
+		defer refsLock.Unlock()
+		return endpointRefs[[2]string{"refs", "127.0.0.1:1"}]
+	}
+
+	cs1 := newConnStats(resolver.Target{Scheme: "static_refs", Endpoint: "refs"})
+	cs2 := newConnStats(resolver.Target{Scheme: "static_refs", Endpoint: "refs"})
+	build(cs1)
+	build(cs2)
+	//重复Build不增加计数
+	build(cs1)
+	if n := refs(); n != 2 {
+		t.Fatalf("want:2 got:%d", n)
+	}
+	//另一个ClientConn还在使用
+	cs1.close()
+	if n := refs(); n != 1 {
+		t.Fatalf("want:1 got:%d", n)
+	}
+	cs2.close()
+	if n := refs(); n != 0 {
+		t.Fatalf("want:0 got:%d", n)
+	}
+}
@@ -0,0 +1,366 @@
+//Package route 按规则把请求路由到不同的节点组，如灰度发布
+//每组节点使用单独的子策略，命中规则的请求调用规则Meta匹配的节点，其他请求调用不匹配任何规则的节点
+//通过service config使用，client会根据GrpcConfig.Routes自动配置
+//{"loadBalancingConfig":[{"route":{"Rules":[{"Headers":{"x-canary":"1"},"Meta":{"version":"v2"}}],"ChildPolicy":"p2c"}}]}
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/grpc/balancer/p2c"
+	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+const Name = "route"
+
+//默认分组，不匹配任何规则的节点
+const defaultGroup = ""
+
+func init() {
+	balancer.Register(new(builder))
+}
+
+//LBConfig service config里的配置
+type LBConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+	Rules                             []configs.GrpcRouteConfig
+	//被包装的负载均衡策略，及其配置
+	ChildPolicy string
+	ChildConfig json.RawMessage `json:",omitempty"`
+
+	childConfig serviceconfig.LoadBalancingConfig
+	//每个规则对应的分组
+	ruleGroups []string
+}
+
+//ServiceConfig 生成用于grpc.WithDefaultServiceConfig的loadBalancingConfig
+//childConfig是子策略的配置，可以为空
+func ServiceConfig(rules []configs.GrpcRouteConfig, childPolicy string, childConfig json.RawMessage) (string, error) {
+	b, err := json.Marshal(LBConfig{Rules: rules, ChildPolicy: childPolicy, ChildConfig: childConfig})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`[{"%s":%s}]`, Name, b), nil
+}
+
+type builder struct {
+}
+
+func (b *builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	return &routeBalancer{
+		cc:       cc,
+		opts:     opts,
+		groups:   make(map[string]*group),
+		subConns: make(map[balancer.SubConn]*group),
+	}
+}
+
+func (b *builder) Name() string {
+	return Name
+}
+
+func (b *builder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	conf := new(LBConfig)
+	if err := json.Unmarshal(js, conf); err != nil {
+		return nil, fmt.Errorf("%s: parse config failed: %v", Name, err)
+	}
+	if conf.ChildPolicy == "" {
+		conf.ChildPolicy = p2c.Name
+	}
+	childBuilder := balancer.Get(conf.ChildPolicy)
+	if childBuilder == nil {
+		return nil, fmt.Errorf("%s: child policy %s not registered", Name, conf.ChildPolicy)
+	}
+	if parser, ok := childBuilder.(balancer.ConfigParser); ok {
+		childConfig := conf.ChildConfig
+		if len(childConfig) == 0 {
+			childConfig = json.RawMessage("{}")
+		}
+		var err error
+		if conf.childConfig, err = parser.ParseConfig(childConfig); err != nil {
+			return nil, err
+		}
+	}
+	for i, rule := range conf.Rules {
+		if len(rule.Meta) == 0 {
+			return nil, fmt.Errorf("%s: rule %d has nil Meta", Name, i)
+		}
+		conf.ruleGroups = append(conf.ruleGroups, dc.SelectorKey(rule.Meta))
+	}
+
+	return conf, nil
+}
+
+//group 一组节点，使用单独的子策略
+type group struct {
+	key   string
+	child balancer.Balancer
+	//没有节点时，请求使用默认分组
+	hasAddrs bool
+	state    balancer.State
+}
+
+type routeBalancer struct {
+	cc   balancer.ClientConn
+	opts balancer.BuildOptions
+
+	//保证对子策略的调用是串行的
+	mu     sync.Mutex
+	conf   *LBConfig
+	closed bool
+
+	//子策略会在其他goroutine里回调，修改groups和subConns需要同时持有mu和stateLock
+	stateLock sync.Mutex
+	groups    map[string]*group
+	subConns  map[balancer.SubConn]*group
+}
+
+func (b *routeBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	conf, ok := s.BalancerConfig.(*LBConfig)
+	if !ok {
+		return fmt.Errorf("%s: unexpected balancer config: %T", Name, s.BalancerConfig)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+
+	//子策略变化，全部重建
+	if b.conf != nil && b.conf.ChildPolicy != conf.ChildPolicy {
+		b.closeGroups(func(string) bool { return true })
+	}
+	b.stateLock.Lock()
+	b.conf = conf
+	b.stateLock.Unlock()
+
+	addrs := split(conf, s.ResolverState.Addresses)
+	b.closeGroups(func(key string) bool {
+		_, ok := addrs[key]
+		return !ok
+	})
+
+	var err error
+	for key, list := range addrs {
+		b.stateLock.Lock()
+		g, ok := b.groups[key]
+		if !ok {
+			g = &group{key: key, state: balancer.State{
+				ConnectivityState: connectivity.Connecting,
+				Picker:            base.NewErrPicker(balancer.ErrNoSubConnAvailable),
+			}}
+			b.groups[key] = g
+		}
+		g.hasAddrs = len(list) > 0
+		b.stateLock.Unlock()
+		if !ok {
+			g.child = balancer.Get(conf.ChildPolicy).Build(&groupClientConn{ClientConn: b.cc, b: b, g: g}, b.opts)
+		}
+
+		rs := s.ResolverState
+		rs.Addresses = list
+		e := g.child.UpdateClientConnState(balancer.ClientConnState{ResolverState: rs, BalancerConfig: conf.childConfig})
+		//规则的分组没有节点是正常的
+		if key == defaultGroup {
+			err = e
+		}
+	}
+	b.updateState()
+
+	return err
+}
+
+//split 按规则分组，默认分组没有节点时使用全部节点
+func split(conf *LBConfig, addrs []resolver.Address) map[string][]resolver.Address {
+	groups := map[string][]resolver.Address{defaultGroup: nil}
+	for i, rule := range conf.Rules {
+		key := conf.ruleGroups[i]
+		if _, ok := groups[key]; ok {
+			continue
+		}
+		list := make([]resolver.Address, 0)
+		for _, a := range addrs {
+			if dc.MatchMeta(rule.Meta, dc.GetAddressMeta(a)) {
+				list = append(list, a)
+			}
+		}
+		groups[key] = list
+	}
+
+	var list []resolver.Address
+	for _, a := range addrs {
+		if !dc.MatchAnyRoute(conf.Rules, dc.GetAddressMeta(a)) {
+			list = append(list, a)
+		}
+	}
+	if len(list) == 0 {
+		list = addrs
+	}
+	groups[defaultGroup] = list
+
+	return groups
+}
+
+//closeGroups 关闭需要删除的分组，需要持有mu
+func (b *routeBalancer) closeGroups(remove func(key string) bool) {
+	for key, g := range b.groups {
+		if !remove(key) {
+			continue
+		}
+		g.child.Close()
+		b.stateLock.Lock()
+		delete(b.groups, key)
+		b.stateLock.Unlock()
+	}
+}
+
+func (b *routeBalancer) ResolverError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	for _, g := range b.groups {
+		g.child.ResolverError(err)
+	}
+}
+
+func (b *routeBalancer) UpdateSubConnState(sc balancer.SubConn, state balancer.SubConnState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.stateLock.Lock()
+	g, ok := b.subConns[sc]
+	b.stateLock.Unlock()
+	if ok {
+		g.child.UpdateSubConnState(sc, state)
+	}
+}
+
+func (b *routeBalancer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	b.closeGroups(func(string) bool { return true })
+}
+
+//updateState 合并所有分组的状态
+func (b *routeBalancer) updateState() {
+	b.stateLock.Lock()
+	defer b.stateLock.Unlock()
+
+	def, ok := b.groups[defaultGroup]
+	if !ok || b.conf == nil {
+		return
+	}
+	p := &picker{
+		conf:   b.conf,
+		def:    def.state.Picker,
+		groups: make(map[string]balancer.Picker),
+	}
+	var ready, connecting, idle bool
+	for key, g := range b.groups {
+		if !g.hasAddrs {
+			continue
+		}
+		if key != defaultGroup {
+			p.groups[key] = g.state.Picker
+		}
+		switch g.state.ConnectivityState {
+		case connectivity.Ready:
+			ready = true
+		case connectivity.Connecting:
+			connecting = true
+		case connectivity.Idle:
+			idle = true
+		}
+	}
+	state := connectivity.TransientFailure
+	if ready {
+		state = connectivity.Ready
+	} else if connecting {
+		state = connectivity.Connecting
+	} else if idle {
+		state = connectivity.Idle
+	}
+
+	b.cc.UpdateState(balancer.State{ConnectivityState: state, Picker: p})
+}
+
+//groupClientConn 记录SubConn所属的分组，并合并picker
+type groupClientConn struct {
+	balancer.ClientConn
+	b *routeBalancer
+	g *group
+}
+
+func (cc *groupClientConn) NewSubConn(addrs []resolver.Address, opts balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	sc, err := cc.ClientConn.NewSubConn(addrs, opts)
+	if err != nil {
+		return sc, err
+	}
+	cc.b.stateLock.Lock()
+	cc.b.subConns[sc] = cc.g
+	cc.b.stateLock.Unlock()
+
+	return sc, nil
+}
+
+func (cc *groupClientConn) RemoveSubConn(sc balancer.SubConn) {
+	cc.b.stateLock.Lock()
+	delete(cc.b.subConns, sc)
+	cc.b.stateLock.Unlock()
+	cc.ClientConn.RemoveSubConn(sc)
+}
+
+func (cc *groupClientConn) UpdateState(state balancer.State) {
+	cc.b.stateLock.Lock()
+	//已经被删除的分组
+	if cc.b.groups[cc.g.key] != cc.g {
+		cc.b.stateLock.Unlock()
+		return
+	}
+	cc.g.state = state
+	cc.b.stateLock.Unlock()
+
+	cc.b.updateState()
+}
+
+type picker struct {
+	conf   *LBConfig
+	def    balancer.Picker
+	groups map[string]balancer.Picker
+}
+
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	md, _ := metadata.FromOutgoingContext(info.Ctx)
+	i := dc.MatchRoute(p.conf.Rules, func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[len(v)-1]
+		}
+		return ""
+	})
+	if i >= 0 {
+		//规则的分组没有节点时，使用默认分组
+		if gp, ok := p.groups[p.conf.ruleGroups[i]]; ok {
+			return gp.Pick(info)
+		}
+	}
+
+	return p.def.Pick(info)
+}
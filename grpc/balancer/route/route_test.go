@@ -0,0 +1,95 @@
+package route
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+func startServer(t *testing.T) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+
+	return lis.Addr().String(), s.Stop
+}
+
+func TestRoute(t *testing.T) {
+	var addrs []resolver.Address
+	for i := 0; i < 3; i++ {
+		addr, stop := startServer(t)
+		defer stop()
+		version := "v1"
+		if i == 0 {
+			version = "v2"
+		}
+		addrs = append(addrs, dc.SetAddressMeta(resolver.Address{Addr: addr}, map[string]string{dc.VersionKey: version}))
+	}
+	canary := addrs[0].Addr
+
+	r := manual.NewBuilderWithScheme("route")
+	r.InitialState(resolver.State{Addresses: addrs})
+	lbConfig, err := ServiceConfig([]configs.GrpcRouteConfig{{
+		Headers: map[string]string{"x-canary": "1"},
+		Meta:    map[string]string{dc.VersionKey: "v2"},
+	}}, roundrobin.Name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.Dial(r.Scheme()+":///test", grpc.WithInsecure(), grpc.WithResolvers(r),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig":`+lbConfig+`}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := healthpb.NewHealthClient(conn)
+	call := func(ctx context.Context) string {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		var p peer.Peer
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true), grpc.Peer(&p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.Addr.String()
+	}
+
+	called := make(map[string]int)
+	for i := 0; i < 20; i++ {
+		called[call(context.Background())]++
+	}
+	if called[canary] > 0 || len(called) != 2 {
+		t.Fatalf("normal requests should not call canary: %v", called)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-canary", "1")
+	for i := 0; i < 10; i++ {
+		if addr := call(ctx); addr != canary {
+			t.Fatalf("canary request called %s, want %s", addr, canary)
+		}
+	}
+
+	//灰度节点下线后，命中规则的请求使用其他节点
+	r.UpdateState(resolver.State{Addresses: addrs[1:]})
+	time.Sleep(100 * time.Millisecond)
+	if addr := call(ctx); addr == canary {
+		t.Fatalf("canary request should fallback after canary removed")
+	}
+}
@@ -0,0 +1,97 @@
+//Package wrr 平滑加权轮询，权重来自resolver.Address的Attributes
+//consul注册时在tag或者meta里加weight=N，静态地址用host:port?weight=N
+package wrr
+
+import (
+	"sync"
+
+	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+const Name = "weighted_round_robin"
+
+func init() {
+	balancer.Register(newBuilder())
+}
+
+type wrrPickerBuilder struct {
+}
+
+func newBuilder() balancer.Builder {
+	return base.NewBalancerBuilder(Name, new(wrrPickerBuilder), base.Config{HealthCheck: true})
+}
+
+func (b *wrrPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	conns := make([]*Node, 0, len(info.ReadySCs))
+	for conn, connInfo := range info.ReadySCs {
+		conns = append(conns, NewNode(conn, connInfo.Address))
+	}
+
+	return NewPicker(conns)
+}
+
+//Node 可以被其他balancer复用
+type Node struct {
+	Addr    resolver.Address
+	SubConn balancer.SubConn
+	Weight  int
+
+	current int
+}
+
+func NewNode(sc balancer.SubConn, addr resolver.Address) *Node {
+	return &Node{
+		Addr:    addr,
+		SubConn: sc,
+		Weight:  dc.GetAddressWeight(addr),
+	}
+}
+
+//Picker 同nginx的平滑加权轮询
+type Picker struct {
+	nodes []*Node
+	total int
+	lock  sync.Mutex
+}
+
+func NewPicker(nodes []*Node) *Picker {
+	p := &Picker{nodes: nodes}
+	for _, n := range nodes {
+		p.total += n.Weight
+	}
+	return p
+}
+
+func (p *Picker) Pick(info balancer.PickInfo) (result balancer.PickResult, err error) {
+	n := p.Next()
+	if n == nil {
+		return result, balancer.ErrNoSubConnAvailable
+	}
+
+	return balancer.PickResult{SubConn: n.SubConn}, nil
+}
+
+func (p *Picker) Next() *Node {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var best *Node
+	for _, n := range p.nodes {
+		n.current += n.Weight
+		if best == nil || n.current > best.current {
+			best = n
+		}
+	}
+	if best != nil {
+		best.current -= p.total
+	}
+
+	return best
+}
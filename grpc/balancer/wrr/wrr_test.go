@@ -0,0 +1,44 @@
+package wrr
+
+import (
+	"testing"
+
+	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+type testSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for _, s := range []string{"a:1?weight=50", "b:1?weight=150", "c:1"} {
+		addr := dc.ParseStaticAddress(s)
+		info.ReadySCs[&testSubConn{addr: addr.Addr}] = base.SubConnInfo{Address: addr}
+	}
+	p := new(wrrPickerBuilder).Build(info)
+
+	count := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		result, err := p.Pick(balancer.PickInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		count[result.SubConn.(*testSubConn).addr]++
+	}
+	if count["a:1"] != 50 || count["b:1"] != 150 || count["c:1"] != 100 {
+		t.Fatalf("unexpected count: %v", count)
+	}
+
+	addr := dc.NewAddress("d:1", []string{"weight=20", "zone=bj-a", "other"}, map[string]string{"zone": "bj-b"})
+	if dc.GetAddressWeight(addr) != 20 || dc.GetAddressZone(addr) != "bj-b" {
+		t.Fatalf("unexpected attributes: %v", addr.Attributes)
+	}
+	if dc.GetAddressWeight(resolver.Address{Addr: "e:1"}) != dc.DefaultWeight {
+		t.Fatal("default weight")
+	}
+}
@@ -0,0 +1,74 @@
+//Package zoneaware 优先调用同区域的节点，同区域没有可用节点时调用其他区域
+//节点的区域来自resolver.Address的Attributes，如consul的tag zone=bj-a
+//本地区域默认取GrpcServer.Zone或者Server.Zone，也可以用SetLocalZone指定
+//区域内使用平滑加权轮询
+package zoneaware
+
+import (
+	"sync"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/grpc/balancer/wrr"
+	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+const Name = "zone_aware"
+
+var (
+	localZone string
+	zoneLock  = new(sync.RWMutex)
+)
+
+func init() {
+	balancer.Register(newBuilder())
+}
+
+//SetLocalZone 指定本地区域，优先于配置
+func SetLocalZone(zone string) {
+	zoneLock.Lock()
+	defer zoneLock.Unlock()
+	localZone = zone
+}
+
+func LocalZone() string {
+	zoneLock.RLock()
+	defer zoneLock.RUnlock()
+	if localZone != "" {
+		return localZone
+	}
+	if configs.Config.GrpcServer.Zone != "" {
+		return configs.Config.GrpcServer.Zone
+	}
+	return configs.Config.Server.Zone
+}
+
+type zonePickerBuilder struct {
+}
+
+func newBuilder() balancer.Builder {
+	return base.NewBalancerBuilder(Name, new(zonePickerBuilder), base.Config{HealthCheck: true})
+}
+
+//Build 只用ready的节点，所以同区域的节点都不可用时会自动切到其他区域
+func (b *zonePickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	zone := LocalZone()
+	var local, all []*wrr.Node
+	for conn, connInfo := range info.ReadySCs {
+		n := wrr.NewNode(conn, connInfo.Address)
+		all = append(all, n)
+		if zone != "" && dc.GetAddressZone(connInfo.Address) == zone {
+			local = append(local, n)
+		}
+	}
+	if len(local) > 0 {
+		return wrr.NewPicker(local)
+	}
+
+	return wrr.NewPicker(all)
+}
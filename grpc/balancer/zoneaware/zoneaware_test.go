@@ -0,0 +1,64 @@
+package zoneaware
+
+import (
+	"testing"
+
+	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+type testSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+//build zones是地址对应的区域，只包含ready的节点
+func build(zones map[string]string) balancer.Picker {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for addr, zone := range zones {
+		a := dc.NewAddress(addr, nil, map[string]string{"zone": zone})
+		info.ReadySCs[&testSubConn{addr: addr}] = base.SubConnInfo{Address: a}
+	}
+	return new(zonePickerBuilder).Build(info)
+}
+
+func pickCount(t *testing.T, p balancer.Picker, n int) map[string]int {
+	count := make(map[string]int)
+	for i := 0; i < n; i++ {
+		result, err := p.Pick(balancer.PickInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		count[result.SubConn.(*testSubConn).addr]++
+	}
+	return count
+}
+
+func TestZoneAware(t *testing.T) {
+	defer SetLocalZone("")
+	SetLocalZone("bj-a")
+
+	//只选同区域的节点
+	count := pickCount(t, build(map[string]string{"a:1": "bj-a", "a:2": "bj-a", "b:1": "bj-b"}), 100)
+	if count["a:1"] != 50 || count["a:2"] != 50 || count["b:1"] != 0 {
+		t.Fatalf("unexpected count: %v", count)
+	}
+
+	//同区域的节点不可用时不在ReadySCs里，使用其他区域
+	count = pickCount(t, build(map[string]string{"b:1": "bj-b", "c:1": "sh-a"}), 100)
+	if count["b:1"] != 50 || count["c:1"] != 50 {
+		t.Fatalf("unexpected fallback count: %v", count)
+	}
+
+	//没有本地区域时使用全部节点
+	SetLocalZone("")
+	count = pickCount(t, build(map[string]string{"a:1": "bj-a", "b:1": "bj-b"}), 100)
+	if count["a:1"] != 50 || count["b:1"] != 50 {
+		t.Fatalf("unexpected count without local zone: %v", count)
+	}
+
+	if _, err := build(nil).Pick(balancer.PickInfo{}); err != balancer.ErrNoSubConnAvailable {
+		t.Fatalf("want ErrNoSubConnAvailable got %v", err)
+	}
+}
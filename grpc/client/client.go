@@ -10,6 +10,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"time"
@@ -71,6 +72,35 @@ func NewClientConnWithSecurity(ctx context.Context, address, certFile, serverNam
 	return grpc.DialContext(ctx, address, opt...)
 }
 
+//双向认证(mTLS)，certFile和keyFile是客户端证书，caFile用于验证服务端证书
+func NewClientConnWithMutualTLS(ctx context.Context, address, caFile, certFile, keyFile, serverName string,
+	opt ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if len(address) == 0 || len(serverName) == 0 {
+		return nil, errors.New("nil address or serverName")
+	}
+	for _, file := range []string{caFile, certFile, keyFile} {
+		if !common.IsExist(file) {
+			return nil, fmt.Errorf("file: %s not exist", file)
+		}
+	}
+
+	t := &ClientCreds{
+		ServerName: serverName,
+		CaFile:     caFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+	}
+
+	creds, err := t.GetCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	opt = append(opt, grpc.WithTransportCredentials(creds), grpc.WithKeepaliveParams(kacp))
+
+	return grpc.DialContext(ctx, address, opt...)
+}
+
 func (t *ClientCreds) GetCredentials() (credentials.TransportCredentials, error) {
 	if len(t.CaFile) > 0 {
 		return t.GetCredentialsByCA()
@@ -92,7 +122,7 @@ func (t *ClientCreds) GetCredentialsByCA() (credentials.TransportCredentials, er
 	}
 
 	if ok := certPool.AppendCertsFromPEM(ca); !ok {
-		return nil, err
+		return nil, errors.New("certPool.AppendCertsFromPEM err")
 	}
 
 	c := credentials.NewTLS(&tls.Config{
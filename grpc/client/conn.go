@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"path/filepath"
@@ -11,12 +12,19 @@ import (
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/grpc/auth"
+	"github.com/hsyan2008/hfw/grpc/balancer/consistenthash"
+	"github.com/hsyan2008/hfw/grpc/balancer/outlier"
 	"github.com/hsyan2008/hfw/grpc/balancer/p2c"
+	"github.com/hsyan2008/hfw/grpc/balancer/route"
+	"github.com/hsyan2008/hfw/grpc/balancer/wrr"
+	"github.com/hsyan2008/hfw/grpc/balancer/zoneaware"
 	"github.com/hsyan2008/hfw/grpc/discovery"
 	"github.com/hsyan2008/hfw/grpc/discovery/resolver"
 	grpc "google.golang.org/grpc"
 	"google.golang.org/grpc/balancer/roundrobin"
 	"google.golang.org/grpc/codes"
+	//注册客户端的健康检查
+	_ "google.golang.org/grpc/health"
 	"google.golang.org/grpc/status"
 )
 
@@ -112,12 +120,20 @@ func newClientConn(ctx context.Context, address string, c configs.GrpcConfig, au
 		switch c.BalancerName {
 		case "round_robin":
 			c.BalancerName = roundrobin.Name
-		case "pick_first":
+		case "pick_first", wrr.Name, zoneaware.Name, consistenthash.Name:
 		default:
 			// 现在默认是p2c
 			c.BalancerName = p2c.Name
 		}
-		opts = append(opts, grpc.WithBalancerName(c.BalancerName))
+		if c.HealthCheck.IsEnable || c.OutlierDetection.IsEnable || len(c.Routes) > 0 {
+			sc, err := serviceConfig(c)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, grpc.WithDefaultServiceConfig(sc))
+		} else {
+			opts = append(opts, grpc.WithBalancerName(c.BalancerName))
+		}
 	}
 	if len(c.CertFile) > 0 && !filepath.IsAbs(c.CertFile) {
 		c.CertFile = filepath.Join(common.GetAppPath(), c.CertFile)
@@ -125,6 +141,26 @@ func newClientConn(ctx context.Context, address string, c configs.GrpcConfig, au
 			return nil, fmt.Errorf("cert file: %s not exist", c.CertFile)
 		}
 	}
+	if len(c.KeyFile) > 0 && !filepath.IsAbs(c.KeyFile) {
+		c.KeyFile = filepath.Join(common.GetAppPath(), c.KeyFile)
+	}
+	if len(c.CaFile) > 0 && !filepath.IsAbs(c.CaFile) {
+		c.CaFile = filepath.Join(common.GetAppPath(), c.CaFile)
+	}
+	//双向认证
+	if len(c.ServerName) > 0 && len(c.CaFile) > 0 && len(c.KeyFile) > 0 {
+		if c.IsAuth {
+			opts = append(opts, grpc.WithPerRPCCredentials(auth.NewAuthWithHTTPS(authValue)))
+		}
+		return NewClientConnWithMutualTLS(
+			ctx,
+			address,
+			c.CaFile,
+			c.CertFile,
+			c.KeyFile,
+			c.ServerName,
+			opts...)
+	}
 	if len(c.ServerName) > 0 && len(c.CertFile) > 0 && common.IsExist(c.CertFile) {
 		if c.IsAuth {
 			opts = append(opts, grpc.WithPerRPCCredentials(auth.NewAuthWithHTTPS(authValue)))
@@ -143,3 +179,29 @@ func newClientConn(ctx context.Context, address string, c configs.GrpcConfig, au
 
 	return NewClientConn(ctx, address, opts...)
 }
+
+//serviceConfig 健康检查、异常节点摘除和路由需要通过service config配置
+func serviceConfig(c configs.GrpcConfig) (string, error) {
+	policy, policyConfig := c.BalancerName, json.RawMessage("{}")
+	if c.OutlierDetection.IsEnable {
+		b, err := json.Marshal(outlier.LBConfig{OutlierDetectionConfig: c.OutlierDetection, ChildPolicy: policy})
+		if err != nil {
+			return "", err
+		}
+		policy, policyConfig = outlier.Name, b
+	}
+	lbConfig := fmt.Sprintf(`[{"%s":%s}]`, policy, policyConfig)
+	if len(c.Routes) > 0 {
+		var err error
+		lbConfig, err = route.ServiceConfig(c.Routes, policy, policyConfig)
+		if err != nil {
+			return "", err
+		}
+	}
+	sc := fmt.Sprintf(`{"loadBalancingConfig":%s`, lbConfig)
+	if c.HealthCheck.IsEnable {
+		sc += fmt.Sprintf(`,"healthCheckConfig":{"serviceName":%q}`, c.HealthCheck.ServiceName)
+	}
+
+	return sc + "}", nil
+}
@@ -2,28 +2,40 @@ package client
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/hsyan2008/hfw"
+	"github.com/hsyan2008/hfw/breaker"
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
+	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
 	"github.com/hsyan2008/hfw/signal"
 	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
-)
-
-var (
-	retry = 3
+	"google.golang.org/grpc/status"
 )
 
 //如果有特殊需求，请自行修改
 //如GetConn里的authValue，这里是空
 //如GetConn里的grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(52428800))
 //           和grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(52428800))
+//重试策略见c.Retry，单次调用可以用DoWithCallOptions修改
+//默认只重试Unavailable，不是grpc状态码的错误不再重试，需要时用WithIdempotent和WithRetryableCodes(codes.Unknown)
 func Do(httpCtx *hfw.HTTPContext, c configs.GrpcConfig,
 	call func(ctx context.Context, conn *grpc.ClientConn) (interface{}, error),
 	timeout time.Duration, opts ...grpc.DialOption,
 ) (resp interface{}, err error) {
+	return DoWithCallOptions(httpCtx, c, call, timeout, nil, opts...)
+}
+
+//DoWithCallOptions 同Do，callOpts用于修改本次调用的重试策略
+//如client.DoWithCallOptions(httpCtx, c, call, timeout, []client.CallOption{client.WithHedging(50*time.Millisecond)})
+func DoWithCallOptions(httpCtx *hfw.HTTPContext, c configs.GrpcConfig,
+	call func(ctx context.Context, conn *grpc.ClientConn) (interface{}, error),
+	timeout time.Duration, callOpts []CallOption, opts ...grpc.DialOption,
+) (resp interface{}, err error) {
 
 	if httpCtx == nil {
 		return nil, common.NewRespErr(500, "nil httpCtx")
@@ -34,14 +46,6 @@ func Do(httpCtx *hfw.HTTPContext, c configs.GrpcConfig,
 			c.ServerName, time.Since(t))
 	}(time.Now())
 
-	var retryNum int
-	if len(c.Addresses) > 0 {
-		retryNum = common.Min(retry, len(c.Addresses)+1)
-	} else {
-		//服务发现下，len是0
-		retryNum = retry
-	}
-
 	var conn *grpc.ClientConn
 	if c.IsAuth {
 		opts = append([]grpc.DialOption{
@@ -63,40 +67,238 @@ func Do(httpCtx *hfw.HTTPContext, c configs.GrpcConfig,
 	if ok == false {
 		md = metadata.MD{}
 	}
+	//路由规则用到的请求头，从上游的http请求透传
+	if httpCtx.Request != nil {
+		for _, k := range dc.RouteHeaders(c.Routes) {
+			if v := httpCtx.Request.Header.Get(k); v != "" && len(md.Get(k)) == 0 {
+				md.Set(k, v)
+			}
+		}
+	}
+
+	policy := newCallOptions(c, callOpts...)
+	r := &retryer{
+		httpCtx: httpCtx,
+		c:       c,
+		conn:    conn,
+		call:    call,
+		md:      md,
+		policy:  policy,
+		budget:  getRetryBudget(c),
+		breaker: getBreaker(c, policy),
+	}
+	if r.policy.Hedging && r.policy.MaxAttempts > 1 {
+		resp, err = r.hedge(ctx)
+	} else {
+		resp, err = r.retry(ctx)
+	}
+	if err != nil && policy.fallback != nil && (errors.Is(err, breaker.ErrOpen) || isBreakerFailure(err)) {
+		httpCtx.Warnf("Call Grpc:%s Fallback Err:%v", c.ServerName, err)
+		resp, err = policy.fallback(err)
+	}
+	if err != nil {
+		if _, ok := err.(*common.RespErr); !ok {
+			err = common.NewRespErr(500, err)
+		}
+	}
+
+	return
+}
+
+type retryer struct {
+	httpCtx *hfw.HTTPContext
+	c       configs.GrpcConfig
+	conn    *grpc.ClientConn
+	call    func(ctx context.Context, conn *grpc.ClientConn) (interface{}, error)
+	md      metadata.MD
+	policy  *callOptions
+	budget  *retryBudget
+	breaker *breaker.Breaker
+}
+
+type attemptResult struct {
+	resp interface{}
+	err  error
+	//单次尝试超时，整体没有超时
+	attemptTimeout bool
+}
+
+//attempt 第i次尝试，ctx是整体的ctx
+func (r *retryer) attempt(ctx context.Context, i int) (ret attemptResult) {
+	httpCtx := hfw.NewHTTPContextWithCtx(r.httpCtx)
+	defer func(t time.Time) {
+		httpCtx.Infof("Call Grpc:%s TryTime:%d CostTime:%s",
+			r.c.ServerName, i, time.Since(t))
+		httpCtx.Cancel()
+	}(time.Now())
+
+	attemptCtx := ctx
+	if r.policy.PerAttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, r.policy.PerAttemptTimeout)
+		defer cancel()
+	}
 
-	for i := 0; i < retryNum; i++ {
+	if r.breaker != nil {
+		done, err := r.breaker.Allow()
+		if err != nil {
+			ret.err = err
+			httpCtx.Warnf("Call Grpc:%s TryTime:%d Err:%v", r.c.ServerName, i, err)
+			return
+		}
+		defer func() {
+			done(!isBreakerFailure(ret.err))
+		}()
+	}
+
+	//对冲时会并发，每次尝试用单独的md
+	md := r.md.Copy()
+	md.Set(common.GrpcTraceIDKey, httpCtx.GetTraceID())
+	ret.resp, ret.err = r.call(metadata.NewOutgoingContext(attemptCtx, md), r.conn)
+	if ret.err == nil {
+		r.budget.onSuccess()
+		return
+	}
+	ret.attemptTimeout = ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded
+	httpCtx.Warnf("Call Grpc:%s TryTime:%d Err:%v", r.c.ServerName, i, ret.err)
+
+	return
+}
+
+//canRetry 判断失败后是否可以继续尝试
+func (r *retryer) canRetry(ctx context.Context, ret attemptResult) bool {
+	if ctx.Err() != nil || ret.err == context.Canceled || ret.err == context.DeadlineExceeded {
+		return false
+	}
+	if _, ok := ret.err.(*common.RespErr); ok {
+		return false
+	}
+	if errors.Is(ret.err, breaker.ErrOpen) {
+		return false
+	}
+	if !r.policy.isRetryable(ret.err, ret.attemptTimeout) {
+		return false
+	}
+	r.budget.onFailure()
+
+	return r.budget.allow()
+}
+
+func (r *retryer) retry(ctx context.Context) (resp interface{}, err error) {
+	for i := 0; i < r.policy.MaxAttempts; i++ {
+		if i > 0 {
+			if err := sleepCtx(ctx, r.policy.backoff(i)); err != nil {
+				return nil, err
+			}
+		}
 		select {
 		case <-ctx.Done():
-			return nil, common.NewRespErr(500, ctx.Err())
+			return nil, ctx.Err()
 		default:
-			err = func(httpCtx2 *hfw.HTTPContext) (err error) {
-				httpCtx := hfw.NewHTTPContextWithCtx(httpCtx2)
-				defer func(t time.Time) {
-					httpCtx.Infof("Call Grpc:%s TryTime:%d CostTime:%s",
-						c.ServerName, i, time.Since(t))
-					httpCtx.Cancel()
-				}(time.Now())
-				md.Set(common.GrpcTraceIDKey, httpCtx.GetTraceID())
-				newCtx := metadata.NewOutgoingContext(ctx, md)
-				resp, err = call(newCtx, conn)
-				if err == nil {
-					return
-				}
-				httpCtx.Warnf("Call Grpc:%s TryTime:%d Err:%v", c.ServerName, i, err)
-				// removeClientConn(c, err)
-				return
-			}(httpCtx)
-			if err == nil || err == context.Canceled || err == context.DeadlineExceeded {
+		}
+		ret := r.attempt(ctx, i)
+		if ret.err == nil {
+			return ret.resp, nil
+		}
+		err = ret.err
+		if !r.canRetry(ctx, ret) {
+			return
+		}
+	}
+
+	return
+}
+
+//hedge 先发起一次请求，超过HedgingDelay没有返回或者返回了可重试的错误，就再发起一次
+//第一个成功的结果返回，其他的请求取消
+func (r *retryer) hedge(ctx context.Context) (resp interface{}, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	//带缓冲，取消后未读取的结果不会阻塞
+	results := make(chan attemptResult, r.policy.MaxAttempts)
+	started, finished := 0, 0
+	start := func() {
+		i := started
+		started++
+		go func() {
+			results <- r.attempt(ctx, i)
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(r.policy.HedgingDelay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			if started < r.policy.MaxAttempts && r.budget.allow() {
+				start()
+				timer.Reset(r.policy.HedgingDelay)
+			}
+		case ret := <-results:
+			finished++
+			if ret.err == nil {
+				return ret.resp, nil
+			}
+			err = ret.err
+			if !r.canRetry(ctx, ret) {
 				return
 			}
-			if _, ok := err.(*common.RespErr); ok {
+			if started < r.policy.MaxAttempts {
+				start()
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(r.policy.HedgingDelay)
+			} else if finished == started {
 				return
 			}
 		}
 	}
-	if err != nil {
-		err = common.NewRespErr(500, err)
+}
+
+//getBreaker GrpcConfig里开启了熔断则使用，否则使用全局的配置
+func getBreaker(c configs.GrpcConfig, policy *callOptions) *breaker.Breaker {
+	if policy.withoutBreaker {
+		return nil
+	}
+	if c.Breaker.IsEnable {
+		return breaker.GetWithConfig(c.ServerName, c.Breaker)
+	}
+	if breaker.IsEnable() {
+		return breaker.Get(c.ServerName)
 	}
 
-	return
+	return nil
+}
+
+//isBreakerFailure 只有服务端异常才算失败，业务错误不算
+func isBreakerFailure(err error) bool {
+	if err == nil || err == context.Canceled {
+		return false
+	}
+	if _, ok := err.(*common.RespErr); ok {
+		return false
+	}
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return true
+	}
+	switch s.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted,
+		codes.Internal, codes.Unknown, codes.DataLoss:
+		return true
+	}
+
+	return false
 }
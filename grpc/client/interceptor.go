@@ -4,9 +4,12 @@ import (
 	"context"
 
 	"github.com/hsyan2008/hfw"
+	"github.com/hsyan2008/hfw/accesslog"
 	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -16,6 +19,12 @@ func UnaryClientInterceptor(ctx context.Context, method string, req, reply inter
 	httpCtx := hfw.NewHTTPContextWithGrpcOutgoingCtx(ctx)
 	defer httpCtx.Cancel()
 	httpCtx.AppendPrefix("Method:" + method)
+	accesslog.AddUpstream(ctx)
+
+	span := startClientSpan(httpCtx, method)
+	defer func() {
+		endClientSpan(span, err)
+	}()
 
 	httpCtx.Debug("Req:", req)
 	defer func() {
@@ -43,6 +52,13 @@ func StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grp
 	httpCtx := hfw.NewHTTPContextWithGrpcOutgoingCtx(ctx)
 	defer httpCtx.Cancel()
 	httpCtx.AppendPrefix("Method:" + method)
+	accesslog.AddUpstream(ctx)
+
+	//只记录建立stream的耗时
+	span := startClientSpan(httpCtx, method)
+	defer func() {
+		endClientSpan(span, err)
+	}()
 
 	defer func() {
 		if e := recover(); e != nil {
@@ -52,3 +68,28 @@ func StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grp
 
 	return streamer(httpCtx, desc, cc, method, opts...)
 }
+
+//startClientSpan 每次调用(包括重试)一个span，通过metadata的traceparent传递给服务端
+func startClientSpan(httpCtx *hfw.HTTPContext, method string) *trace.Span {
+	ctx, span := trace.Start(httpCtx.Ctx, method, trace.SpanKindClient)
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.method", method)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		md = md.Copy()
+		md.Set(trace.TraceparentKey, sc.Traceparent())
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	httpCtx.Ctx = ctx
+
+	return span
+}
+
+func endClientSpan(span *trace.Span, err error) {
+	code := status.Code(err)
+	span.SetAttribute("rpc.grpc.status_code", int(code))
+	if code != codes.OK {
+		span.SetError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,278 @@
+package client
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//RetryPolicy 由configs.RetryConfig和CallOption生成
+type RetryPolicy struct {
+	MaxAttempts       int
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	Jitter            float64
+	RetryableCodes    []codes.Code
+	PerAttemptTimeout time.Duration
+	Idempotent        bool
+	Hedging           bool
+	HedgingDelay      time.Duration
+}
+
+//callOptions 单次调用的选项
+type callOptions struct {
+	RetryPolicy
+	//熔断或者失败时调用
+	fallback func(error) (interface{}, error)
+	//不使用熔断
+	withoutBreaker bool
+}
+
+//CallOption 单次调用修改重试策略、熔断等
+type CallOption func(*callOptions)
+
+func WithMaxAttempts(n int) CallOption {
+	return func(p *callOptions) {
+		p.MaxAttempts = n
+	}
+}
+
+//WithoutRetry 不重试
+func WithoutRetry() CallOption {
+	return WithMaxAttempts(1)
+}
+
+func WithBackoff(initial, max time.Duration, multiplier float64) CallOption {
+	return func(p *callOptions) {
+		p.InitialBackoff = initial
+		p.MaxBackoff = max
+		p.BackoffMultiplier = multiplier
+	}
+}
+
+func WithRetryableCodes(c ...codes.Code) CallOption {
+	return func(p *callOptions) {
+		p.RetryableCodes = c
+	}
+}
+
+func WithPerAttemptTimeout(timeout time.Duration) CallOption {
+	return func(p *callOptions) {
+		p.PerAttemptTimeout = timeout
+	}
+}
+
+//WithIdempotent 标记为幂等调用
+func WithIdempotent() CallOption {
+	return func(p *callOptions) {
+		p.Idempotent = true
+	}
+}
+
+//WithHedging 幂等的读请求，超过delay没返回就并行发起新的请求
+func WithHedging(delay time.Duration) CallOption {
+	return func(p *callOptions) {
+		p.Idempotent = true
+		p.Hedging = true
+		p.HedgingDelay = delay
+	}
+}
+
+var (
+	retry = 3
+
+	defaultInitialBackoff    = 50 * time.Millisecond
+	defaultMaxBackoff        = time.Second
+	defaultBackoffMultiplier = 2.0
+	defaultJitter            = 0.2
+	defaultHedgingDelay      = 100 * time.Millisecond
+)
+
+//WithFallback 熔断或者调用失败(不包括RespErr)时调用，返回值作为Do的结果
+func WithFallback(f func(error) (interface{}, error)) CallOption {
+	return func(p *callOptions) {
+		p.fallback = f
+	}
+}
+
+//WithoutBreaker 本次调用不使用熔断
+func WithoutBreaker() CallOption {
+	return func(p *callOptions) {
+		p.withoutBreaker = true
+	}
+}
+
+func newCallOptions(c configs.GrpcConfig, opts ...CallOption) *callOptions {
+	rc := c.Retry
+	p := &callOptions{}
+	p.RetryPolicy = RetryPolicy{
+		MaxAttempts:       rc.MaxAttempts,
+		InitialBackoff:    time.Duration(rc.InitialBackoff) * time.Millisecond,
+		MaxBackoff:        time.Duration(rc.MaxBackoff) * time.Millisecond,
+		BackoffMultiplier: rc.BackoffMultiplier,
+		Jitter:            rc.Jitter,
+		PerAttemptTimeout: time.Duration(rc.PerAttemptTimeout) * time.Millisecond,
+		Idempotent:        rc.Idempotent,
+		Hedging:           rc.Hedging,
+		HedgingDelay:      time.Duration(rc.HedgingDelay) * time.Millisecond,
+	}
+	for _, v := range rc.RetryableCodes {
+		if code, ok := parseCode(v); ok {
+			p.RetryableCodes = append(p.RetryableCodes, code)
+		}
+	}
+
+	if p.MaxAttempts <= 0 {
+		if len(c.Addresses) > 0 {
+			p.MaxAttempts = common.Min(retry, len(c.Addresses)+1)
+		} else {
+			//服务发现下，len是0
+			p.MaxAttempts = retry
+		}
+	}
+
+	for _, f := range opts {
+		f(p)
+	}
+
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultMaxBackoff
+	}
+	if p.BackoffMultiplier < 1 {
+		p.BackoffMultiplier = defaultBackoffMultiplier
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = defaultJitter
+	}
+	if len(p.RetryableCodes) == 0 {
+		p.RetryableCodes = []codes.Code{codes.Unavailable}
+	}
+	if p.HedgingDelay <= 0 {
+		p.HedgingDelay = defaultHedgingDelay
+	}
+	if !p.Idempotent {
+		p.Hedging = false
+	}
+
+	return p
+}
+
+//isRetryable attemptTimeout表示是单次尝试超时，而不是整体超时
+func (p *RetryPolicy) isRetryable(err error, attemptTimeout bool) bool {
+	code := status.Code(err)
+	if !p.Idempotent {
+		//非幂等的调用，只有Unavailable可以认为请求没有被处理
+		return code == codes.Unavailable
+	}
+	if attemptTimeout {
+		return true
+	}
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+//backoff 第n次重试前等待的时间，n从1开始
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.BackoffMultiplier, float64(n-1))
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	d = d * (1 + p.Jitter*(rand.Float64()*2-1))
+
+	return time.Duration(d)
+}
+
+func parseCode(s string) (codes.Code, bool) {
+	name := strings.ToLower(strings.ReplaceAll(s, "_", ""))
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if strings.ToLower(c.String()) == name {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+//retryBudget 参考grpc的retryThrottling，按服务限制重试
+type retryBudget struct {
+	maxTokens  float64
+	tokenRatio float64
+	tokens     float64
+	lock       sync.Mutex
+}
+
+var retryBudgetMap = new(sync.Map)
+
+func getRetryBudget(c configs.GrpcConfig) *retryBudget {
+	if c.Retry.BudgetMaxTokens <= 0 {
+		return nil
+	}
+	if b, ok := retryBudgetMap.Load(c.ServerName); ok {
+		return b.(*retryBudget)
+	}
+	ratio := c.Retry.BudgetTokenRatio
+	if ratio <= 0 {
+		ratio = 0.1
+	}
+	b, _ := retryBudgetMap.LoadOrStore(c.ServerName, &retryBudget{
+		maxTokens:  c.Retry.BudgetMaxTokens,
+		tokenRatio: ratio,
+		tokens:     c.Retry.BudgetMaxTokens,
+	})
+
+	return b.(*retryBudget)
+}
+
+func (b *retryBudget) onSuccess() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	b.tokens = math.Min(b.tokens+b.tokenRatio, b.maxTokens)
+	b.lock.Unlock()
+}
+
+func (b *retryBudget) onFailure() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	b.tokens = math.Max(b.tokens-1, 0)
+	b.lock.Unlock()
+}
+
+//allow 令牌多于一半才允许重试
+func (b *retryBudget) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.tokens > b.maxTokens/2
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
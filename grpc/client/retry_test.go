@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw"
+	"github.com/hsyan2008/hfw/configs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	c := configs.GrpcConfig{Addresses: []string{"127.0.0.1:1"}}
+	p := newCallOptions(c)
+	if p.MaxAttempts != 2 {
+		t.Fatalf("want:2 got:%d", p.MaxAttempts)
+	}
+	if !p.isRetryable(status.Error(codes.Unavailable, ""), false) {
+		t.Fatal("Unavailable should be retryable")
+	}
+	if p.isRetryable(status.Error(codes.ResourceExhausted, ""), false) ||
+		p.isRetryable(errors.New("x"), true) {
+		t.Fatal("non idempotent call should only retry Unavailable")
+	}
+
+	c.Retry.RetryableCodes = []string{"resource_exhausted", "Unavailable", "unknown_code"}
+	p = newCallOptions(c, WithHedging(time.Millisecond), WithMaxAttempts(4))
+	if p.MaxAttempts != 4 || !p.Hedging || len(p.RetryableCodes) != 2 {
+		t.Fatalf("unexpected policy: %+v", p)
+	}
+	if !p.isRetryable(status.Error(codes.ResourceExhausted, ""), false) ||
+		!p.isRetryable(status.Error(codes.DeadlineExceeded, ""), true) {
+		t.Fatal("idempotent call should retry configured codes and attempt timeout")
+	}
+
+	for i := 1; i < 10; i++ {
+		if d := p.backoff(i); d <= 0 || d > time.Duration(float64(p.MaxBackoff)*(1+p.Jitter)) {
+			t.Fatalf("backoff %d out of range: %s", i, d)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	c := configs.GrpcConfig{ServerName: "budget"}
+	c.Retry.BudgetMaxTokens = 4
+	b := getRetryBudget(c)
+	if b != getRetryBudget(c) {
+		t.Fatal("budget should be shared by service")
+	}
+	b.onFailure()
+	if !b.allow() {
+		t.Fatal("should allow retry")
+	}
+	b.onFailure()
+	if b.allow() {
+		t.Fatal("should not allow retry")
+	}
+	for i := 0; i < 10; i++ {
+		b.onSuccess()
+	}
+	if !b.allow() {
+		t.Fatal("should allow retry after success")
+	}
+}
+
+func newTestRetryer(c configs.GrpcConfig, call func(ctx context.Context, conn *grpc.ClientConn) (interface{}, error), opts ...CallOption) *retryer {
+	return &retryer{
+		httpCtx: hfw.NewHTTPContext(),
+		c:       c,
+		call:    call,
+		md:      metadata.MD{},
+		policy:  newCallOptions(c, opts...),
+		budget:  getRetryBudget(c),
+	}
+}
+
+func TestRetryLoop(t *testing.T) {
+	c := configs.GrpcConfig{ServerName: "retry_loop"}
+	c.Retry.InitialBackoff = 20
+	c.Retry.Jitter = 0.01
+
+	//失败2次后成功
+	var calls int32
+	r := newTestRetryer(c, func(ctx context.Context, conn *grpc.ClientConn) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			return nil, status.Error(codes.Unavailable, "unavailable")
+		}
+		return "ok", nil
+	})
+	start := time.Now()
+	resp, err := r.retry(context.Background())
+	if err != nil || resp != "ok" {
+		t.Fatalf("want ok got:%v %v", resp, err)
+	}
+	if calls != 3 {
+		t.Fatalf("want 3 calls got:%d", calls)
+	}
+	//退避20ms和40ms
+	if d := time.Since(start); d < 55*time.Millisecond {
+		t.Fatalf("backoff too short: %s", d)
+	}
+
+	//不可重试的状态码和普通的错误只调用一次
+	for _, e := range []error{status.Error(codes.InvalidArgument, ""), errors.New("x")} {
+		calls = 0
+		r = newTestRetryer(c, func(ctx context.Context, conn *grpc.ClientConn) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, e
+		})
+		if _, err = r.retry(context.Background()); err != e || calls != 1 {
+			t.Fatalf("%v: want 1 call got:%d %v", e, calls, err)
+		}
+	}
+
+	//和以前一样重试普通的错误
+	calls = 0
+	r = newTestRetryer(c, func(ctx context.Context, conn *grpc.ClientConn) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errors.New("x")
+	}, WithIdempotent(), WithRetryableCodes(codes.Unknown))
+	if _, err = r.retry(context.Background()); err == nil || calls != 3 {
+		t.Fatalf("want 3 calls got:%d %v", calls, err)
+	}
+}
+
+func TestRetryLoopBudget(t *testing.T) {
+	c := configs.GrpcConfig{ServerName: "retry_loop_budget"}
+	c.Retry.MaxAttempts = 5
+	c.Retry.InitialBackoff = 1
+	c.Retry.BudgetMaxTokens = 4
+
+	var calls int32
+	r := newTestRetryer(c, func(ctx context.Context, conn *grpc.ClientConn) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, status.Error(codes.Unavailable, "unavailable")
+	})
+	if _, err := r.retry(context.Background()); status.Code(err) != codes.Unavailable {
+		t.Fatalf("want Unavailable got:%v", err)
+	}
+	//4个令牌，失败2次后只剩一半，不再重试
+	if calls != 2 {
+		t.Fatalf("want 2 calls got:%d", calls)
+	}
+	if r.budget.tokens != 2 || r.budget.allow() {
+		t.Fatalf("unexpected budget tokens:%v", r.budget.tokens)
+	}
+}
+
+func TestHedge(t *testing.T) {
+	c := configs.GrpcConfig{ServerName: "hedge"}
+	c.Retry.MaxAttempts = 2
+
+	var calls int32
+	canceled := make(chan error, 1)
+	r := newTestRetryer(c, func(ctx context.Context, conn *grpc.ClientConn) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			//第一次一直不返回，直到被取消
+			<-ctx.Done()
+			canceled <- ctx.Err()
+			return nil, ctx.Err()
+		}
+		return "ok", nil
+	}, WithHedging(10*time.Millisecond))
+	if !r.policy.Hedging {
+		t.Fatal("hedging should be enabled")
+	}
+
+	resp, err := r.hedge(context.Background())
+	if err != nil || resp != "ok" {
+		t.Fatalf("want ok got:%v %v", resp, err)
+	}
+	select {
+	case err = <-canceled:
+		if err != context.Canceled {
+			t.Fatalf("losing attempt want Canceled got:%v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("losing attempt should be canceled")
+	}
+	if calls != 2 {
+		t.Fatalf("want 2 calls got:%d", calls)
+	}
+}
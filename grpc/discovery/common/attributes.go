@@ -0,0 +1,182 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+const (
+	//注册时tag或者meta里的key，如weight=10、zone=bj-a
+	WeightKey  = "weight"
+	ZoneKey    = "zone"
+	VersionKey = "version"
+
+	//没有配置权重的节点
+	DefaultWeight = 100
+)
+
+type weightAttrKey struct{}
+type zoneAttrKey struct{}
+type metaAttrKey struct{}
+type tagsAttrKey struct{}
+
+//SetAddressWeight 权重小于等于0则不设置
+func SetAddressWeight(addr resolver.Address, weight int) resolver.Address {
+	if weight <= 0 {
+		return addr
+	}
+	addr.Attributes = withValue(addr.Attributes, weightAttrKey{}, weight)
+	return addr
+}
+
+//GetAddressWeight 没有设置则返回DefaultWeight
+func GetAddressWeight(addr resolver.Address) int {
+	if addr.Attributes != nil {
+		if w, ok := addr.Attributes.Value(weightAttrKey{}).(int); ok && w > 0 {
+			return w
+		}
+	}
+	return DefaultWeight
+}
+
+func SetAddressZone(addr resolver.Address, zone string) resolver.Address {
+	if zone == "" {
+		return addr
+	}
+	addr.Attributes = withValue(addr.Attributes, zoneAttrKey{}, zone)
+	return addr
+}
+
+func GetAddressZone(addr resolver.Address) string {
+	if addr.Attributes != nil {
+		if z, ok := addr.Attributes.Value(zoneAttrKey{}).(string); ok {
+			return z
+		}
+	}
+	return ""
+}
+
+//SetAddressMeta 节点的全部元数据，用于路由
+func SetAddressMeta(addr resolver.Address, meta map[string]string) resolver.Address {
+	if len(meta) == 0 {
+		return addr
+	}
+	addr.Attributes = withValue(addr.Attributes, metaAttrKey{}, meta)
+	return addr
+}
+
+func GetAddressMeta(addr resolver.Address) map[string]string {
+	if addr.Attributes != nil {
+		if m, ok := addr.Attributes.Value(metaAttrKey{}).(map[string]string); ok {
+			return m
+		}
+	}
+	return nil
+}
+
+//SetAddressTags 节点注册时的tag，用于按多个tag过滤
+func SetAddressTags(addr resolver.Address, tags []string) resolver.Address {
+	if len(tags) == 0 {
+		return addr
+	}
+	addr.Attributes = withValue(addr.Attributes, tagsAttrKey{}, tags)
+	return addr
+}
+
+func GetAddressTags(addr resolver.Address) []string {
+	if addr.Attributes != nil {
+		if t, ok := addr.Attributes.Value(tagsAttrKey{}).([]string); ok {
+			return t
+		}
+	}
+	return nil
+}
+
+func withValue(a *attributes.Attributes, key, value interface{}) *attributes.Attributes {
+	if a == nil {
+		return attributes.New(key, value)
+	}
+	return a.WithValues(key, value)
+}
+
+//ParseMeta 合并tag里的key=value和meta，meta优先
+func ParseMeta(tags []string, meta map[string]string) map[string]string {
+	values := make(map[string]string)
+	for _, tag := range tags {
+		if pos := strings.IndexByte(tag, '='); pos > 0 {
+			values[tag[:pos]] = tag[pos+1:]
+		}
+	}
+	for k, v := range meta {
+		values[k] = v
+	}
+
+	return values
+}
+
+//NewAddress 从tag和meta里解析权重、区域和其他元数据，meta优先
+func NewAddress(addr string, tags []string, meta map[string]string) resolver.Address {
+	values := ParseMeta(tags, meta)
+
+	address := SetAddressMeta(resolver.Address{Addr: addr}, values)
+	address = SetAddressTags(address, tags)
+	if w, err := strconv.Atoi(values[WeightKey]); err == nil {
+		address = SetAddressWeight(address, w)
+	}
+	address = SetAddressZone(address, values[ZoneKey])
+
+	return address
+}
+
+//ParseStaticAddress 静态地址支持host:port?weight=10&zone=bj-a
+func ParseStaticAddress(s string) resolver.Address {
+	pos := strings.IndexByte(s, '?')
+	if pos < 0 {
+		return resolver.Address{Addr: s}
+	}
+	values, err := url.ParseQuery(s[pos+1:])
+	if err != nil {
+		return resolver.Address{Addr: s[:pos]}
+	}
+	meta := make(map[string]string)
+	for k := range values {
+		meta[k] = values.Get(k)
+	}
+
+	return NewAddress(s[:pos], nil, meta)
+}
+
+//RegisterMeta 注册时的元数据，包含版本、权重和区域
+func RegisterMeta(meta map[string]string, version string, weight int, zone string) map[string]string {
+	values := make(map[string]string)
+	for k, v := range meta {
+		values[k] = v
+	}
+	if version != "" {
+		values[VersionKey] = version
+	}
+	if weight > 0 {
+		values[WeightKey] = strconv.Itoa(weight)
+	}
+	if zone != "" {
+		values[ZoneKey] = zone
+	}
+	return values
+}
+
+//RegisterTags 注册时把权重和区域加到tag里
+func RegisterTags(tags []string, weight int, zone string) []string {
+	tags = append([]string{}, tags...)
+	if weight > 0 {
+		tags = append(tags, fmt.Sprintf("%s=%d", WeightKey, weight))
+	}
+	if zone != "" {
+		tags = append(tags, fmt.Sprintf("%s=%s", ZoneKey, zone))
+	}
+	return tags
+}
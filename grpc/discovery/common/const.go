@@ -8,6 +8,10 @@ const (
 	StaticResolver = "static"
 	ConsulResolver = "consul"
 	EtcdResolver   = "etcd"
+	FileResolver   = "file"
+	DNSResolver    = "dns"
+	K8sResolver    = "k8s"
+	MemoryResolver = "memory"
 )
 
 var ResolverFuncMap = make(map[string]func(configs.GrpcConfig) (string, error))
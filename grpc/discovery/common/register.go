@@ -1,5 +1,9 @@
 package common
 
+import (
+	"github.com/hsyan2008/hfw/configs"
+)
+
 type RegisterInfo struct {
 	Host           string
 	Port           int
@@ -7,9 +11,35 @@ type RegisterInfo struct {
 	ServerId       string
 	UpdateInterval int64
 	Tags           []string
+	//元数据，如version、zone、weight
+	Meta map[string]string
 }
 
 type Register interface {
 	Register(info RegisterInfo) error
 	UnRegister() error
 }
+
+//ConfigRegister 需要ServerConfig里其他配置的Register，在Register之前调用SetConfig
+type ConfigRegister interface {
+	Register
+	SetConfig(cc configs.ServerConfig)
+}
+
+//Endpoint etcd里存储的value
+type Endpoint struct {
+	Addr string
+	Tags []string          `json:",omitempty"`
+	Meta map[string]string `json:",omitempty"`
+}
+
+//DefaultEtcdPrefix etcd里key的默认前缀
+const DefaultEtcdPrefix = "etcd3_naming"
+
+//EtcdServicePrefix 服务在etcd里的key的前缀，key是前缀加ServiceId
+func EtcdServicePrefix(prefix, serverName string) string {
+	if prefix == "" {
+		prefix = DefaultEtcdPrefix
+	}
+	return "/" + prefix + "/" + serverName + "/"
+}
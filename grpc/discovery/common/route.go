@@ -0,0 +1,90 @@
+package common
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+//HashKey 一致性hash和按比例路由使用的key，相同的key总是命中相同的节点或规则
+const HashKey = "x-hash-key"
+
+//MatchRoute 返回第一个命中的规则，没有命中返回-1
+//header用于获取请求头，grpc里是outgoing metadata
+func MatchRoute(rules []configs.GrpcRouteConfig, header func(string) string) int {
+	for i, rule := range rules {
+		if matchRule(rule, header) {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchRule(rule configs.GrpcRouteConfig, header func(string) string) bool {
+	if len(rule.Headers) == 0 && rule.Percent <= 0 {
+		return false
+	}
+	for k, v := range rule.Headers {
+		if header == nil || header(k) != v {
+			return false
+		}
+	}
+	if rule.Percent <= 0 || rule.Percent >= 100 {
+		return true
+	}
+	if header != nil {
+		if key := header(HashKey); key != "" {
+			return float64(crc32.ChecksumIEEE([]byte(key))%10000) < rule.Percent*100
+		}
+	}
+	return rand.Float64()*100 < rule.Percent
+}
+
+//MatchMeta 节点的元数据是否包含selector的全部key=value
+func MatchMeta(selector, meta map[string]string) bool {
+	for k, v := range selector {
+		if meta[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+//MatchAnyRoute 节点是否被任意规则选中，没有被选中的节点处理其他请求
+func MatchAnyRoute(rules []configs.GrpcRouteConfig, meta map[string]string) bool {
+	for _, rule := range rules {
+		if len(rule.Meta) > 0 && MatchMeta(rule.Meta, meta) {
+			return true
+		}
+	}
+	return false
+}
+
+//RouteHeaders 规则里用到的请求头，用于从上游请求透传
+func RouteHeaders(rules []configs.GrpcRouteConfig) (keys []string) {
+	exists := make(map[string]bool)
+	for _, rule := range rules {
+		for k := range rule.Headers {
+			if !exists[k] {
+				exists[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return
+}
+
+//SelectorKey selector的唯一标识，Meta相同的规则使用同一组节点
+func SelectorKey(selector map[string]string) string {
+	list := make([]string, 0, len(selector))
+	for k, v := range selector {
+		list = append(list, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
@@ -0,0 +1,70 @@
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/grpc/client"
+	"github.com/hsyan2008/hfw/grpc/discovery"
+	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+//TestEndToEnd 同RunGrpc的注册，用client.GetConn调用
+func TestEndToEnd(t *testing.T) {
+	lis, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	defer s.Stop()
+
+	port := lis.Addr().(*net.TCPAddr).Port
+	if _, _, err := common.GetRegisterAddress("", fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+		t.Skip("no register address:", err)
+	}
+	r, err := discovery.RegisterServer(configs.ServerConfig{
+		ResolverType:      dc.MemoryResolver,
+		ResolverAddresses: []string{"e2e"},
+		ServerName:        "e2e.hello",
+	}, fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := client.GetConn(context.Background(), configs.GrpcConfig{
+		ServerName:        "e2e.hello",
+		ResolverType:      dc.MemoryResolver,
+		ResolverAddresses: []string{"e2e"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(d time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		defer cancel()
+		_, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+		return err
+	}
+	if err := check(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	//注销后没有可用的节点
+	if err := r.UnRegister(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := check(200 * time.Millisecond); err == nil {
+		t.Fatal("call should fail after unregister")
+	}
+}
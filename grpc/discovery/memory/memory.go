@@ -0,0 +1,194 @@
+//Package memory 进程内的服务注册和发现，用于测试和单进程部署
+//ResolverType = "memory"，ResolverAddresses[0]是注册中心的名字，名字相同的共享同一个注册中心
+//Usage:
+//registry := memory.Get("test")
+//registry.Register(memory.Instance{ID: "1", Name: "hello", Addr: "127.0.0.1:1234"}, 10*time.Second)
+//list := registry.Instances("hello", "")
+package memory
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	utils "github.com/hsyan2008/hfw/common"
+)
+
+var ErrNotFound = errors.New("instance not found")
+
+type Instance struct {
+	ID   string
+	Name string
+	Addr string
+	Tags []string
+	Meta map[string]string
+}
+
+type entry struct {
+	Instance
+	ttl   time.Duration
+	timer *time.Timer
+}
+
+type Registry struct {
+	lock     sync.RWMutex
+	services map[string]map[string]*entry
+	watchers map[string]map[chan struct{}]struct{}
+}
+
+var (
+	registries = make(map[string]*Registry)
+	lock       = new(sync.Mutex)
+)
+
+//Get 按名字获取注册中心，不存在则创建
+func Get(name string) *Registry {
+	lock.Lock()
+	defer lock.Unlock()
+	if r, ok := registries[name]; ok {
+		return r
+	}
+	r := NewRegistry()
+	registries[name] = r
+
+	return r
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		services: make(map[string]map[string]*entry),
+		watchers: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+//Register 注册或者更新实例，ttl内没有Heartbeat则自动删除，ttl<=0表示不过期
+func (r *Registry) Register(ins Instance, ttl time.Duration) error {
+	if ins.Name == "" || ins.Addr == "" {
+		return errors.New("nil Name or Addr")
+	}
+	if ins.ID == "" {
+		ins.ID = ins.Addr
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	instances, ok := r.services[ins.Name]
+	if !ok {
+		instances = make(map[string]*entry)
+		r.services[ins.Name] = instances
+	}
+	if old, ok := instances[ins.ID]; ok && old.timer != nil {
+		old.timer.Stop()
+	}
+	e := &entry{Instance: ins, ttl: ttl}
+	if ttl > 0 {
+		e.timer = time.AfterFunc(ttl, func() {
+			r.expire(e)
+		})
+	}
+	instances[ins.ID] = e
+	r.notify(ins.Name)
+
+	return nil
+}
+
+//Heartbeat 续期，实例已经过期或者不存在返回ErrNotFound，需要重新注册
+func (r *Registry) Heartbeat(name, id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	e, ok := r.services[name][id]
+	if !ok {
+		return ErrNotFound
+	}
+	if e.timer != nil {
+		e.timer.Reset(e.ttl)
+	}
+
+	return nil
+}
+
+func (r *Registry) Deregister(name, id string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	e, ok := r.services[name][id]
+	if !ok {
+		return
+	}
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	r.remove(e)
+}
+
+func (r *Registry) expire(e *entry) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	//已经被重新注册
+	if r.services[e.Name][e.ID] != e {
+		return
+	}
+	r.remove(e)
+}
+
+//remove 需要持有lock
+func (r *Registry) remove(e *entry) {
+	delete(r.services[e.Name], e.ID)
+	if len(r.services[e.Name]) == 0 {
+		delete(r.services, e.Name)
+	}
+	r.notify(e.Name)
+}
+
+//Instances tag不为空则只返回包含tag的实例，按地址排序
+func (r *Registry) Instances(name, tag string) (list []Instance) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, e := range r.services[name] {
+		if tag != "" && !utils.IsInStringArray(tag, e.Tags) {
+			continue
+		}
+		list = append(list, e.Instance)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Addr < list[j].Addr
+	})
+
+	return
+}
+
+//Watch 服务的实例有变化时通知，通知会合并，收到后需要调用Instances获取最新的实例
+func (r *Registry) Watch(name string) (ch <-chan struct{}, cancel func()) {
+	c := make(chan struct{}, 1)
+
+	r.lock.Lock()
+	if _, ok := r.watchers[name]; !ok {
+		r.watchers[name] = make(map[chan struct{}]struct{})
+	}
+	r.watchers[name][c] = struct{}{}
+	r.lock.Unlock()
+
+	return c, func() {
+		r.lock.Lock()
+		delete(r.watchers[name], c)
+		if len(r.watchers[name]) == 0 {
+			delete(r.watchers, name)
+		}
+		r.lock.Unlock()
+	}
+}
+
+//notify 需要持有lock
+func (r *Registry) notify(name string) {
+	for c := range r.watchers[name] {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
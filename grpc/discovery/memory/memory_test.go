@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	changes, cancel := r.Watch("hello")
+	defer cancel()
+
+	if err := r.Register(Instance{ID: "1", Name: "hello", Addr: "127.0.0.1:1", Tags: []string{"v1"}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(Instance{ID: "2", Name: "hello", Addr: "127.0.0.1:2", Tags: []string{"v2"}}, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	default:
+		t.Fatal("watch should be notified after register")
+	}
+	if list := r.Instances("hello", ""); len(list) != 2 || list[0].ID != "1" || list[1].ID != "2" {
+		t.Fatalf("unexpected instances: %v", list)
+	}
+	if list := r.Instances("hello", "v2"); len(list) != 1 || list[0].ID != "2" {
+		t.Fatalf("unexpected instances with tag: %v", list)
+	}
+
+	//心跳续期
+	time.Sleep(60 * time.Millisecond)
+	if err := r.Heartbeat("hello", "2"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if list := r.Instances("hello", ""); len(list) != 2 {
+		t.Fatalf("instance should not expire after heartbeat: %v", list)
+	}
+
+	//过期
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("watch should be notified after expire")
+	}
+	if list := r.Instances("hello", ""); len(list) != 1 || list[0].ID != "1" {
+		t.Fatalf("unexpected instances after expire: %v", list)
+	}
+	if err := r.Heartbeat("hello", "2"); err != ErrNotFound {
+		t.Fatalf("Heartbeat err = %v, want ErrNotFound", err)
+	}
+
+	r.Deregister("hello", "1")
+	if list := r.Instances("hello", ""); len(list) != 0 {
+		t.Fatalf("unexpected instances after deregister: %v", list)
+	}
+}
@@ -3,15 +3,16 @@ package discovery
 import (
 	"errors"
 
-	"github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
 	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
 	_ "github.com/hsyan2008/hfw/grpc/discovery/register"
+	logger "github.com/hsyan2008/hfw/logging"
 )
 
 func RegisterServer(cc configs.ServerConfig, address string) (r dc.Register, err error) {
-	if cc.ResolverType == "" || len(cc.ResolverAddresses) == 0 || cc.ServerName == "" {
+	//k8s由Endpoints自动注册，不需要ResolverAddresses
+	if cc.ResolverType == "" || (len(cc.ResolverAddresses) == 0 && cc.ResolverType != dc.K8sResolver) || cc.ServerName == "" {
 		logger.Mix("ResolverType or ResolverAddresses or ServerName is empty, so do not Registered")
 		return nil, nil
 	}
@@ -22,18 +23,25 @@ func RegisterServer(cc configs.ServerConfig, address string) (r dc.Register, err
 	if err != nil {
 		return nil, err
 	}
+	if cc.Version == "" {
+		cc.Version = common.GetVersion()
+	}
 	logger.Infof("Start register service: %s host: %s port: %d to %s", cc.ServerName, host, port, cc.ResolverType)
 	if rf, ok := dc.RegisterFuncMap[cc.ResolverType]; ok {
 		r = rf(cc.ResolverAddresses, int(cc.UpdateInterval)*2)
 	} else {
 		return nil, errors.New("unsupport ResolverType")
 	}
+	if cr, ok := r.(dc.ConfigRegister); ok {
+		cr.SetConfig(cc)
+	}
 	err = r.Register(dc.RegisterInfo{
 		Host:           host,
 		Port:           port,
 		ServerName:     cc.ServerName,
 		UpdateInterval: cc.UpdateInterval,
-		Tags:           cc.Tags,
+		Tags:           dc.RegisterTags(cc.Tags, cc.Weight, cc.Zone),
+		Meta:           dc.RegisterMeta(cc.Meta, cc.Version, cc.Weight, cc.Zone),
 	})
 	return r, err
 }
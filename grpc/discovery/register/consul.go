@@ -13,16 +13,18 @@ import (
 	"time"
 
 	consulapi "github.com/hashicorp/consul/api"
-	"github.com/hsyan2008/go-logger"
 	utils "github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	logger "github.com/hsyan2008/hfw/logging"
 	"github.com/hsyan2008/hfw/service/discovery/client"
 	"github.com/hsyan2008/hfw/signal"
 )
 
 type ConsulRegister struct {
-	target string
+	target []string
 	ttl    int
+	conf   configs.ConsulConfig
 
 	client *consulapi.Client
 
@@ -34,22 +36,26 @@ type ConsulRegister struct {
 	serviceID string
 }
 
-var _ common.Register = &ConsulRegister{}
+var _ common.ConfigRegister = &ConsulRegister{}
 
 func init() {
 	common.RegisterFuncMap[common.ConsulResolver] = NewConsulRegister
 }
 
 func NewConsulRegister(target []string, ttl int) common.Register {
-	cr := &ConsulRegister{target: target[0], ttl: ttl}
+	cr := &ConsulRegister{target: target, ttl: ttl}
 	return cr
 }
 
+func (cr *ConsulRegister) SetConfig(cc configs.ServerConfig) {
+	cr.conf = cc.Consul
+}
+
 func (cr *ConsulRegister) Register(info common.RegisterInfo) (err error) {
 	cr.ctx, cr.cancel = context.WithCancel(signal.GetSignalContext().Ctx)
 	cr.registerInfo = info
 
-	cr.client, err = client.NewConsulClient(cr.target)
+	cr.client, err = client.NewConsulClientWithConfig(cr.target, cr.conf)
 	if err != nil {
 		return fmt.Errorf("create consul client error: %s", err.Error())
 	}
@@ -60,10 +66,45 @@ func (cr *ConsulRegister) Register(info common.RegisterInfo) (err error) {
 		cr.serviceID = info.ServerId
 	}
 
+	if err = cr.register(); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(info.UpdateInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			if err := cr.client.Agent().UpdateTTL(cr.serviceID, "", consulapi.HealthPassing); err != nil {
+				//切换了agent或者agent重启后，服务需要重新注册
+				logger.Warn("update ttl of service error: ", err.Error())
+				if err = cr.register(); err != nil {
+					logger.Warn(err.Error())
+				}
+			}
+			select {
+			case <-signal.GetSignalContext().Ctx.Done():
+				cr.cancel()
+				return
+			case <-cr.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	signal.GetSignalContext().WgAdd()
+
+	return nil
+}
+
+//register 注册服务和ttl检查
+func (cr *ConsulRegister) register() (err error) {
+	info := cr.registerInfo
 	reg := &consulapi.AgentServiceRegistration{
 		ID:      cr.serviceID,
 		Name:    info.ServerName,
 		Tags:    info.Tags,
+		Meta:    info.Meta,
 		Port:    info.Port,
 		Address: info.Host,
 	}
@@ -84,27 +125,6 @@ func (cr *ConsulRegister) Register(info common.RegisterInfo) (err error) {
 		return fmt.Errorf("initial register service check to consul error: %s", err.Error())
 	}
 
-	go func() {
-		ticker := time.NewTicker(time.Duration(info.UpdateInterval) * time.Second)
-		defer ticker.Stop()
-		for {
-			err = cr.client.Agent().UpdateTTL(cr.serviceID, "", check.Status)
-			if err != nil {
-				logger.Warn("update ttl of service error: ", err.Error())
-			}
-			select {
-			case <-signal.GetSignalContext().Ctx.Done():
-				cr.cancel()
-				return
-			case <-cr.ctx.Done():
-				return
-			case <-ticker.C:
-			}
-		}
-	}()
-
-	signal.GetSignalContext().WgAdd()
-
 	return nil
 }
 
@@ -1,31 +1,33 @@
-// +build etcd
-
 package register
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
-	"github.com/coreos/etcd/clientv3"
-	"github.com/hsyan2008/go-logger"
+	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/service/discovery/client"
 	"github.com/hsyan2008/hfw/signal"
+	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
-var _ common.Register = &EtcdRegister{}
+var _ common.ConfigRegister = &EtcdRegister{}
 
-// Prefix should start and end with no slash
-var Prefix = "etcd3_naming"
+//etcd不可用时，重新注册的间隔
+var etcdRetryInterval = time.Second
 
 type EtcdRegister struct {
 	target []string
 	ttl    int
+	conf   configs.EtcdConfig
 
-	//存在etcd里的key
+	//存在etcd里的key，/Prefix/ServerName/ServiceId
 	key string
-	//本服务的地址
-	addr string
+	//存在etcd里的value，包含地址、tag和元数据
+	value string
 
 	client *clientv3.Client
 
@@ -40,90 +42,104 @@ func init() {
 }
 
 func NewEtcdRegister(target []string, ttl int) common.Register {
-	er := &EtcdRegister{target: target, ttl: ttl}
-	er.ctx, er.cancel = context.WithCancel(signal.GetSignalContext().Ctx)
+	return &EtcdRegister{target: target, ttl: ttl}
+}
 
-	return er
+func (er *EtcdRegister) SetConfig(cc configs.ServerConfig) {
+	er.conf = cc.Etcd
 }
 
-// Register register service with name as prefix to etcd, multi etcd addr should use ; to split
+// Register register service with lease to etcd, lease will be renewed automatically
 func (er *EtcdRegister) Register(info common.RegisterInfo) (err error) {
-	if er.client == nil {
-		er.client, err = clientv3.New(clientv3.Config{
-			Endpoints:   er.target,
-			DialTimeout: 5 * time.Second,
-		})
-		if err != nil {
-			return err
-		}
-	}
+	er.ctx, er.cancel = context.WithCancel(signal.GetSignalContext().Ctx)
+	er.registerInfo = info
 
-	er.addr = fmt.Sprintf("%s:%d", info.Host, info.Port)
-	if info.ServiceID == "" {
-		er.key = fmt.Sprintf("/%s/%s/%s", fmt.Sprintf("%s_%s", common.EtcdResolver, info.ServerName), info.ServerName, er.addr)
-	} else {
-		er.key = info.ServiceID
+	er.client, err = client.NewEtcdClient(er.target, er.conf)
+	if err != nil {
+		return fmt.Errorf("create etcd client error: %s", err.Error())
 	}
 
-	ticker := time.NewTicker(time.Second * time.Duration(info.UpdateInterval))
+	addr := fmt.Sprintf("%s:%d", info.Host, info.Port)
+	serviceID := info.ServerId
+	if serviceID == "" {
+		serviceID = generateServiceId(info.ServerName, info.Host, info.Port)
+	}
+	er.key = common.EtcdServicePrefix(er.conf.Prefix, info.ServerName) + serviceID
+	value, err := json.Marshal(common.Endpoint{Addr: addr, Tags: info.Tags, Meta: info.Meta})
+	if err != nil {
+		return err
+	}
+	er.value = string(value)
 
-	go func() {
-		for {
-			getResp, err := er.client.Get(er.ctx, er.key)
-			logger.Debug(getResp, err)
-			if err != nil {
-				logger.Warn(er.key, err)
-			} else if getResp.Count == 0 {
-				err = er.withAlive()
-				if err != nil {
-					logger.Warn(er.key, err)
-				}
-			} else {
-				// do nothing
-			}
-			select {
-			case <-signal.GetSignalContext().Ctx.Done():
-				er.cancel()
-				return
-			case <-er.ctx.Done():
-				return
-			case <-ticker.C:
-			}
-		}
-	}()
+	ch, err := er.withAlive()
+	if err != nil {
+		return fmt.Errorf("register service to etcd error: %s", err.Error())
+	}
+	go er.keepAlive(ch)
 
 	signal.GetSignalContext().WgAdd()
 
 	return nil
 }
 
-func (er *EtcdRegister) withAlive() error {
-	leaseResp, err := er.client.Grant(er.ctx, int64(er.ttl))
+//withAlive 创建租约并写入key
+func (er *EtcdRegister) withAlive() (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ctx, cancel := context.WithTimeout(er.ctx, 5*time.Second)
+	defer cancel()
+
+	leaseResp, err := er.client.Grant(ctx, int64(er.ttl))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = er.client.Put(er.ctx, er.key, er.addr, clientv3.WithLease(leaseResp.ID))
+	_, err = er.client.Put(ctx, er.key, er.value, clientv3.WithLease(leaseResp.ID))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = er.client.KeepAlive(er.ctx, leaseResp.ID)
-	if err != nil {
-		return err
+	return er.client.KeepAlive(er.ctx, leaseResp.ID)
+}
+
+//keepAlive 租约失效(如etcd不可用超过ttl)后重新注册
+func (er *EtcdRegister) keepAlive(ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	for {
+		for range ch {
+		}
+		select {
+		case <-er.ctx.Done():
+			return
+		default:
+		}
+		logger.Warnf("etcd lease of %s is lost, register again", er.key)
+		for {
+			var err error
+			if ch, err = er.withAlive(); err == nil {
+				break
+			}
+			logger.Warn("register service to etcd error: ", err.Error())
+			select {
+			case <-er.ctx.Done():
+				return
+			case <-time.After(etcdRetryInterval):
+			}
+		}
 	}
-	return nil
 }
 
 // UnRegister remove service from etcd
 func (er *EtcdRegister) UnRegister() (err error) {
-	if er.client != nil {
-		defer func() {
-			signal.GetSignalContext().WgDone()
-			er.cancel()
-		}()
-		_, err = er.client.Delete(context.Background(), er.key)
+	defer func() {
+		signal.GetSignalContext().WgDone()
+		er.cancel()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = er.client.Delete(ctx, er.key)
+	if err != nil {
+		return fmt.Errorf("deregister service error: %s", err.Error())
 	}
+	logger.Infof("deregistered service: %s from etcd server.", er.registerInfo.ServerName)
 
-	return
+	return nil
 }
@@ -0,0 +1,29 @@
+package register
+
+import (
+	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	logger "github.com/hsyan2008/hfw/logging"
+)
+
+//K8sRegister k8s里由service的selector匹配pod，Endpoints自动维护，不需要注册
+type K8sRegister struct {
+}
+
+var _ common.Register = &K8sRegister{}
+
+func init() {
+	common.RegisterFuncMap[common.K8sResolver] = NewK8sRegister
+}
+
+func NewK8sRegister(target []string, ttl int) common.Register {
+	return new(K8sRegister)
+}
+
+func (kr *K8sRegister) Register(info common.RegisterInfo) error {
+	logger.Infof("service: %s is registered by k8s Endpoints", info.ServerName)
+	return nil
+}
+
+func (kr *K8sRegister) UnRegister() error {
+	return nil
+}
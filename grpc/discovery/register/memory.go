@@ -0,0 +1,89 @@
+package register
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	"github.com/hsyan2008/hfw/grpc/discovery/memory"
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/signal"
+)
+
+//MemoryRegister 注册到进程内的注册中心，target[0]是注册中心的名字
+type MemoryRegister struct {
+	registry *memory.Registry
+	ttl      int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	instance memory.Instance
+}
+
+var _ common.Register = &MemoryRegister{}
+
+func init() {
+	common.RegisterFuncMap[common.MemoryResolver] = NewMemoryRegister
+}
+
+func NewMemoryRegister(target []string, ttl int) common.Register {
+	return &MemoryRegister{registry: memory.Get(target[0]), ttl: ttl}
+}
+
+func (mr *MemoryRegister) Register(info common.RegisterInfo) (err error) {
+	mr.ctx, mr.cancel = context.WithCancel(signal.GetSignalContext().Ctx)
+
+	mr.instance = memory.Instance{
+		ID:   info.ServerId,
+		Name: info.ServerName,
+		Addr: fmt.Sprintf("%s:%d", info.Host, info.Port),
+		Tags: info.Tags,
+		Meta: info.Meta,
+	}
+	if mr.instance.ID == "" {
+		mr.instance.ID = generateServiceId(info.ServerName, info.Host, info.Port)
+	}
+	ttl := time.Duration(mr.ttl) * time.Second
+	if err = mr.registry.Register(mr.instance, ttl); err != nil {
+		return fmt.Errorf("register service to memory error: %s", err.Error())
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(info.UpdateInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-signal.GetSignalContext().Ctx.Done():
+				mr.cancel()
+				return
+			case <-mr.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			//已经过期则重新注册
+			if mr.registry.Heartbeat(mr.instance.Name, mr.instance.ID) == memory.ErrNotFound {
+				if err := mr.registry.Register(mr.instance, ttl); err != nil {
+					logger.Warn("register service to memory error: ", err.Error())
+				}
+			}
+		}
+	}()
+
+	signal.GetSignalContext().WgAdd()
+
+	return nil
+}
+
+func (mr *MemoryRegister) UnRegister() error {
+	defer func() {
+		signal.GetSignalContext().WgDone()
+		mr.cancel()
+	}()
+
+	mr.registry.Deregister(mr.instance.Name, mr.instance.ID)
+	logger.Infof("deregistered service: %s from memory.", mr.instance.Name)
+
+	return nil
+}
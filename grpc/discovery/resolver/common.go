@@ -13,16 +13,27 @@ var lock = new(sync.RWMutex)
 func CompleteResolverScheme(c configs.GrpcConfig) (configs.GrpcConfig, error) {
 	if c.ResolverScheme == "" {
 		//static下，有可能服务名一样而地址不一样，做特殊处理
-		if c.ResolverType == dc.StaticResolver {
+		if c.ResolverType == dc.StaticResolver || c.ResolverType == dc.DNSResolver {
 			if len(c.Addresses) == 0 {
 				return c, fmt.Errorf("please specify grpc %s Addresses", c.ServerName)
 			}
 			c.ResolverScheme = fmt.Sprintf("%s_%s_%s_%s", c.ResolverType, c.ServerName, c.Tag, c.Addresses[0])
+		} else if c.ResolverType == dc.K8sResolver {
+			//k8s下ResolverAddresses是可选的
+			var address string
+			if len(c.ResolverAddresses) > 0 {
+				address = c.ResolverAddresses[0]
+			}
+			c.ResolverScheme = fmt.Sprintf("%s_%s_%s_%s", c.ResolverType, c.ServerName, c.K8s.Namespace, address)
 		} else {
 			if len(c.ResolverAddresses) == 0 {
 				return c, fmt.Errorf("please specify grpc %s Addresses", c.ServerName)
 			}
 			c.ResolverScheme = fmt.Sprintf("%s_%s_%s_%s", c.ResolverType, c.ServerName, c.Tag, c.ResolverAddresses[0])
+			//consul不同的数据中心
+			if c.ResolverType == dc.ConsulResolver && c.Consul.Datacenter != "" {
+				c.ResolverScheme += "_" + c.Consul.Datacenter
+			}
 		}
 	}
 
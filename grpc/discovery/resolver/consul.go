@@ -3,124 +3,177 @@ package resolver
 import (
 	"context"
 	"fmt"
-	"net/url"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/consul/api"
-	"github.com/hsyan2008/go-logger"
+	utils "github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	logger "github.com/hsyan2008/hfw/logging"
 	"github.com/hsyan2008/hfw/service/discovery/client"
 	"github.com/hsyan2008/hfw/signal"
 	"google.golang.org/grpc/resolver"
 )
 
-type consulBuilder struct {
-	scheme      string
-	address     string
-	client      *api.Client
-	serviceName string
-	tag         string
+//consul不可用时，重新获取的间隔
+var consulRetryInterval = time.Second
 
-	queryOptions *api.QueryOptions
+type consulBuilder struct {
+	scheme string
+	client *api.Client
+	tag    string
+	//按顺序查询的数据中心，第一个为空表示agent所在的数据中心
+	datacenters []string
 }
 
 func NewConsulBuilder(scheme, address, tag string) resolver.Builder {
-	client, err := client.NewConsulClient(address)
+	builder, err := NewConsulBuilderWithConfig(scheme, []string{address}, tag, configs.ConsulConfig{})
 	if err != nil {
 		logger.Fatal("create consul client error", err.Error())
 		return nil
 	}
-	return &consulBuilder{scheme: scheme,
-		address:      address,
-		tag:          tag,
-		client:       client,
-		queryOptions: (&api.QueryOptions{}).WithContext(signal.GetSignalContext().Ctx),
+	return builder
+}
+
+//NewConsulBuilderWithConfig 多个地址时agent不可用会切换，Datacenter没有可用节点时按顺序使用FailoverDatacenters
+func NewConsulBuilderWithConfig(scheme string, addresses []string, tag string, conf configs.ConsulConfig) (resolver.Builder, error) {
+	client, err := client.NewConsulClientWithConfig(addresses, conf)
+	if err != nil {
+		return nil, fmt.Errorf("create consul client error: %s", err.Error())
 	}
+	datacenters := []string{conf.Datacenter}
+	for _, dc := range conf.FailoverDatacenters {
+		if dc != "" && !utils.IsInStringArray(dc, datacenters) {
+			datacenters = append(datacenters, dc)
+		}
+	}
+	return &consulBuilder{scheme: scheme,
+		tag:         tag,
+		client:      client,
+		datacenters: datacenters,
+	}, nil
 }
 
 func (cb *consulBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
-	cb.serviceName = target.Endpoint
+	ctx, cancel := context.WithCancel(signal.GetSignalContext().Ctx)
+	cr := &consulResolver{
+		consulBuilder: cb,
+		serviceName:   target.Endpoint,
+		cc:            cc,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
 
-	adds, serviceConfig, err := cb.resolve()
-	if err != nil {
-		return nil, err
+	for i, name := range cb.datacenters {
+		d := &consulDatacenter{
+			name:         name,
+			queryOptions: (&api.QueryOptions{Datacenter: name}).WithContext(ctx),
+		}
+		adds, err := cr.resolve(d)
+		if err != nil {
+			//其他数据中心不可用时不影响使用
+			if i == 0 {
+				cancel()
+				return nil, err
+			}
+			logger.Warnf("query %s service entries from datacenter %s error: %v", cr.serviceName, name, err)
+		}
+		d.addrs = adds
+		cr.datacenters = append(cr.datacenters, d)
 	}
-	cc.NewAddress(adds)
-	cc.NewServiceConfig(serviceConfig)
+	cr.update()
 
-	consulResolver := NewConsulResolver(&cc, cb, opts)
-	consulResolver.wg.Add(1)
-	go consulResolver.watcher()
+	for _, d := range cr.datacenters {
+		cr.wg.Add(1)
+		go cr.watcher(d)
+	}
+
+	return cr, nil
+}
+
+func (cb *consulBuilder) Scheme() string {
+	return cb.scheme
+}
 
-	return consulResolver, nil
+type consulDatacenter struct {
+	name string
+	//每个数据中心单独的WaitIndex
+	queryOptions *api.QueryOptions
+	addrs        []resolver.Address
 }
 
-func (cb *consulBuilder) resolve() ([]resolver.Address, string, error) {
+type consulResolver struct {
+	consulBuilder *consulBuilder
+	serviceName   string
+	cc            resolver.ClientConn
+
+	lock        sync.Mutex
+	datacenters []*consulDatacenter
+
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
 
-	serviceEntries, metainfo, err := cb.client.Health().Service(cb.serviceName, cb.tag, true, cb.queryOptions)
+//resolve 只返回通过健康检查的节点，有WaitIndex时阻塞到有变化或者超时
+func (cr *consulResolver) resolve(d *consulDatacenter) ([]resolver.Address, error) {
+	serviceEntries, metainfo, err := cr.consulBuilder.client.Health().Service(cr.serviceName, cr.consulBuilder.tag, true, d.queryOptions)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	cb.queryOptions.WaitIndex = metainfo.LastIndex
+	d.queryOptions.WaitIndex = metainfo.LastIndex
 
 	adds := make([]resolver.Address, 0)
 	for _, serviceEntry := range serviceEntries {
-		address := resolver.Address{Addr: fmt.Sprintf("%s:%d", serviceEntry.Service.Address, serviceEntry.Service.Port)}
+		//tag或者meta里的weight、zone用于负载均衡
+		address := common.NewAddress(fmt.Sprintf("%s:%d", serviceEntry.Service.Address, serviceEntry.Service.Port),
+			serviceEntry.Service.Tags, serviceEntry.Service.Meta)
 		adds = append(adds, address)
 	}
-	return adds, "", nil
+	return adds, nil
 }
 
-func (cb *consulBuilder) Scheme() string {
-	return cb.scheme
-}
+//update 使用第一个有可用节点的数据中心
+func (cr *consulResolver) update() {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
 
-type consulResolver struct {
-	clientConn    *resolver.ClientConn
-	consulBuilder *consulBuilder
-	// t                    *time.Ticker
-	wg                   sync.WaitGroup
-	rn                   chan struct{}
-	ctx                  context.Context
-	cancel               context.CancelFunc
-	disableServiceConfig bool
-}
-
-func NewConsulResolver(cc *resolver.ClientConn, cb *consulBuilder, opts resolver.BuildOptions) *consulResolver {
-	ctx, cancel := context.WithCancel(signal.GetSignalContext().Ctx)
-	return &consulResolver{
-		clientConn:    cc,
-		consulBuilder: cb,
-		// t:                    time.NewTicker(time.Second * 3),
-		ctx:                  ctx,
-		cancel:               cancel,
-		disableServiceConfig: opts.DisableServiceConfig}
+	adds := make([]resolver.Address, 0)
+	for _, d := range cr.datacenters {
+		if len(d.addrs) > 0 {
+			adds = d.addrs
+			break
+		}
+	}
+	if err := cr.cc.UpdateState(resolver.State{Addresses: adds}); err != nil {
+		logger.Warnf("update %s addresses from consul: %v", cr.serviceName, err)
+	}
 }
 
-func (cr *consulResolver) watcher() {
-	cr.wg.Done()
+func (cr *consulResolver) watcher(d *consulDatacenter) {
+	defer cr.wg.Done()
 	for {
+		adds, err := cr.resolve(d)
 		select {
 		case <-cr.ctx.Done():
 			return
-		case <-cr.rn:
-		// case <-cr.t.C:
 		default:
 		}
-		adds, serviceConfig, err := cr.consulBuilder.resolve()
 		if err != nil {
-			if e, ok := err.(*url.Error); ok {
-				if e.Err == context.Canceled {
-					continue
-				}
+			logger.Warnf("query %s service entries from datacenter %s error: %v", cr.serviceName, d.name, err)
+			select {
+			case <-cr.ctx.Done():
+				return
+			case <-time.After(consulRetryInterval):
 			}
-			logger.Fatal("query service entries error:", err.Error())
 			continue
 		}
-		(*cr.clientConn).NewAddress(adds)
-		(*cr.clientConn).NewServiceConfig(serviceConfig)
+		cr.lock.Lock()
+		d.addrs = adds
+		cr.lock.Unlock()
+		cr.update()
 	}
 }
 
@@ -128,17 +181,13 @@ func (cr *consulResolver) Scheme() string {
 	return cr.consulBuilder.Scheme()
 }
 
+//ResolveNow 阻塞查询会在有变化时立即返回
 func (cr *consulResolver) ResolveNow(rno resolver.ResolveNowOptions) {
-	select {
-	case cr.rn <- struct{}{}:
-	default:
-	}
 }
 
 func (cr *consulResolver) Close() {
 	cr.cancel()
 	cr.wg.Wait()
-	// cr.t.Stop()
 }
 
 func init() {
@@ -167,7 +216,10 @@ func GenerateAndRegisterConsulResolver(cc configs.GrpcConfig) (schema string, er
 	if resolver.Get(cc.ResolverScheme) != nil {
 		return cc.ResolverScheme, nil
 	}
-	builder := NewConsulBuilder(cc.ResolverScheme, cc.ResolverAddresses[0], cc.Tag)
+	builder, err := NewConsulBuilderWithConfig(cc.ResolverScheme, cc.ResolverAddresses, cc.Tag, cc.Consul)
+	if err != nil {
+		return
+	}
 	resolver.Register(builder)
 	schema = builder.Scheme()
 	return
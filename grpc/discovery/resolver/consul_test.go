@@ -0,0 +1,69 @@
+package resolver
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+	"google.golang.org/grpc/resolver"
+)
+
+//TestConsulFailover 第一个agent不可用，本地数据中心没有节点时使用dc2的节点
+func TestConsulFailover(t *testing.T) {
+	var tokenErr int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			atomic.StoreInt32(&tokenErr, 1)
+		}
+		if !strings.HasPrefix(r.URL.Path, "/v1/health/service/hello") {
+			http.NotFound(w, r)
+			return
+		}
+		//阻塞查询
+		if r.URL.Query().Get("index") != "" {
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("X-Consul-Index", "1")
+		if r.URL.Query().Get("dc") == "dc2" {
+			w.Write([]byte(`[{"Service": {"Address": "127.0.0.1", "Port": 1234, "Tags": ["weight=10"]}}]`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := lis.Addr().String()
+	lis.Close()
+
+	builder, err := NewConsulBuilderWithConfig("consul_test", []string{dead, ts.URL}, "", configs.ConsulConfig{
+		Token:               "secret",
+		Datacenter:          "dc1",
+		FailoverDatacenters: []string{"dc2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := &testClientConn{states: make(chan resolver.State, 10)}
+	r, err := builder.Build(resolver.Target{Endpoint: "hello"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	s := cc.wait(t)
+	if len(s.Addresses) != 1 || s.Addresses[0].Addr != "127.0.0.1:1234" {
+		t.Fatalf("unexpected addresses: %v", s.Addresses)
+	}
+	if atomic.LoadInt32(&tokenErr) != 0 {
+		t.Fatal("acl token is not sent")
+	}
+}
@@ -0,0 +1,229 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/signal"
+	"google.golang.org/grpc/resolver"
+)
+
+var defaultResolveInterval int64 = 30
+
+type dnsBuilder struct {
+	scheme string
+	//要解析的域名，host:port或者_开头的SRV记录
+	names    []string
+	interval time.Duration
+
+	resolver *net.Resolver
+}
+
+//NewDNSBuilder dnsServer为空则使用系统的dns
+func NewDNSBuilder(scheme, dnsServer string, names []string, interval time.Duration) resolver.Builder {
+	r := net.DefaultResolver
+	if dnsServer != "" {
+		r = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, dnsServer)
+			},
+		}
+	}
+
+	return &dnsBuilder{scheme: scheme, names: names, interval: interval, resolver: r}
+}
+
+func (db *dnsBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(signal.GetSignalContext().Ctx)
+	r := &dnsResolver{
+		builder: db,
+		cc:      cc,
+		rn:      make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	r.resolve()
+	r.wg.Add(1)
+	go r.watch()
+
+	return r, nil
+}
+
+func (db *dnsBuilder) Scheme() string {
+	return db.scheme
+}
+
+//lookup 解析所有的域名，结果去重排序
+func (db *dnsBuilder) lookup(ctx context.Context) ([]resolver.Address, error) {
+	var addrs []resolver.Address
+	exists := make(map[string]bool)
+	for _, name := range db.names {
+		list, err := db.lookupName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range list {
+			if !exists[addr.Addr] {
+				exists[addr.Addr] = true
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Addr < addrs[j].Addr
+	})
+
+	return addrs, nil
+}
+
+func (db *dnsBuilder) lookupName(ctx context.Context, name string) (addrs []resolver.Address, err error) {
+	//SRV记录，权重作为负载均衡的权重
+	if strings.HasPrefix(name, "_") {
+		_, srvs, err := db.resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			ips, err := db.resolver.LookupHost(ctx, srv.Target)
+			if err != nil {
+				return nil, err
+			}
+			for _, ip := range ips {
+				addr := resolver.Address{Addr: net.JoinHostPort(ip, strconv.Itoa(int(srv.Port)))}
+				addrs = append(addrs, common.SetAddressWeight(addr, int(srv.Weight)))
+			}
+		}
+		return addrs, nil
+	}
+
+	host, port, err := net.SplitHostPort(name)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := db.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		addrs = append(addrs, resolver.Address{Addr: net.JoinHostPort(ip, port)})
+	}
+
+	return
+}
+
+type dnsResolver struct {
+	builder *dnsBuilder
+	cc      resolver.ClientConn
+	rn      chan struct{}
+	wg      sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	//上次的结果，没有变化则不更新
+	last     string
+	resolved bool
+}
+
+func (r *dnsResolver) resolve() {
+	addrs, err := r.builder.lookup(r.ctx)
+	if err != nil {
+		//解析失败则继续使用旧的地址
+		logger.Warn("dns resolve error:", err)
+		if !r.resolved {
+			r.cc.ReportError(err)
+		}
+		return
+	}
+
+	var list []string
+	for _, addr := range addrs {
+		list = append(list, addr.Addr)
+	}
+	key := strings.Join(list, ",")
+	if r.resolved && key == r.last {
+		return
+	}
+	r.resolved = true
+	r.last = key
+	if err = r.cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		logger.Warnf("update dns addresses %v: %v", r.builder.names, err)
+	}
+}
+
+func (r *dnsResolver) watch() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.builder.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-r.rn:
+		case <-ticker.C:
+		}
+		r.resolve()
+	}
+}
+
+func (r *dnsResolver) ResolveNow(rno resolver.ResolveNowOptions) {
+	select {
+	case r.rn <- struct{}{}:
+	default:
+	}
+}
+
+func (r *dnsResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func init() {
+	common.ResolverFuncMap[common.DNSResolver] = GenerateAndRegisterDNSResolver
+}
+
+func GenerateAndRegisterDNSResolver(cc configs.GrpcConfig) (schema string, err error) {
+	if len(cc.Addresses) == 0 {
+		return "", fmt.Errorf("GrpcConfig has nil Addresses")
+	}
+	cc, err = CompleteResolverScheme(cc)
+	if err != nil {
+		return
+	}
+
+	lock.RLock()
+	if resolver.Get(cc.ResolverScheme) != nil {
+		lock.RUnlock()
+		return cc.ResolverScheme, nil
+	}
+	lock.RUnlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if resolver.Get(cc.ResolverScheme) != nil {
+		return cc.ResolverScheme, nil
+	}
+	var dnsServer string
+	if len(cc.ResolverAddresses) > 0 {
+		dnsServer = cc.ResolverAddresses[0]
+	}
+	interval := cc.ResolveInterval
+	if interval <= 0 {
+		interval = defaultResolveInterval
+	}
+	builder := NewDNSBuilder(cc.ResolverScheme, dnsServer, cc.Addresses, time.Duration(interval)*time.Second)
+	resolver.Register(builder)
+	schema = builder.Scheme()
+	return
+}
@@ -1,121 +1,184 @@
-// +build etcd
-
 package resolver
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/coreos/etcd/clientv3"
-	"github.com/coreos/etcd/mvcc/mvccpb"
-	"github.com/hsyan2008/go-logger"
+	utils "github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/service/discovery/client"
 	"github.com/hsyan2008/hfw/signal"
-	"golang.org/x/net/context"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc/resolver"
 )
 
-type etcdBuilder struct {
-	rawAddr []string
-	cc      resolver.ClientConn
-	cli     *clientv3.Client
-
-	schema string
-
-	ctx context.Context
-}
+//etcd不可用时，重新获取的间隔
+var etcdRetryInterval = time.Second
 
-// NewEtcdResolver initialize an etcd client
-func NewEtcdBuilder(schema string, etcdAddrs []string) resolver.Builder {
-	return &etcdBuilder{rawAddr: etcdAddrs, schema: schema, ctx: signal.GetSignalContext().Ctx}
+type etcdBuilder struct {
+	scheme string
+	client *clientv3.Client
+	prefix string
+	tag    string
 }
 
-func (r *etcdBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
-	var err error
-
-	if r.cli == nil {
-		r.cli, err = clientv3.New(clientv3.Config{
-			Endpoints:   r.rawAddr,
-			DialTimeout: 5 * time.Second,
-		})
-		if err != nil {
-			return nil, err
-		}
+// NewEtcdBuilder initialize an etcd client
+func NewEtcdBuilder(scheme string, etcdAddrs []string, tag string, conf configs.EtcdConfig) (resolver.Builder, error) {
+	cli, err := client.NewEtcdClient(etcdAddrs, conf)
+	if err != nil {
+		return nil, fmt.Errorf("create etcd client error: %s", err.Error())
 	}
 
-	r.cc = cc
+	return &etcdBuilder{scheme: scheme, client: cli, prefix: conf.Prefix, tag: tag}, nil
+}
 
-	go r.watch("/" + target.Scheme + "/" + target.Endpoint + "/")
+func (eb *etcdBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(signal.GetSignalContext().Ctx)
+	r := &etcdResolver{
+		builder:   eb,
+		keyPrefix: common.EtcdServicePrefix(eb.prefix, target.Endpoint),
+		cc:        cc,
+		endpoints: make(map[string]resolver.Address),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	rev, err := r.list()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r.wg.Add(1)
+	go r.watch(rev)
 
 	return r, nil
 }
 
-func (r etcdBuilder) Scheme() string {
-	return r.schema
+func (eb *etcdBuilder) Scheme() string {
+	return eb.scheme
 }
 
-func (r etcdBuilder) ResolveNow(rn resolver.ResolveNowOptions) {
-	// log.Println("ResolveNow") // TODO check
-}
+type etcdResolver struct {
+	builder   *etcdBuilder
+	keyPrefix string
+	cc        resolver.ClientConn
+	//key对应的地址
+	endpoints map[string]resolver.Address
 
-// Close closes the resolver.
-func (r etcdBuilder) Close() {
-	// log.Println("Close")
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func (r *etcdBuilder) watch(keyPrefix string) {
-	var addrList []resolver.Address
-
-	getResp, err := r.cli.Get(r.ctx, keyPrefix, clientv3.WithPrefix())
+//list 全量获取，返回的revision用于watch
+func (r *etcdResolver) list() (int64, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, 5*time.Second)
+	defer cancel()
+	resp, err := r.builder.client.Get(ctx, r.keyPrefix, clientv3.WithPrefix())
 	if err != nil {
-		logger.Warn(keyPrefix, err)
-	} else {
-		for i := range getResp.Kvs {
-			addrList = append(addrList, resolver.Address{Addr: strings.TrimPrefix(string(getResp.Kvs[i].Key), keyPrefix)})
+		return 0, err
+	}
+
+	endpoints := make(map[string]resolver.Address)
+	for _, kv := range resp.Kvs {
+		if addr, ok := r.parse(kv.Key, kv.Value); ok {
+			endpoints[string(kv.Key)] = addr
 		}
 	}
+	r.endpoints = endpoints
+	r.update()
 
-	r.cc.NewAddress(addrList)
-
-	rch := r.cli.Watch(r.ctx, keyPrefix, clientv3.WithPrefix())
-	for n := range rch {
-		for _, ev := range n.Events {
-			addr := strings.TrimPrefix(string(ev.Kv.Key), keyPrefix)
-			switch ev.Type {
-			case mvccpb.PUT:
-				if !exist(addrList, addr) {
-					addrList = append(addrList, resolver.Address{Addr: addr})
-					r.cc.NewAddress(addrList)
-				}
-			case mvccpb.DELETE:
-				if s, ok := remove(addrList, addr); ok {
-					addrList = s
-					r.cc.NewAddress(addrList)
+	return resp.Header.Revision, nil
+}
+
+//watch 从revision之后开始watch，中断或者被压缩后重新list
+func (r *etcdResolver) watch(rev int64) {
+	defer r.wg.Done()
+	for {
+		//没有leader时中断，避免一直使用旧的数据
+		wch := r.builder.client.Watch(clientv3.WithRequireLeader(r.ctx), r.keyPrefix,
+			clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+		for wresp := range wch {
+			if err := wresp.Err(); err != nil {
+				logger.Warnf("watch etcd %s error: %v", r.keyPrefix, err)
+				break
+			}
+			for _, ev := range wresp.Events {
+				key := string(ev.Kv.Key)
+				switch ev.Type {
+				case clientv3.EventTypePut:
+					if addr, ok := r.parse(ev.Kv.Key, ev.Kv.Value); ok {
+						r.endpoints[key] = addr
+					} else {
+						//tag有变化
+						delete(r.endpoints, key)
+					}
+				case clientv3.EventTypeDelete:
+					delete(r.endpoints, key)
 				}
 			}
+			rev = wresp.Header.Revision
+			r.update()
+		}
+
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			default:
+			}
+			var err error
+			if rev, err = r.list(); err == nil {
+				break
+			}
+			logger.Warnf("get etcd %s error: %v", r.keyPrefix, err)
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(etcdRetryInterval):
+			}
 		}
 	}
 }
 
-func exist(l []resolver.Address, addr string) bool {
-	for i := range l {
-		if l[i].Addr == addr {
-			return true
-		}
+//parse value是json格式的common.Endpoint，旧版本的value只有地址
+func (r *etcdResolver) parse(key, value []byte) (resolver.Address, bool) {
+	var e common.Endpoint
+	if err := json.Unmarshal(value, &e); err != nil || e.Addr == "" {
+		e = common.Endpoint{Addr: strings.TrimPrefix(string(key), r.keyPrefix)}
 	}
-	return false
+	if r.builder.tag != "" && !utils.IsInStringArray(r.builder.tag, e.Tags) {
+		return resolver.Address{}, false
+	}
+
+	return common.NewAddress(e.Addr, e.Tags, e.Meta), true
 }
 
-func remove(s []resolver.Address, addr string) ([]resolver.Address, bool) {
-	for i := range s {
-		if s[i].Addr == addr {
-			s[i] = s[len(s)-1]
-			return s[:len(s)-1], true
-		}
+func (r *etcdResolver) update() {
+	addrs := make([]resolver.Address, 0, len(r.endpoints))
+	for _, addr := range r.endpoints {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Addr < addrs[j].Addr
+	})
+	if err := r.cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		logger.Warnf("update %s addresses from etcd: %v", r.keyPrefix, err)
 	}
-	return nil, false
+}
+
+func (r *etcdResolver) ResolveNow(rn resolver.ResolveNowOptions) {
+}
+
+func (r *etcdResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
 }
 
 func init() {
@@ -144,7 +207,10 @@ func GenerateAndRegisterEtcdResolver(cc configs.GrpcConfig) (schema string, err
 	if resolver.Get(cc.ResolverScheme) != nil {
 		return cc.ResolverScheme, nil
 	}
-	builder := NewEtcdBuilder(cc.ResolverScheme, cc.ResolverAddresses)
+	builder, err := NewEtcdBuilder(cc.ResolverScheme, cc.ResolverAddresses, cc.Tag, cc.Etcd)
+	if err != nil {
+		return
+	}
 	resolver.Register(builder)
 	schema = builder.Scheme()
 	return
@@ -0,0 +1,141 @@
+package resolver
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	"github.com/hsyan2008/hfw/grpc/discovery/register"
+	"github.com/hsyan2008/hfw/service/discovery/client"
+	"go.etcd.io/etcd/server/v3/embed"
+	"google.golang.org/grpc/resolver"
+)
+
+func freeURL(t *testing.T) url.URL {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return url.URL{Scheme: "http", Host: lis.Addr().String()}
+}
+
+//startEtcd 启动内嵌的etcd，返回client地址
+func startEtcd(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	cu, pu := freeURL(t), freeURL(t)
+	cfg.LCUrls, cfg.ACUrls = []url.URL{cu}, []url.URL{cu}
+	cfg.LPUrls, cfg.APUrls = []url.URL{pu}, []url.URL{pu}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		e.Close()
+		os.RemoveAll(dir)
+		t.Fatal("etcd start timeout")
+	}
+
+	return cu.Host, func() {
+		e.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestEtcd(t *testing.T) {
+	addr, stop := startEtcd(t)
+	defer stop()
+
+	conf := configs.EtcdConfig{Prefix: "test"}
+	r := register.NewEtcdRegister([]string{addr}, 10).(*register.EtcdRegister)
+	r.SetConfig(configs.ServerConfig{Etcd: conf})
+	err := r.Register(common.RegisterInfo{
+		Host:       "127.0.0.1",
+		Port:       1234,
+		ServerName: "hello",
+		ServerId:   "hello-1",
+		Tags:       []string{"v1"},
+		Meta:       map[string]string{common.WeightKey: "10"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewEtcdBuilder("etcd_test", []string{addr}, "v1", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := &testClientConn{states: make(chan resolver.State, 10)}
+	res, err := builder.Build(resolver.Target{Endpoint: "hello"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+
+	s := cc.wait(t)
+	if len(s.Addresses) != 1 || s.Addresses[0].Addr != "127.0.0.1:1234" {
+		t.Fatalf("unexpected addresses: %v", s.Addresses)
+	}
+	if w := common.GetAddressWeight(s.Addresses[0]); w != 10 {
+		t.Fatalf("weight = %d, want 10", w)
+	}
+
+	//其他tag的节点不使用
+	cli, err := client.NewEtcdClient([]string{addr}, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = cli.Put(ctx, common.EtcdServicePrefix("test", "hello")+"hello-2", `{"Addr":"127.0.0.1:1235","Tags":["v2"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = cc.wait(t)
+	if len(s.Addresses) != 1 {
+		t.Fatalf("unexpected addresses: %v", s.Addresses)
+	}
+
+	//租约失效后自动重新注册
+	leases, err := cli.Leases(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range leases.Leases {
+		if _, err = cli.Revoke(ctx, l.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s = cc.wait(t)
+	if len(s.Addresses) != 0 {
+		t.Fatalf("unexpected addresses after revoke: %v", s.Addresses)
+	}
+	s = cc.wait(t)
+	if len(s.Addresses) != 1 || s.Addresses[0].Addr != "127.0.0.1:1234" {
+		t.Fatalf("service should register again: %v", s.Addresses)
+	}
+
+	if err = r.UnRegister(); err != nil {
+		t.Fatal(err)
+	}
+	s = cc.wait(t)
+	if len(s.Addresses) != 0 {
+		t.Fatalf("unexpected addresses after unregister: %v", s.Addresses)
+	}
+}
@@ -0,0 +1,212 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	utils "github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/signal"
+	"github.com/hsyan2008/hfw/tomlutil"
+	"google.golang.org/grpc/resolver"
+)
+
+//FileEndpoint 地址文件里的节点，文件按服务名分组，如
+//{"hello": [{"Addr": "127.0.0.1:1234", "Weight": 10, "Zone": "bj-a", "Tags": ["v1"]}]}
+//或者toml格式
+//[[hello]]
+//Addr = "127.0.0.1:1234"
+//Weight = 10
+type FileEndpoint struct {
+	Addr string
+	//不配置则从Tags里的weight=N、zone=xxx解析
+	Weight int
+	Zone   string
+	Tags   []string
+	//元数据，如version，用于路由
+	Meta map[string]string
+}
+
+//LoadFileEndpoints 按扩展名解析，.toml是toml格式，其他是json格式
+func LoadFileEndpoints(file string) (services map[string][]FileEndpoint, err error) {
+	services = make(map[string][]FileEndpoint)
+	if strings.EqualFold(filepath.Ext(file), ".toml") {
+		err = tomlutil.Load(file, &services)
+	} else {
+		var b []byte
+		b, err = ioutil.ReadFile(file)
+		if err == nil {
+			err = json.Unmarshal(b, &services)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load address file %s failed: %v", file, err)
+	}
+
+	return
+}
+
+type fileBuilder struct {
+	scheme string
+	file   string
+	tag    string
+}
+
+func NewFileBuilder(scheme, file, tag string) resolver.Builder {
+	return &fileBuilder{scheme: scheme, file: file, tag: tag}
+}
+
+func (fb *fileBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	//监听目录，编辑器保存时一般是重命名覆盖文件
+	if err = watcher.Add(filepath.Dir(fb.file)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(signal.GetSignalContext().Ctx)
+	r := &fileResolver{
+		builder:     fb,
+		serviceName: target.Endpoint,
+		cc:          cc,
+		watcher:     watcher,
+		rn:          make(chan struct{}, 1),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	if err = r.resolve(); err != nil {
+		r.Close()
+		return nil, err
+	}
+	r.wg.Add(1)
+	go r.watch()
+
+	return r, nil
+}
+
+func (fb *fileBuilder) Scheme() string {
+	return fb.scheme
+}
+
+type fileResolver struct {
+	builder     *fileBuilder
+	serviceName string
+	cc          resolver.ClientConn
+	watcher     *fsnotify.Watcher
+	rn          chan struct{}
+	wg          sync.WaitGroup
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+func (r *fileResolver) resolve() error {
+	services, err := LoadFileEndpoints(r.builder.file)
+	if err != nil {
+		return err
+	}
+
+	addrs := make([]resolver.Address, 0)
+	for _, e := range services[r.serviceName] {
+		if r.builder.tag != "" && !utils.IsInStringArray(r.builder.tag, e.Tags) {
+			continue
+		}
+		addr := common.NewAddress(e.Addr, e.Tags, e.Meta)
+		addr = common.SetAddressWeight(addr, e.Weight)
+		addr = common.SetAddressZone(addr, e.Zone)
+		addrs = append(addrs, addr)
+	}
+
+	if err = r.cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		logger.Warnf("update %s addresses from %s: %v", r.serviceName, r.builder.file, err)
+	}
+
+	return nil
+}
+
+func (r *fileResolver) watch() {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-r.rn:
+		case ev, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != filepath.Clean(r.builder.file) || ev.Op&fsnotify.Chmod == ev.Op {
+				continue
+			}
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn("watch address file error:", err)
+			continue
+		}
+		//解析失败则继续使用旧的地址
+		if err := r.resolve(); err != nil {
+			logger.Warn(err)
+		}
+	}
+}
+
+func (r *fileResolver) ResolveNow(rno resolver.ResolveNowOptions) {
+	select {
+	case r.rn <- struct{}{}:
+	default:
+	}
+}
+
+func (r *fileResolver) Close() {
+	r.cancel()
+	r.watcher.Close()
+	r.wg.Wait()
+}
+
+func init() {
+	common.ResolverFuncMap[common.FileResolver] = GenerateAndRegisterFileResolver
+}
+
+func GenerateAndRegisterFileResolver(cc configs.GrpcConfig) (schema string, err error) {
+	if len(cc.ResolverAddresses) == 0 {
+		return "", fmt.Errorf("GrpcConfig has nil ResolverAddresses")
+	}
+	cc, err = CompleteResolverScheme(cc)
+	if err != nil {
+		return
+	}
+
+	lock.RLock()
+	if resolver.Get(cc.ResolverScheme) != nil {
+		lock.RUnlock()
+		return cc.ResolverScheme, nil
+	}
+	lock.RUnlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if resolver.Get(cc.ResolverScheme) != nil {
+		return cc.ResolverScheme, nil
+	}
+	file := cc.ResolverAddresses[0]
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(utils.GetAppPath(), file)
+	}
+	builder := NewFileBuilder(cc.ResolverScheme, file, cc.Tag)
+	resolver.Register(builder)
+	schema = builder.Scheme()
+	return
+}
@@ -0,0 +1,97 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	"google.golang.org/grpc/resolver"
+)
+
+type testClientConn struct {
+	resolver.ClientConn
+	states chan resolver.State
+}
+
+func (cc *testClientConn) UpdateState(s resolver.State) error {
+	cc.states <- s
+	return nil
+}
+
+func (cc *testClientConn) ReportError(err error) {
+}
+
+func (cc *testClientConn) wait(t *testing.T) resolver.State {
+	select {
+	case s := <-cc.states:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait UpdateState timeout")
+	}
+	return resolver.State{}
+}
+
+func TestFileResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "addrs.json")
+	err = ioutil.WriteFile(file, []byte(`{"hello": [{"Addr": "127.0.0.1:1234", "Weight": 10, "Tags": ["v1"]}, {"Addr": "127.0.0.1:1235", "Tags": ["v2"]}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cc := &testClientConn{states: make(chan resolver.State, 10)}
+	r, err := NewFileBuilder("file_test", file, "v1").Build(resolver.Target{Endpoint: "hello"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	s := cc.wait(t)
+	if len(s.Addresses) != 1 || s.Addresses[0].Addr != "127.0.0.1:1234" {
+		t.Fatalf("unexpected addresses: %v", s.Addresses)
+	}
+	if w := common.GetAddressWeight(s.Addresses[0]); w != 10 {
+		t.Fatalf("weight = %d, want 10", w)
+	}
+
+	err = ioutil.WriteFile(file, []byte(`{"hello": [{"Addr": "127.0.0.1:1236", "Tags": ["v1"]}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		s = cc.wait(t)
+		if len(s.Addresses) == 1 && s.Addresses[0].Addr == "127.0.0.1:1236" {
+			break
+		}
+	}
+}
+
+func TestDNSResolver(t *testing.T) {
+	cc := &testClientConn{states: make(chan resolver.State, 10)}
+	r, err := NewDNSBuilder("dns_test", "", []string{"127.0.0.1:80", "127.0.0.1:80"}, time.Hour).Build(resolver.Target{}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	s := cc.wait(t)
+	if len(s.Addresses) != 1 || s.Addresses[0].Addr != "127.0.0.1:80" {
+		t.Fatalf("unexpected addresses: %v", s.Addresses)
+	}
+
+	//结果没变化不会再更新
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	select {
+	case s = <-cc.states:
+		t.Fatalf("unexpected update: %v", s.Addresses)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,555 @@
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	utils "github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/signal"
+	"google.golang.org/grpc/resolver"
+)
+
+//pod里的service account
+const (
+	k8sServiceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount/"
+	k8sTokenFile          = k8sServiceAccountPath + "token"
+	k8sCAFile             = k8sServiceAccountPath + "ca.crt"
+	k8sNamespaceFile      = k8sServiceAccountPath + "namespace"
+
+	defaultK8sNamespace = "default"
+	defaultK8sPortName  = "grpc"
+	//watch的超时时间，超时后重新watch
+	k8sWatchTimeout = 300
+	k8sRetryDelay   = time.Second
+)
+
+//k8sClient 只用到了list和watch，不依赖client-go
+type k8sClient struct {
+	host string
+	//每次请求都读取，token会定期轮换
+	tokenFile string
+	client    *http.Client
+}
+
+//newK8sClient apiServer为空则使用pod里的配置
+//指定apiServer时，ca和token优先使用conf里的，其次是pod里的service account
+func newK8sClient(apiServer string, conf configs.K8sConfig) (*k8sClient, error) {
+	if apiServer != "" {
+		if !strings.HasPrefix(apiServer, "http") {
+			apiServer = "https://" + apiServer
+		}
+		caFile, tokenFile := k8sFile(conf.CAFile, k8sCAFile), k8sFile(conf.TokenFile, k8sTokenFile)
+		//不是https时不自动带上pod的token
+		if strings.HasPrefix(apiServer, "http://") && conf.TokenFile == "" {
+			tokenFile = ""
+		}
+		tlsConfig := &tls.Config{InsecureSkipVerify: conf.InsecureSkipVerify}
+		if caFile != "" {
+			pool, err := k8sCertPool(caFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = pool
+		}
+		return &k8sClient{
+			host:      strings.TrimSuffix(apiServer, "/"),
+			tokenFile: tokenFile,
+			client: &http.Client{
+				Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+			},
+		}, nil
+	}
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in kubernetes, please specify ResolverAddresses")
+	}
+	pool, err := k8sCertPool(k8sCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &k8sClient{
+		host:      "https://" + net.JoinHostPort(host, port),
+		tokenFile: k8sTokenFile,
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+//k8sFile 配置了则使用配置的文件，否则pod里的文件存在时使用
+func k8sFile(file, inCluster string) string {
+	if file != "" {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(utils.GetAppPath(), file)
+		}
+		return file
+	}
+	if _, err := os.Stat(inCluster); err == nil {
+		return inCluster
+	}
+	return ""
+}
+
+func k8sCertPool(caFile string) (*x509.CertPool, error) {
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid ca file: %s", caFile)
+	}
+	return pool, nil
+}
+
+func (c *k8sClient) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, c.host+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if c.tokenFile != "" {
+		token, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("k8s api %s: %s %s", path, resp.Status, body)
+	}
+
+	return resp, nil
+}
+
+type k8sObjectMeta struct {
+	Name            string `json:"name"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+type k8sPort struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+type k8sEndpoints struct {
+	Metadata k8sObjectMeta `json:"metadata"`
+	Subsets  []struct {
+		//notReadyAddresses不使用
+		Addresses []struct {
+			IP       string `json:"ip"`
+			NodeName string `json:"nodeName"`
+		} `json:"addresses"`
+		Ports []k8sPort `json:"ports"`
+	} `json:"subsets"`
+}
+
+type k8sEndpointSlice struct {
+	Metadata  k8sObjectMeta `json:"metadata"`
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			//为空表示ready
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+		NodeName string `json:"nodeName"`
+		Zone     string `json:"zone"`
+	} `json:"endpoints"`
+	Ports []k8sPort `json:"ports"`
+}
+
+type k8sList struct {
+	Metadata k8sObjectMeta     `json:"metadata"`
+	Items    []json.RawMessage `json:"items"`
+}
+
+type k8sEvent struct {
+	//ADDED、MODIFIED、DELETED、BOOKMARK、ERROR
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+//pickPort 优先使用指定名字的端口
+func pickPort(ports []k8sPort, name string) int {
+	for _, p := range ports {
+		if p.Name == name {
+			return p.Port
+		}
+	}
+	if len(ports) > 0 {
+		return ports[0].Port
+	}
+	return 0
+}
+
+func (r *k8sResolver) parseEndpoints(raw json.RawMessage) (name string, addrs []resolver.Address, err error) {
+	var e k8sEndpoints
+	if err = json.Unmarshal(raw, &e); err != nil {
+		return
+	}
+	for _, subset := range e.Subsets {
+		port := pickPort(subset.Ports, r.builder.portName)
+		if port == 0 {
+			continue
+		}
+		for _, a := range subset.Addresses {
+			addr := resolver.Address{Addr: net.JoinHostPort(a.IP, strconv.Itoa(port))}
+			addrs = append(addrs, common.SetAddressMeta(addr, map[string]string{"node": a.NodeName}))
+		}
+	}
+
+	return e.Metadata.Name, addrs, nil
+}
+
+func (r *k8sResolver) parseEndpointSlice(raw json.RawMessage) (name string, addrs []resolver.Address, err error) {
+	var s k8sEndpointSlice
+	if err = json.Unmarshal(raw, &s); err != nil {
+		return
+	}
+	port := pickPort(s.Ports, r.builder.portName)
+	if port == 0 {
+		return s.Metadata.Name, nil, nil
+	}
+	for _, e := range s.Endpoints {
+		if e.Conditions.Ready != nil && !*e.Conditions.Ready {
+			continue
+		}
+		for _, ip := range e.Addresses {
+			addr := resolver.Address{Addr: net.JoinHostPort(ip, strconv.Itoa(port))}
+			addr = common.SetAddressMeta(addr, map[string]string{"node": e.NodeName, common.ZoneKey: e.Zone})
+			addrs = append(addrs, common.SetAddressZone(addr, e.Zone))
+		}
+	}
+
+	return s.Metadata.Name, addrs, nil
+}
+
+type k8sBuilder struct {
+	scheme    string
+	client    *k8sClient
+	namespace string
+	portName  string
+	slices    bool
+}
+
+func NewK8sBuilder(scheme, apiServer string, conf configs.K8sConfig) (resolver.Builder, error) {
+	client, err := newK8sClient(apiServer, conf)
+	if err != nil {
+		return nil, err
+	}
+	kb := &k8sBuilder{
+		scheme:    scheme,
+		client:    client,
+		namespace: conf.Namespace,
+		portName:  conf.PortName,
+		slices:    conf.EndpointSlices,
+	}
+	if kb.namespace == "" {
+		if ns, err := ioutil.ReadFile(k8sNamespaceFile); err == nil {
+			kb.namespace = strings.TrimSpace(string(ns))
+		}
+	}
+	if kb.namespace == "" {
+		kb.namespace = defaultK8sNamespace
+	}
+	if kb.portName == "" {
+		kb.portName = defaultK8sPortName
+	}
+
+	return kb, nil
+}
+
+func (kb *k8sBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(signal.GetSignalContext().Ctx)
+	r := &k8sResolver{
+		builder:   kb,
+		service:   target.Endpoint,
+		namespace: kb.namespace,
+		cc:        cc,
+		objects:   make(map[string][]resolver.Address),
+		rn:        make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	//service.namespace或者service.namespace.svc.cluster.local
+	if parts := strings.Split(r.service, "."); len(parts) > 1 {
+		r.service, r.namespace = parts[0], parts[1]
+	}
+	if kb.slices {
+		r.path = fmt.Sprintf("/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices", r.namespace)
+		r.selector = url.Values{"labelSelector": {"kubernetes.io/service-name=" + r.service}}
+		r.parse = r.parseEndpointSlice
+	} else {
+		r.path = fmt.Sprintf("/api/v1/namespaces/%s/endpoints", r.namespace)
+		r.selector = url.Values{"fieldSelector": {"metadata.name=" + r.service}}
+		r.parse = r.parseEndpoints
+	}
+
+	rv, err := r.list()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r.wg.Add(1)
+	go r.watch(rv)
+
+	return r, nil
+}
+
+func (kb *k8sBuilder) Scheme() string {
+	return kb.scheme
+}
+
+type k8sResolver struct {
+	builder   *k8sBuilder
+	service   string
+	namespace string
+	path      string
+	selector  url.Values
+	parse     func(json.RawMessage) (string, []resolver.Address, error)
+
+	cc resolver.ClientConn
+	//Endpoints只有一个，EndpointSlice可能有多个
+	objects map[string][]resolver.Address
+	//上次的结果，没有变化则不更新
+	last     string
+	resolved bool
+
+	rn     chan struct{}
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+//list 全量获取，返回resourceVersion用于watch
+func (r *k8sResolver) list() (string, error) {
+	resp, err := r.builder.client.get(r.ctx, r.path, r.selector)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var list k8sList
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", err
+	}
+	objects := make(map[string][]resolver.Address)
+	for _, item := range list.Items {
+		name, addrs, err := r.parse(item)
+		if err != nil {
+			return "", err
+		}
+		objects[name] = addrs
+	}
+	r.objects = objects
+	r.update()
+
+	return list.Metadata.ResourceVersion, nil
+}
+
+//watch 从resourceVersion开始watch，出错后重新list
+func (r *k8sResolver) watch(rv string) {
+	defer r.wg.Done()
+	var err error
+	for {
+		if rv == "" {
+			if rv, err = r.list(); err != nil {
+				if r.ctx.Err() != nil {
+					return
+				}
+				logger.Warnf("k8s list %s/%s error: %v", r.namespace, r.service, err)
+				if !r.wait(k8sRetryDelay) {
+					return
+				}
+				continue
+			}
+		}
+		rv, err = r.watchFrom(rv)
+		if r.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Warnf("k8s watch %s/%s error: %v", r.namespace, r.service, err)
+			rv = ""
+			if !r.wait(k8sRetryDelay) {
+				return
+			}
+		}
+	}
+}
+
+//wait ResolveNow会提前结束等待，返回false表示已经关闭
+func (r *k8sResolver) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-r.ctx.Done():
+		return false
+	case <-r.rn:
+	case <-timer.C:
+	}
+	return true
+}
+
+//watchFrom 返回最新的resourceVersion，服务端超时正常结束时err为nil
+func (r *k8sResolver) watchFrom(rv string) (string, error) {
+	query := url.Values{
+		"watch":               {"true"},
+		"resourceVersion":     {rv},
+		"allowWatchBookmarks": {"true"},
+		"timeoutSeconds":      {strconv.Itoa(k8sWatchTimeout)},
+	}
+	for k, v := range r.selector {
+		query[k] = v
+	}
+	resp, err := r.builder.client.get(r.ctx, r.path, query)
+	if err != nil {
+		return rv, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var ev k8sEvent
+		if err = decoder.Decode(&ev); err != nil {
+			if err == io.EOF {
+				return rv, nil
+			}
+			return rv, err
+		}
+		if ev.Type == "ERROR" {
+			//一般是410 Gone，resourceVersion过期，需要重新list
+			return rv, fmt.Errorf("watch error event: %s", ev.Object)
+		}
+		var obj struct {
+			Metadata k8sObjectMeta `json:"metadata"`
+		}
+		if err = json.Unmarshal(ev.Object, &obj); err != nil {
+			return rv, err
+		}
+		rv = obj.Metadata.ResourceVersion
+		switch ev.Type {
+		case "ADDED", "MODIFIED":
+			name, addrs, err := r.parse(ev.Object)
+			if err != nil {
+				return rv, err
+			}
+			r.objects[name] = addrs
+		case "DELETED":
+			delete(r.objects, obj.Metadata.Name)
+		default:
+			continue
+		}
+		r.update()
+	}
+}
+
+//update 合并所有对象的地址，去重排序
+func (r *k8sResolver) update() {
+	var addrs []resolver.Address
+	exists := make(map[string]bool)
+	for _, list := range r.objects {
+		for _, addr := range list {
+			if !exists[addr.Addr] {
+				exists[addr.Addr] = true
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Addr < addrs[j].Addr
+	})
+
+	var list []string
+	for _, addr := range addrs {
+		list = append(list, addr.Addr+"@"+common.GetAddressZone(addr))
+	}
+	key := strings.Join(list, ",")
+	if r.resolved && key == r.last {
+		return
+	}
+	r.resolved = true
+	r.last = key
+	if addrs == nil {
+		addrs = make([]resolver.Address, 0)
+	}
+	if err := r.cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		logger.Warnf("update k8s addresses %s/%s: %v", r.namespace, r.service, err)
+	}
+}
+
+func (r *k8sResolver) ResolveNow(rno resolver.ResolveNowOptions) {
+	select {
+	case r.rn <- struct{}{}:
+	default:
+	}
+}
+
+func (r *k8sResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func init() {
+	common.ResolverFuncMap[common.K8sResolver] = GenerateAndRegisterK8sResolver
+}
+
+func GenerateAndRegisterK8sResolver(cc configs.GrpcConfig) (schema string, err error) {
+	cc, err = CompleteResolverScheme(cc)
+	if err != nil {
+		return
+	}
+
+	lock.RLock()
+	if resolver.Get(cc.ResolverScheme) != nil {
+		lock.RUnlock()
+		return cc.ResolverScheme, nil
+	}
+	lock.RUnlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if resolver.Get(cc.ResolverScheme) != nil {
+		return cc.ResolverScheme, nil
+	}
+	var apiServer string
+	if len(cc.ResolverAddresses) > 0 {
+		apiServer = cc.ResolverAddresses[0]
+	}
+	builder, err := NewK8sBuilder(cc.ResolverScheme, apiServer, cc.K8s)
+	if err != nil {
+		return
+	}
+	resolver.Register(builder)
+	schema = builder.Scheme()
+	return
+}
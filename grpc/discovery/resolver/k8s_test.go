@@ -0,0 +1,140 @@
+package resolver
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	"google.golang.org/grpc/resolver"
+)
+
+const testEndpoints = `{"metadata":{"name":"hello","resourceVersion":"%s"},"subsets":[{"addresses":[{"ip":"%s"}],"ports":[{"name":"http","port":80},{"name":"grpc","port":9090}]}]}`
+
+//fakeK8sServer list返回events[0]，watch依次返回后面的事件
+func fakeK8sServer(t *testing.T, path string, list string, events ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		if r.FormValue("watch") != "true" {
+			fmt.Fprint(w, list)
+			return
+		}
+		if r.FormValue("resourceVersion") != "1" {
+			//后续的watch一直阻塞
+			<-r.Context().Done()
+			return
+		}
+		for _, ev := range events {
+			fmt.Fprintln(w, ev)
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+func TestK8sResolverEndpoints(t *testing.T) {
+	list := `{"metadata":{"resourceVersion":"1"},"items":[` + fmt.Sprintf(testEndpoints, "1", "10.0.0.1") + `]}`
+	event := `{"type":"MODIFIED","object":` + fmt.Sprintf(testEndpoints, "2", "10.0.0.2") + `}`
+	s := fakeK8sServer(t, "/api/v1/namespaces/test/endpoints", list, event)
+	defer s.Close()
+
+	builder, err := NewK8sBuilder("k8s_test", s.URL, configs.K8sConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := &testClientConn{states: make(chan resolver.State, 10)}
+	r, err := builder.Build(resolver.Target{Endpoint: "hello.test"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	st := cc.wait(t)
+	if len(st.Addresses) != 1 || st.Addresses[0].Addr != "10.0.0.1:9090" {
+		t.Fatalf("unexpected addresses: %v", st.Addresses)
+	}
+	st = cc.wait(t)
+	if len(st.Addresses) != 1 || st.Addresses[0].Addr != "10.0.0.2:9090" {
+		t.Fatalf("unexpected addresses: %v", st.Addresses)
+	}
+}
+
+func TestK8sResolverEndpointSlices(t *testing.T) {
+	slice := `{"metadata":{"name":"%s","resourceVersion":"1"},"endpoints":[{"addresses":["%s"],"zone":"a"},{"addresses":["10.0.0.9"],"conditions":{"ready":false}}],"ports":[{"name":"grpc","port":9090}]}`
+	list := `{"metadata":{"resourceVersion":"1"},"items":[` + fmt.Sprintf(slice, "hello-a", "10.0.0.1") + `,` + fmt.Sprintf(slice, "hello-b", "10.0.0.2") + `]}`
+	event := `{"type":"DELETED","object":` + fmt.Sprintf(slice, "hello-a", "10.0.0.1") + `}`
+	s := fakeK8sServer(t, "/apis/discovery.k8s.io/v1/namespaces/test/endpointslices", list, event)
+	defer s.Close()
+
+	builder, err := NewK8sBuilder("k8s_slice_test", s.URL, configs.K8sConfig{Namespace: "test", EndpointSlices: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := &testClientConn{states: make(chan resolver.State, 10)}
+	r, err := builder.Build(resolver.Target{Endpoint: "hello"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	st := cc.wait(t)
+	if len(st.Addresses) != 2 || st.Addresses[0].Addr != "10.0.0.1:9090" || st.Addresses[1].Addr != "10.0.0.2:9090" {
+		t.Fatalf("unexpected addresses: %v", st.Addresses)
+	}
+	if zone := common.GetAddressZone(st.Addresses[0]); zone != "a" {
+		t.Fatalf("zone = %s, want a", zone)
+	}
+	st = cc.wait(t)
+	if len(st.Addresses) != 1 || st.Addresses[0].Addr != "10.0.0.2:9090" {
+		t.Fatalf("unexpected addresses: %v", st.Addresses)
+	}
+}
+
+func TestK8sClientTLS(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sa-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "{}")
+	}))
+	defer s.Close()
+
+	dir := t.TempDir()
+	caFile, tokenFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "token")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(tokenFile, []byte("sa-token\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newK8sClient(s.URL, configs.K8sConfig{CAFile: caFile, TokenFile: tokenFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.get(context.Background(), "/api/v1/namespaces/test/endpoints", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	//没有ca时证书校验失败
+	c, err = newK8sClient(s.URL, configs.K8sConfig{TokenFile: tokenFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.get(context.Background(), "/api/v1/namespaces/test/endpoints", nil); err == nil {
+		t.Fatal("should fail without ca")
+	}
+}
@@ -0,0 +1,126 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/grpc/discovery/common"
+	"github.com/hsyan2008/hfw/grpc/discovery/memory"
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/signal"
+	"google.golang.org/grpc/resolver"
+)
+
+type memoryBuilder struct {
+	scheme   string
+	registry *memory.Registry
+	tag      string
+}
+
+func NewMemoryBuilder(scheme string, registry *memory.Registry, tag string) resolver.Builder {
+	return &memoryBuilder{scheme: scheme, registry: registry, tag: tag}
+}
+
+func (mb *memoryBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(signal.GetSignalContext().Ctx)
+	r := &memoryResolver{
+		builder:     mb,
+		serviceName: target.Endpoint,
+		cc:          cc,
+		rn:          make(chan struct{}, 1),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	r.changes, r.stop = mb.registry.Watch(r.serviceName)
+	r.resolve()
+	r.wg.Add(1)
+	go r.watch()
+
+	return r, nil
+}
+
+func (mb *memoryBuilder) Scheme() string {
+	return mb.scheme
+}
+
+type memoryResolver struct {
+	builder     *memoryBuilder
+	serviceName string
+	cc          resolver.ClientConn
+	changes     <-chan struct{}
+	stop        func()
+	rn          chan struct{}
+	wg          sync.WaitGroup
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+func (r *memoryResolver) resolve() {
+	addrs := make([]resolver.Address, 0)
+	for _, ins := range r.builder.registry.Instances(r.serviceName, r.builder.tag) {
+		addrs = append(addrs, common.NewAddress(ins.Addr, ins.Tags, ins.Meta))
+	}
+	if err := r.cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		logger.Warnf("update %s addresses from memory: %v", r.serviceName, err)
+	}
+}
+
+func (r *memoryResolver) watch() {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-r.rn:
+		case <-r.changes:
+		}
+		r.resolve()
+	}
+}
+
+func (r *memoryResolver) ResolveNow(rno resolver.ResolveNowOptions) {
+	select {
+	case r.rn <- struct{}{}:
+	default:
+	}
+}
+
+func (r *memoryResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+	r.stop()
+}
+
+func init() {
+	common.ResolverFuncMap[common.MemoryResolver] = GenerateAndRegisterMemoryResolver
+}
+
+func GenerateAndRegisterMemoryResolver(cc configs.GrpcConfig) (schema string, err error) {
+	if len(cc.ResolverAddresses) == 0 {
+		return "", fmt.Errorf("GrpcConfig has nil ResolverAddresses")
+	}
+	cc, err = CompleteResolverScheme(cc)
+	if err != nil {
+		return
+	}
+
+	lock.RLock()
+	if resolver.Get(cc.ResolverScheme) != nil {
+		lock.RUnlock()
+		return cc.ResolverScheme, nil
+	}
+	lock.RUnlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if resolver.Get(cc.ResolverScheme) != nil {
+		return cc.ResolverScheme, nil
+	}
+	builder := NewMemoryBuilder(cc.ResolverScheme, memory.Get(cc.ResolverAddresses[0]), cc.Tag)
+	resolver.Register(builder)
+	schema = builder.Scheme()
+	return
+}
@@ -46,7 +46,7 @@ func (r *staticResolver) start() {
 	addrStrs := r.addrsStore[r.target.Endpoint]
 	addrs := make([]resolver.Address, len(addrStrs))
 	for i, s := range addrStrs {
-		addrs[i] = resolver.Address{Addr: s}
+		addrs[i] = common.ParseStaticAddress(s)
 	}
 	r.cc.UpdateState(resolver.State{Addresses: addrs})
 }
@@ -0,0 +1,143 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hsyan2008/hfw/configs"
+	logger "github.com/hsyan2008/hfw/logging"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+//Watcher 监听服务的节点集合，grpc和http共用resolver，支持consul、etcd、k8s、file、dns、memory、static
+type Watcher struct {
+	serviceName string
+	key         string
+	r           resolver.Resolver
+
+	lock  sync.RWMutex
+	addrs []resolver.Address
+	//节点变化时关闭
+	changed chan struct{}
+	closed  bool
+
+	//Watch的次数，都Close后才关闭resolver
+	refs int
+}
+
+var watcherMap = make(map[string]*Watcher)
+var watcherLock = new(sync.Mutex)
+
+//Watch 相同的resolver共用一个Watcher，不用时需要Close
+func Watch(cc configs.GrpcConfig) (w *Watcher, err error) {
+	if cc.ServerName == "" {
+		return nil, errors.New("nil ServerName")
+	}
+	scheme, err := GetAndRegisterResolver(cc)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s_%s", scheme, cc.ServerName)
+	watcherLock.Lock()
+	defer watcherLock.Unlock()
+
+	if w, ok := watcherMap[key]; ok {
+		w.refs++
+		return w, nil
+	}
+
+	builder := resolver.Get(scheme)
+	if builder == nil {
+		return nil, fmt.Errorf("resolver %s not registered", scheme)
+	}
+	w = &Watcher{serviceName: cc.ServerName, key: key, changed: make(chan struct{}), refs: 1}
+	w.r, err = builder.Build(resolver.Target{Scheme: scheme, Endpoint: cc.ServerName},
+		&watcherConn{w: w}, resolver.BuildOptions{DisableServiceConfig: true})
+	if err != nil {
+		return nil, err
+	}
+	watcherMap[key] = w
+
+	return w, nil
+}
+
+func (w *Watcher) ServiceName() string {
+	return w.serviceName
+}
+
+//Addresses 当前的节点，不能修改
+func (w *Watcher) Addresses() []resolver.Address {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.addrs
+}
+
+//Changed 返回的channel在节点下一次变化时关闭
+func (w *Watcher) Changed() <-chan struct{} {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.changed
+}
+
+func (w *Watcher) update(addrs []resolver.Address) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return
+	}
+	w.addrs = addrs
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+//Close 所有Watch的地方都Close后才关闭
+func (w *Watcher) Close() {
+	watcherLock.Lock()
+	w.refs--
+	if w.refs > 0 {
+		watcherLock.Unlock()
+		return
+	}
+	if watcherMap[w.key] == w {
+		delete(watcherMap, w.key)
+	}
+	watcherLock.Unlock()
+
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return
+	}
+	w.closed = true
+	w.lock.Unlock()
+
+	w.r.Close()
+}
+
+//watcherConn 实现resolver.ClientConn，只接收地址
+type watcherConn struct {
+	w *Watcher
+}
+
+func (c *watcherConn) UpdateState(s resolver.State) error {
+	c.w.update(s.Addresses)
+	return nil
+}
+
+func (c *watcherConn) ReportError(err error) {
+	logger.Warnf("resolve %s error: %v", c.w.serviceName, err)
+}
+
+func (c *watcherConn) NewAddress(addrs []resolver.Address) {
+	c.w.update(addrs)
+}
+
+func (c *watcherConn) NewServiceConfig(string) {
+}
+
+func (c *watcherConn) ParseServiceConfig(string) *serviceconfig.ParseResult {
+	return &serviceconfig.ParseResult{Err: errors.New("service config is not supported")}
+}
@@ -8,18 +8,22 @@
 //s, err := server.NewServer(hfw.Config.Server, opt...)
 //RegisterHelloServiceServer(s, &HelloServiceImpl{auth: auth.NewAuth("value")})
 //go server.StartServer(s, ":1234")
+//如果配置了ServerConfig.Auth.IsEnable，hfw.NewGrpcServer的拦截器会自动认证，handler里不需要再调用Auth
+//如果需要双向认证(mTLS)，配置ServerConfig的CaFile，客户端配置GrpcConfig的CaFile、CertFile和KeyFile
+//handler里通过auth.PeerIdentityFromContext(ctx)获取客户端身份
 package server
 
 import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"time"
 
-	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
+	logger "github.com/hsyan2008/hfw/logging"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
@@ -54,6 +58,7 @@ func NewServer(serverConfig configs.ServerConfig, opt ...grpc.ServerOption) (*gr
 	if common.IsExist(serverConfig.CertFile) && common.IsExist(serverConfig.KeyFile) {
 		logger.Debug("init grpc server with certFile and keyFile")
 		t := &ServerCreds{
+			CaFile:   serverConfig.CaFile,
 			CertFile: serverConfig.CertFile,
 			KeyFile:  serverConfig.KeyFile,
 		}
@@ -84,7 +89,10 @@ func NewServer(serverConfig configs.ServerConfig, opt ...grpc.ServerOption) (*gr
 }
 
 func (t *ServerCreds) GetCredentials() (credentials.TransportCredentials, error) {
-	if common.IsExist(t.CaFile) {
+	if len(t.CaFile) > 0 {
+		if !common.IsExist(t.CaFile) {
+			return nil, fmt.Errorf("ca file: %s not exist", t.CaFile)
+		}
 		return t.GetCredentialsByCA()
 	}
 
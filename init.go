@@ -3,16 +3,27 @@ package hfw
 import (
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 
-	logger "github.com/hsyan2008/go-logger"
+	golog "github.com/hsyan2008/go-logger"
+	"github.com/hsyan2008/hfw/accesslog"
+	"github.com/hsyan2008/hfw/admin"
+	"github.com/hsyan2008/hfw/breaker"
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/curl"
 	"github.com/hsyan2008/hfw/db"
+	"github.com/hsyan2008/hfw/dump"
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/profiler"
 	"github.com/hsyan2008/hfw/prometheus"
 	"github.com/hsyan2008/hfw/redis"
+	"github.com/hsyan2008/hfw/trace"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -50,6 +61,16 @@ func Init() (err error) {
 		return err
 	}
 
+	//访问日志
+	if err = accesslog.Init(Config.Logger.AccessLog); err != nil {
+		logger.Warn(err)
+		return fmt.Errorf("init access log faild: %s", err.Error())
+	}
+	if err = dump.Init(Config.Dump); err != nil {
+		logger.Warn(err)
+		return fmt.Errorf("init dump faild: %s", err.Error())
+	}
+
 	//初始化redis
 	if len(Config.Redis.Addresses) > 0 {
 		logger.Info("begin to connect default REDIS server:", Config.Redis.Addresses)
@@ -78,6 +99,30 @@ func Init() (err error) {
 		Handle(Config.Prometheus.RoutePath, promhttp.Handler())
 	}
 
+	//熔断的默认配置
+	breaker.Init(Config.Breaker)
+
+	//curl的客户端配置
+	if err = curl.Init(Config.Curl); err != nil {
+		return fmt.Errorf("init curl faild: %s", err.Error())
+	}
+
+	//分布式追踪
+	if err = trace.Init(Config.Trace); err != nil {
+		return fmt.Errorf("init trace faild: %s", err.Error())
+	}
+
+	//管理接口
+	if err = admin.Init(Config.Admin); err != nil {
+		return fmt.Errorf("init admin faild: %s", err.Error())
+	}
+
+	//异常时自动采集profile
+	profiler.SetOnline(func() int { return int(atomic.LoadUint32(&online)) })
+	if err = profiler.Init(Config.Profiler); err != nil {
+		return fmt.Errorf("init profiler faild: %s", err.Error())
+	}
+
 	return
 }
 
@@ -88,33 +133,32 @@ func initLog() error {
 
 	if len(lc.LogFile) > 0 {
 		logger.SetLevelStr(lc.LogLevel)
-		logger.SetConsole(lc.IsConsole)
-		if strings.ToLower(lc.LogType) == "daily" {
-			logger.SetRollingDaily(lc.LogFile)
-		} else if strings.ToLower(lc.LogType) == "roll" {
-			logger.SetRollingFile(lc.LogFile, lc.LogMaxNum, lc.LogSize, lc.LogUnit)
-		} else {
-			return errors.New("undefined logtype")
-		}
 	} else {
 		logger.SetLevelStr("debug")
-		var path string
-		if common.IsExist("/opt/log") {
-			path = filepath.Join("/opt/log", common.GetAppName()+".log")
-		} else {
-			path = filepath.Join(common.GetAppPath(), common.GetAppName()+".log")
-		}
-		logger.SetRollingFile(path, 2, 1, "GB")
 	}
 
+	//没有配置文件时默认输出到控制台
+	isConsole := lc.IsConsole || len(lc.LogFile) == 0
 	if common.IsGoTest() {
-		if testing.Verbose() {
-			logger.SetConsole(true)
-		} else {
-			logger.SetConsole(false)
-		}
+		isConsole = testing.Verbose()
 	} else if common.IsGoRun() {
-		logger.SetConsole(true)
+		isConsole = true
+	}
+
+	switch strings.ToLower(lc.Handler) {
+	case "", "go-logger":
+		if err := initGoLogger(lc, isConsole); err != nil {
+			return err
+		}
+		logger.SetHandler(nil)
+	case "json":
+		h, err := newJSONLogHandler(lc, isConsole)
+		if err != nil {
+			return err
+		}
+		logger.SetHandler(h)
+	default:
+		return fmt.Errorf("unsupport logger handler: %s", lc.Handler)
 	}
 
 	// logger.SetPrefix(fmt.Sprintf("Pid:%d", GetPid()))
@@ -123,3 +167,39 @@ func initLog() error {
 
 	return nil
 }
+
+func initGoLogger(lc configs.LoggerConfig, isConsole bool) error {
+	golog.SetConsole(isConsole)
+	if len(lc.LogFile) > 0 {
+		if strings.ToLower(lc.LogType) == "daily" {
+			golog.SetRollingDaily(lc.LogFile)
+		} else if strings.ToLower(lc.LogType) == "roll" {
+			golog.SetRollingFile(lc.LogFile, lc.LogMaxNum, lc.LogSize, lc.LogUnit)
+		} else {
+			return errors.New("undefined logtype")
+		}
+	} else {
+		golog.SetRollingFile(accesslog.LogFile("", ".log"), 2, 1, "GB")
+	}
+
+	return nil
+}
+
+//newJSONLogHandler 文件的规则同go-logger
+func newJSONLogHandler(lc configs.LoggerConfig, isConsole bool) (logger.Handler, error) {
+	logType, maxNum, size, unit := lc.LogType, lc.LogMaxNum, lc.LogSize, lc.LogUnit
+	if len(lc.LogFile) == 0 {
+		logType, maxNum, size, unit = "roll", 2, 1, "GB"
+	} else if t := strings.ToLower(logType); t != "daily" && t != "roll" {
+		return nil, errors.New("undefined logtype")
+	}
+	w, err := accesslog.NewRollingWriter(accesslog.LogFile(lc.LogFile, ".log"), logType, maxNum, size, unit)
+	if err != nil {
+		return nil, err
+	}
+	if isConsole {
+		return logger.NewJSONHandler(io.MultiWriter(w, os.Stdout)), nil
+	}
+
+	return logger.NewJSONHandler(w), nil
+}
@@ -0,0 +1,153 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	logger "github.com/hsyan2008/go-logger"
+)
+
+//GoLogger 默认的Handler，输出到go-logger配置的文件和控制台，字段以key=value追加在后面
+var GoLogger Handler = goLoggerHandler{}
+
+type goLoggerHandler struct{}
+
+func (goLoggerHandler) Handle(r *Record) {
+	msg := r.Msg
+	if len(r.Fields) > 0 {
+		var buf bytes.Buffer
+		buf.WriteString(msg)
+		for _, f := range r.Fields {
+			buf.WriteByte(' ')
+			buf.WriteString(f.Key)
+			buf.WriteByte('=')
+			buf.WriteString(fieldString(f.Value))
+		}
+		msg = buf.String()
+	}
+	//logger.Output和Handle各一层
+	logger.Output(r.CallDepth+2, r.Level.String(), fullPrefix(r), msg)
+}
+
+//fullPrefix 和go-logger的格式一致
+func fullPrefix(r *Record) string {
+	if r.TraceID == "" {
+		return r.Prefix
+	}
+	if r.Prefix == "" {
+		return "trace_id:" + r.TraceID
+	}
+	return "trace_id:" + r.TraceID + " " + r.Prefix
+}
+
+func fieldString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		if val == "" || bytes.ContainsAny([]byte(val), " =\"") {
+			return strconv.Quote(val)
+		}
+		return val
+	case error:
+		return strconv.Quote(val.Error())
+	case fmt.Stringer:
+		return strconv.Quote(val.String())
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+//JSONHandler 每行一个json，包括time、level、trace_id、prefix、source、msg和字段
+type JSONHandler struct {
+	w io.Writer
+	//不为nil时只输出不低于此级别的日志，否则使用全局的级别
+	level *LEVEL
+	lock  sync.Mutex
+}
+
+//NewJSONHandler 写入w，如文件或者os.Stdout
+func NewJSONHandler(w io.Writer) *JSONHandler {
+	return &JSONHandler{w: w}
+}
+
+//SetLevel 单独设置级别，只能比全局的级别高
+func (h *JSONHandler) SetLevel(l LEVEL) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.level = &l
+}
+
+func (h *JSONHandler) Handle(r *Record) {
+	h.lock.Lock()
+	level := h.level
+	h.lock.Unlock()
+	if level != nil && (*level == OFF || r.Level < *level) {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeJSON(&buf, r.Time.Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSON(&buf, r.Level.String())
+	if r.TraceID != "" {
+		buf.WriteString(`,"trace_id":`)
+		writeJSON(&buf, r.TraceID)
+	}
+	if r.Prefix != "" {
+		buf.WriteString(`,"prefix":`)
+		writeJSON(&buf, r.Prefix)
+	}
+	if _, file, line, ok := runtime.Caller(r.CallDepth); ok {
+		buf.WriteString(`,"source":`)
+		writeJSON(&buf, filepath.Base(file)+":"+strconv.Itoa(line))
+	}
+	buf.WriteString(`,"msg":`)
+	writeJSON(&buf, r.Msg)
+	for _, f := range r.Fields {
+		buf.WriteByte(',')
+		writeJSON(&buf, f.Key)
+		buf.WriteByte(':')
+		v := f.Value
+		if e, ok := v.(error); ok {
+			v = e.Error()
+		}
+		writeJSON(&buf, v)
+	}
+	buf.WriteString("}\n")
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	_, _ = h.w.Write(buf.Bytes())
+}
+
+//writeJSON 使用标准库，无法编码的值转为字符串
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(b)
+}
+
+//MultiHandler 同时输出到多个Handler
+func MultiHandler(handlers ...Handler) Handler {
+	return multiHandler(handlers)
+}
+
+type multiHandler []Handler
+
+func (m multiHandler) Handle(r *Record) {
+	for _, h := range m {
+		rr := *r
+		//多了一层调用
+		rr.CallDepth++
+		h.Handle(&rr)
+	}
+}
@@ -0,0 +1,200 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+//Logger 带前缀、trace_id和字段的日志，HTTPContext等嵌入使用
+type Logger struct {
+	prefix    string
+	traceID   string
+	fields    []Field
+	calldepth int
+	//全局的函数，每次输出时获取prefix
+	isStd bool
+}
+
+func NewLogger() *Logger {
+	return &Logger{
+		prefix:    GetPrefix(),
+		calldepth: 2,
+	}
+}
+
+//AppendPrefix 用空格连接
+func (l *Logger) AppendPrefix(str string) {
+	if str == "" {
+		return
+	}
+	if l.prefix == "" {
+		l.prefix = str
+	} else {
+		l.prefix = l.prefix + " " + str
+	}
+}
+
+//SetCallDepth 默认是2，每多包装一层加1
+func (l *Logger) SetCallDepth(calldepth int) {
+	l.calldepth = calldepth
+}
+
+func (l *Logger) SetPrefix(str string) {
+	l.prefix = str
+}
+
+//ResetPrefix 恢复为全局的前缀
+func (l *Logger) ResetPrefix() {
+	l.prefix = GetPrefix()
+}
+
+func (l *Logger) GetPrefix() string {
+	if l.isStd {
+		return GetPrefix()
+	}
+	return l.prefix
+}
+
+func (l *Logger) SetTraceID(str string) {
+	l.traceID = str
+}
+
+func (l *Logger) GetTraceID() string {
+	return l.traceID
+}
+
+//With 返回带字段的新Logger，参数是key、value交替，或者Field
+func (l *Logger) With(args ...interface{}) *Logger {
+	n := *l
+	n.isStd = false
+	n.prefix = l.GetPrefix()
+	n.fields = append(append([]Field(nil), l.fields...), toFields(args)...)
+	return &n
+}
+
+//Fields 已经添加的字段
+func (l *Logger) Fields() []Field {
+	return l.fields
+}
+
+func toFields(args []interface{}) (fields []Field) {
+	for i := 0; i < len(args); i++ {
+		switch v := args[i].(type) {
+		case Field:
+			fields = append(fields, v)
+		case string:
+			if i+1 < len(args) {
+				fields = append(fields, Field{Key: v, Value: args[i+1]})
+				i++
+			} else {
+				fields = append(fields, Field{Key: "!BADKEY", Value: v})
+			}
+		default:
+			fields = append(fields, Field{Key: "!BADKEY", Value: v})
+		}
+	}
+	return
+}
+
+//message 同go-logger，一个字符串参数时原样输出，否则用空格连接
+func message(v []interface{}) string {
+	if len(v) == 1 {
+		if s, ok := v[0].(string); ok {
+			return s
+		}
+	}
+	return strings.TrimSuffix(fmt.Sprintln(v...), "\n")
+}
+
+func (l *Logger) output(level LEVEL, v ...interface{}) {
+	if !Enabled(level) {
+		return
+	}
+	l.emit(level, message(v))
+}
+
+func (l *Logger) outputf(level LEVEL, format string, v ...interface{}) {
+	if !Enabled(level) {
+		return
+	}
+	l.emit(level, fmt.Sprintf(format, v...))
+}
+
+//emit 和用户代码之间隔了output和Debug等方法
+func (l *Logger) emit(level LEVEL, msg string) {
+	GetHandler().Handle(&Record{
+		Time:      time.Now(),
+		Level:     level,
+		TraceID:   l.traceID,
+		Prefix:    l.GetPrefix(),
+		Fields:    l.fields,
+		Msg:       msg,
+		CallDepth: l.calldepth + 2,
+	})
+}
+
+func (l *Logger) Debug(v ...interface{}) {
+	l.output(DEBUG, v...)
+}
+
+func (l *Logger) Debugf(format string, v ...interface{}) {
+	l.outputf(DEBUG, format, v...)
+}
+
+func (l *Logger) Info(v ...interface{}) {
+	l.output(INFO, v...)
+}
+
+func (l *Logger) Infof(format string, v ...interface{}) {
+	l.outputf(INFO, format, v...)
+}
+
+func (l *Logger) Warn(v ...interface{}) {
+	l.output(WARN, v...)
+}
+
+func (l *Logger) Warnf(format string, v ...interface{}) {
+	l.outputf(WARN, format, v...)
+}
+
+func (l *Logger) Error(v ...interface{}) {
+	l.output(ERROR, v...)
+}
+
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	l.outputf(ERROR, format, v...)
+}
+
+func (l *Logger) Fatal(v ...interface{}) {
+	l.output(FATAL, v...)
+}
+
+func (l *Logger) Fatalf(format string, v ...interface{}) {
+	l.outputf(FATAL, format, v...)
+}
+
+func (l *Logger) Mix(v ...interface{}) {
+	l.output(MIX, v...)
+}
+
+func (l *Logger) Mixf(format string, v ...interface{}) {
+	l.outputf(MIX, format, v...)
+}
+
+//Output 同log.Logger.Output，用于grpclog等，级别是MIX
+func (l *Logger) Output(calldepth int, s string) error {
+	if !Enabled(MIX) {
+		return nil
+	}
+	GetHandler().Handle(&Record{
+		Time:      time.Now(),
+		Level:     MIX,
+		TraceID:   l.traceID,
+		Prefix:    l.GetPrefix(),
+		Fields:    l.fields,
+		Msg:       strings.TrimSuffix(s, "\n"),
+		CallDepth: l.calldepth + calldepth - 1,
+	})
+	return nil
+}
@@ -0,0 +1,211 @@
+//Package logging 框架的日志接口，方法和go-logger一致，实际的输出由Handler决定
+//默认使用go-logger，也可以用JSONHandler或者自定义的Handler接入其他的日志系统
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logger "github.com/hsyan2008/go-logger"
+)
+
+//LEVEL 和go-logger一致，MIX在OFF之后，除非OFF否则都会输出
+type LEVEL int32
+
+const (
+	DEBUG LEVEL = iota
+	INFO
+	WARN
+	ERROR
+	FATAL
+	OFF
+	MIX
+)
+
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL", "OFF", "MIX"}
+
+func (l LEVEL) String() string {
+	if l >= 0 && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("LEVEL(%d)", l)
+}
+
+//ParseLevel 不区分大小写
+func ParseLevel(s string) (LEVEL, bool) {
+	s = strings.ToUpper(s)
+	for i, name := range levelNames {
+		if name == s {
+			return LEVEL(i), true
+		}
+	}
+	return DEBUG, false
+}
+
+//Field 结构化日志的字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+//Record 一条日志
+type Record struct {
+	Time    time.Time
+	Level   LEVEL
+	TraceID string
+	Prefix  string
+	Fields  []Field
+	Msg     string
+	//在Handle里调用runtime.Caller(CallDepth)得到打日志的位置
+	CallDepth int
+}
+
+//Handler 输出日志，需要并发安全
+type Handler interface {
+	Handle(r *Record)
+}
+
+//HandlerFunc 把函数转为Handler，f里的CallDepth已经加上了Handle这一层
+type HandlerFunc func(r *Record)
+
+func (f HandlerFunc) Handle(r *Record) {
+	r.CallDepth++
+	f(r)
+}
+
+var (
+	level   int32
+	handler atomic.Value
+
+	prefixLock = new(sync.RWMutex)
+	prefixStr  string
+	logGoID    int32
+)
+
+type handlerHolder struct {
+	h Handler
+}
+
+func init() {
+	handler.Store(handlerHolder{GoLogger})
+}
+
+//SetHandler 替换全局的Handler，nil表示恢复为go-logger
+func SetHandler(h Handler) {
+	if h == nil {
+		h = GoLogger
+	}
+	handler.Store(handlerHolder{h})
+}
+
+func GetHandler() Handler {
+	return handler.Load().(handlerHolder).h
+}
+
+//SetLevel 同时设置go-logger的级别
+func SetLevel(l LEVEL) {
+	atomic.StoreInt32(&level, int32(l))
+	logger.SetLevel(logger.LEVEL(l))
+}
+
+func Level() LEVEL {
+	return LEVEL(atomic.LoadInt32(&level))
+}
+
+//SetLevelStr 无效的级别当作debug，同go-logger
+func SetLevelStr(s string) {
+	l, _ := ParseLevel(s)
+	SetLevel(l)
+}
+
+//Enabled 级别l的日志是否会输出
+func Enabled(l LEVEL) bool {
+	cur := Level()
+	return cur != OFF && l >= cur
+}
+
+//SetPrefix 全局的前缀，NewLogger时使用
+func SetPrefix(s string) {
+	prefixLock.Lock()
+	defer prefixLock.Unlock()
+	prefixStr = s
+}
+
+//GetPrefix 开启LogGoID时带上goroutine的id
+func GetPrefix() string {
+	prefixLock.RLock()
+	s := prefixStr
+	prefixLock.RUnlock()
+	if atomic.LoadInt32(&logGoID) == 1 {
+		return strings.TrimSpace("GoID:" + logger.GoroutineID() + " " + s)
+	}
+	return s
+}
+
+func SetLogGoID(b bool) {
+	if b {
+		atomic.StoreInt32(&logGoID, 1)
+	} else {
+		atomic.StoreInt32(&logGoID, 0)
+	}
+	logger.SetLogGoID(b)
+}
+
+//SetConsole 是否输出到控制台，只对go-logger有效
+func SetConsole(b bool) {
+	logger.SetConsole(b)
+}
+
+//std 全局的函数使用，prefix在输出时获取
+var std = &Logger{calldepth: 2, isStd: true}
+
+func Debug(v ...interface{}) {
+	std.output(DEBUG, v...)
+}
+
+func Debugf(format string, v ...interface{}) {
+	std.outputf(DEBUG, format, v...)
+}
+
+func Info(v ...interface{}) {
+	std.output(INFO, v...)
+}
+
+func Infof(format string, v ...interface{}) {
+	std.outputf(INFO, format, v...)
+}
+
+func Warn(v ...interface{}) {
+	std.output(WARN, v...)
+}
+
+func Warnf(format string, v ...interface{}) {
+	std.outputf(WARN, format, v...)
+}
+
+func Error(v ...interface{}) {
+	std.output(ERROR, v...)
+}
+
+func Errorf(format string, v ...interface{}) {
+	std.outputf(ERROR, format, v...)
+}
+
+func Fatal(v ...interface{}) {
+	std.output(FATAL, v...)
+}
+
+func Fatalf(format string, v ...interface{}) {
+	std.outputf(FATAL, format, v...)
+}
+
+func Mix(v ...interface{}) {
+	std.output(MIX, v...)
+}
+
+func Mixf(format string, v ...interface{}) {
+	std.outputf(MIX, format, v...)
+}
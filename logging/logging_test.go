@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJSONHandler(t *testing.T) {
+	var buf bytes.Buffer
+	SetHandler(NewJSONHandler(&buf))
+	defer SetHandler(nil)
+	defer SetLevel(Level())
+	SetLevel(INFO)
+
+	l := NewLogger()
+	l.SetPrefix("app")
+	l.SetTraceID("abc")
+	l.With("uid", 1, Field{Key: "err", Value: errors.New("e1")}).Infof("hello %s", "world")
+	l.Debug("skipped")
+	Warn("global", 1)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %d, want 2: %s", len(lines), buf.String())
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"level":    "INFO",
+		"trace_id": "abc",
+		"prefix":   "app",
+		"msg":      "hello world",
+		"uid":      float64(1),
+		"err":      "e1",
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("%s = %v, want %v", k, m[k], v)
+		}
+	}
+	if src, _ := m["source"].(string); !strings.HasPrefix(src, "logging_test.go:") {
+		t.Errorf("source = %v, want logging_test.go", m["source"])
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["msg"] != "global 1" || m["level"] != "WARN" {
+		t.Errorf("unexpected global log: %s", lines[1])
+	}
+	if src, _ := m["source"].(string); !strings.HasPrefix(src, "logging_test.go:") {
+		t.Errorf("source = %v, want logging_test.go", m["source"])
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for i, name := range levelNames {
+		l, ok := ParseLevel(strings.ToLower(name))
+		if !ok || l != LEVEL(i) {
+			t.Errorf("ParseLevel(%s) = %v, %v", name, l, ok)
+		}
+	}
+	if _, ok := ParseLevel("xxx"); ok {
+		t.Error("xxx should be invalid")
+	}
+}
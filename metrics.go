@@ -0,0 +1,268 @@
+package hfw
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hsyan2008/hfw/accesslog"
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/dump"
+	"github.com/hsyan2008/hfw/profiler"
+	"github.com/hsyan2008/hfw/prometheus"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+//responseRecorder 记录实际写入的状态码和大小
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+	//开启dump时记录请求和响应的body
+	dumpReq  *dump.Buffer
+	dumpResp *dump.Buffer
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	if w.dumpResp != nil {
+		_, _ = w.dumpResp.Write(b[:n])
+	}
+	return n, err
+}
+
+func (w *responseRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+//Hijack 用于websocket
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.Hijacker not implemented")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+//Unwrap 用于http.ResponseController
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+//Status 没有写入时是200
+func (w *responseRecorder) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+//errNoClass ErrNo去掉AppID后按百位分类，如4xx、5xx，避免基数过大
+//0是ok，大于等于1000的是other
+func errNoClass(errNo int64) string {
+	if errNo == 0 {
+		return "ok"
+	}
+	if Config.AppID > 0 && Config.ErrorBase > 0 {
+		errNo %= Config.ErrorBase
+	}
+	if errNo < 0 {
+		errNo = -errNo
+	}
+	if errNo < 1000 {
+		return fmt.Sprintf("%dxx", errNo/100)
+	}
+	return "other"
+}
+
+//withUpstreamCounter httpCtx.Ctx和Request的ctx共用一个计数，用于访问日志
+func withUpstreamCounter(httpCtx *HTTPContext) {
+	if !accesslog.IsEnable() {
+		return
+	}
+	ctx := accesslog.ContextWithCounter(httpCtx.Request.Context())
+	httpCtx.Request = httpCtx.Request.WithContext(ctx)
+	httpCtx.Ctx = accesslog.ContextWithCounterFrom(httpCtx.Ctx, ctx)
+}
+
+//httpRequestDone 请求结束时记录prometheus和访问日志，route是路由的模板
+func httpRequestDone(httpCtx *HTTPContext, w *responseRecorder, route string, costTime time.Duration) {
+	r := httpCtx.Request
+	code := strconv.Itoa(w.Status())
+	success := w.Status() < http.StatusMultipleChoices && httpCtx.ErrNo == 0
+	profiler.ObserveLatency(costTime)
+	prometheus.RequestsDone(prometheus.Request{
+		Path:         route,
+		Method:       r.Method,
+		Code:         code,
+		ErrClass:     errNoClass(httpCtx.ErrNo),
+		RequestSize:  r.ContentLength,
+		ResponseSize: w.size,
+		Duration:     costTime,
+	})
+	accesslog.Log(&accesslog.Record{
+		Time:          time.Now(),
+		TraceID:       httpCtx.GetTraceID(),
+		Type:          "http",
+		ClientIP:      common.GetClientIP(r),
+		Method:        r.Method,
+		Route:         route,
+		Path:          r.URL.Path,
+		Status:        code,
+		ErrNo:         httpCtx.ErrNo,
+		RequestBytes:  r.ContentLength,
+		ResponseBytes: w.size,
+		Latency:       costTime,
+		UserAgent:     r.UserAgent(),
+		UpstreamCalls: accesslog.UpstreamCalls(httpCtx.Ctx),
+		Success:       success,
+	})
+
+	if w.dumpReq == nil || !dump.Match(route, httpCtx.GetTraceID(), httpCtx.ErrNo, success) {
+		return
+	}
+	dump.Log(&dump.Record{
+		Time:    time.Now(),
+		TraceID: httpCtx.GetTraceID(),
+		Type:    "http",
+		Route:   route,
+		Method:  r.Method,
+		URL:     r.RequestURI,
+		Host:    r.Host,
+		Status:  code,
+		ErrNo:   httpCtx.ErrNo,
+		Latency: costTime,
+		Request: dump.Message{
+			Header:    r.Header.Clone(),
+			Body:      w.dumpReq.String(),
+			Truncated: w.dumpReq.Truncated(),
+		},
+		Response: dump.Message{
+			Header:    w.Header().Clone(),
+			Body:      w.dumpResp.String(),
+			Truncated: w.dumpResp.Truncated(),
+		},
+	})
+}
+
+//grpcRequestDone grpc不统计大小，stream的req和resp是nil，不记录dump
+func grpcRequestDone(httpCtx *HTTPContext, fullMethod, method string, req, resp interface{}, err error, costTime time.Duration) {
+	errClass := "ok"
+	var errNo int64
+	if err != nil {
+		errClass = "other"
+		var e *common.RespErr
+		if errors.As(err, &e) {
+			errNo = e.ErrNo()
+			errClass = errNoClass(errNo)
+		}
+	}
+	code := status.Code(err)
+	profiler.ObserveLatency(costTime)
+	prometheus.RequestsDone(prometheus.Request{
+		Path:         fullMethod,
+		Method:       method,
+		Code:         code.String(),
+		ErrClass:     errClass,
+		RequestSize:  -1,
+		ResponseSize: -1,
+		Duration:     costTime,
+	})
+
+	if req != nil && dump.Match(fullMethod, httpCtx.GetTraceID(), errNo, err == nil) {
+		dumpGrpc(httpCtx, fullMethod, method, req, resp, code.String(), errNo, costTime)
+	}
+
+	if !accesslog.IsEnable() {
+		return
+	}
+	var clientIP, userAgent string
+	if p, ok := peer.FromContext(httpCtx.Ctx); ok {
+		clientIP = p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(httpCtx.Ctx); ok {
+		if v := md.Get("user-agent"); len(v) > 0 {
+			userAgent = v[0]
+		}
+	}
+	accesslog.Log(&accesslog.Record{
+		Time:          time.Now(),
+		TraceID:       httpCtx.GetTraceID(),
+		Type:          "grpc",
+		ClientIP:      clientIP,
+		Method:        method,
+		Route:         fullMethod,
+		Path:          fullMethod,
+		Status:        code.String(),
+		ErrNo:         errNo,
+		RequestBytes:  -1,
+		ResponseBytes: -1,
+		Latency:       costTime,
+		UserAgent:     userAgent,
+		UpstreamCalls: accesslog.UpstreamCalls(httpCtx.Ctx),
+		Success:       err == nil,
+	})
+}
+
+func dumpGrpc(httpCtx *HTTPContext, fullMethod, method string, req, resp interface{},
+	code string, errNo int64, costTime time.Duration) {
+	rec := &dump.Record{
+		Time:    time.Now(),
+		TraceID: httpCtx.GetTraceID(),
+		Type:    "grpc",
+		Route:   fullMethod,
+		Method:  method,
+		Status:  code,
+		ErrNo:   errNo,
+		Latency: costTime,
+	}
+	if md, ok := metadata.FromIncomingContext(httpCtx.Ctx); ok {
+		rec.Request.Header = md.Copy()
+	}
+	rec.Request.Body, rec.Request.Truncated = dumpJSON(req)
+	if resp != nil {
+		rec.Response.Body, rec.Response.Truncated = dumpJSON(resp)
+	}
+	dump.Log(rec)
+}
+
+//dumpJSON proto的消息可能包含map，使用标准库
+func dumpJSON(v interface{}) (string, bool) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err.Error(), false
+	}
+	buf := dump.NewBuffer()
+	_, _ = buf.Write(b)
+	return buf.String(), buf.Truncated()
+}
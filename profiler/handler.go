@@ -0,0 +1,64 @@
+package profiler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hsyan2008/hfw/admin"
+)
+
+func init() {
+	admin.HandleFunc("/profiles", listHandler)
+	admin.HandleFunc("/profiles/download", downloadHandler)
+}
+
+//listHandler GET列出已保存的profile，POST且action=capture时手动采集
+func listHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if r.FormValue("action") != "capture" {
+			http.Error(w, "invalid action", http.StatusBadRequest)
+			return
+		}
+		files, err := Capture("manual")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if files == nil {
+			http.Error(w, "in cool down", http.StatusTooManyRequests)
+			return
+		}
+		writeJSON(w, files)
+		return
+	}
+
+	files, err := List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, files)
+}
+
+//downloadHandler 参数name是List返回的文件名
+func downloadHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	path, err := Path(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeFile(w, r, path)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
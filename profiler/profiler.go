@@ -0,0 +1,332 @@
+//Package profiler 定时检查goroutine数、常驻内存、请求耗时p99和并发数，超过阈值时采集profile保存到磁盘
+//通过admin的/profiles查看、下载和手动采集
+package profiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/signal"
+	"github.com/shirou/gopsutil/process"
+)
+
+var (
+	defaultMaxFiles          = 40
+	defaultInterval    int64 = 5
+	defaultCoolDown    int64 = 300
+	defaultCPUDuration int64 = 10
+	//每个检查间隔最多保留的耗时样本
+	maxSamples = 10000
+)
+
+var (
+	conf configs.ProfilerConfig
+	dir  string
+
+	lock      = new(sync.Mutex)
+	samples   []time.Duration
+	online    func() int
+	lastTime  time.Time
+	capturing int32
+	//配置了LatencyP99才记录耗时，未开启时不加锁
+	observing int32
+)
+
+//Init 根据配置开启
+func Init(c configs.ProfilerConfig) error {
+	if !c.IsEnable {
+		return nil
+	}
+	if c.Dir == "" {
+		c.Dir = "profiles"
+	}
+	if !filepath.IsAbs(c.Dir) {
+		c.Dir = filepath.Join(common.GetAppPath(), c.Dir)
+	}
+	if c.MaxFiles <= 0 {
+		c.MaxFiles = defaultMaxFiles
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaultInterval
+	}
+	if c.CoolDown <= 0 {
+		c.CoolDown = defaultCoolDown
+	}
+	if c.CPUDuration <= 0 {
+		c.CPUDuration = defaultCPUDuration
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+
+	lock.Lock()
+	conf = c
+	dir = c.Dir
+	lock.Unlock()
+	if c.LatencyP99 > 0 {
+		atomic.StoreInt32(&observing, 1)
+	} else {
+		atomic.StoreInt32(&observing, 0)
+	}
+
+	//mutex profile需要开启采样
+	if runtime.SetMutexProfileFraction(-1) == 0 {
+		runtime.SetMutexProfileFraction(10)
+	}
+
+	go run(time.Duration(c.Interval) * time.Second)
+	logger.Infof("profiler is enabled, dir: %s", c.Dir)
+
+	return nil
+}
+
+//SetOnline 获取正在处理的请求数，hfw里设置
+func SetOnline(f func() int) {
+	lock.Lock()
+	defer lock.Unlock()
+	online = f
+}
+
+//ObserveLatency 请求结束时调用，用于计算p99
+func ObserveLatency(d time.Duration) {
+	if atomic.LoadInt32(&observing) == 0 {
+		return
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(samples) >= maxSamples {
+		return
+	}
+	samples = append(samples, d)
+}
+
+func run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ctx := signal.GetSignalContext().Ctx
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if reason := check(); reason != "" {
+				if _, err := Capture(reason); err != nil {
+					logger.Warn("profiler capture error:", err)
+				}
+			}
+		}
+	}
+}
+
+//check 返回超过的阈值，没有则返回空
+func check() string {
+	lock.Lock()
+	c := conf
+	list := samples
+	samples = nil
+	f := online
+	lock.Unlock()
+
+	if c.Goroutines > 0 {
+		if n := runtime.NumGoroutine(); n > c.Goroutines {
+			return fmt.Sprintf("goroutines-%d", n)
+		}
+	}
+	if c.RSS > 0 {
+		if rss := getRSS(); rss > c.RSS<<20 {
+			return fmt.Sprintf("rss-%dMB", rss>>20)
+		}
+	}
+	if c.LatencyP99 > 0 && len(list) > 0 {
+		if p99 := percentile(list, 0.99); p99 > time.Duration(c.LatencyP99)*time.Millisecond {
+			return fmt.Sprintf("p99-%dms", p99/time.Millisecond)
+		}
+	}
+	if c.Concurrence > 0 && f != nil {
+		if n := f(); n > c.Concurrence {
+			return fmt.Sprintf("online-%d", n)
+		}
+	}
+
+	return ""
+}
+
+//getRSS 常驻内存，单位字节，获取失败返回0
+func getRSS() int64 {
+	p, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		return 0
+	}
+	m, err := p.MemoryInfo()
+	if err != nil {
+		return 0
+	}
+	return int64(m.RSS)
+}
+
+func percentile(list []time.Duration, p float64) time.Duration {
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	i := int(float64(len(list))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(list) {
+		i = len(list) - 1
+	}
+	return list[i]
+}
+
+//Capture 采集goroutine、heap、mutex，并在后台采集cpu，返回已写入的文件名
+//和上一次采集的间隔小于CoolDown时不处理
+func Capture(reason string) (files []string, err error) {
+	lock.Lock()
+	if !conf.IsEnable {
+		lock.Unlock()
+		return nil, fmt.Errorf("profiler is disabled")
+	}
+	if time.Since(lastTime) < time.Duration(conf.CoolDown)*time.Second {
+		lock.Unlock()
+		return nil, nil
+	}
+	lastTime = time.Now()
+	c := conf
+	lock.Unlock()
+
+	logger.Warnf("profiler capture, reason: %s", reason)
+	prefix := time.Now().Format("20060102150405") + "_" + sanitize(reason)
+	for _, name := range []string{"goroutine", "heap", "mutex"} {
+		file := prefix + "." + name + ".pprof"
+		if err = writeProfile(filepath.Join(c.Dir, file), name); err != nil {
+			return
+		}
+		files = append(files, file)
+	}
+
+	//同一时间只能有一个cpu profile，如/debug/pprof/profile正在采集则跳过
+	if atomic.CompareAndSwapInt32(&capturing, 0, 1) {
+		file := prefix + ".cpu.pprof"
+		//先创建文件，下面的cleanup才会计算在内
+		f, e := os.Create(filepath.Join(c.Dir, file))
+		if e != nil {
+			atomic.StoreInt32(&capturing, 0)
+			logger.Warn("profiler cpu profile error:", e)
+		} else {
+			files = append(files, file)
+			go func() {
+				defer atomic.StoreInt32(&capturing, 0)
+				if err := writeCPUProfile(f, time.Duration(c.CPUDuration)*time.Second); err != nil {
+					logger.Warn("profiler cpu profile error:", err)
+				}
+				cleanup(c.Dir, c.MaxFiles)
+			}()
+		}
+	}
+	cleanup(c.Dir, c.MaxFiles)
+
+	return files, nil
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+func writeProfile(path, name string) error {
+	p := pprof.Lookup(name)
+	if p == nil {
+		return fmt.Errorf("profile not found: %s", name)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return p.WriteTo(f, 0)
+}
+
+func writeCPUProfile(f *os.File, d time.Duration) error {
+	defer f.Close()
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	select {
+	case <-time.After(d):
+	case <-signal.GetSignalContext().Ctx.Done():
+	}
+	pprof.StopCPUProfile()
+	return nil
+}
+
+//File 已保存的profile
+type File struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+//List 按时间倒序
+func List() (files []File, err error) {
+	lock.Lock()
+	d := dir
+	lock.Unlock()
+	if d == "" {
+		return nil, nil
+	}
+	entries, err := filepath.Glob(filepath.Join(d, "*.pprof"))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		fi, err := os.Stat(e)
+		if err != nil {
+			continue
+		}
+		files = append(files, File{Name: fi.Name(), Size: fi.Size(), ModTime: fi.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].ModTime.Equal(files[j].ModTime) {
+			return files[i].Name > files[j].Name
+		}
+		return files[i].ModTime.After(files[j].ModTime)
+	})
+	return files, nil
+}
+
+//Path 文件的完整路径，只允许目录下的pprof文件
+func Path(name string) (string, error) {
+	lock.Lock()
+	d := dir
+	lock.Unlock()
+	if d == "" || name != filepath.Base(name) || !strings.HasSuffix(name, ".pprof") {
+		return "", os.ErrNotExist
+	}
+	return filepath.Join(d, name), nil
+}
+
+//cleanup 超过maxFiles时删除最旧的
+func cleanup(d string, maxFiles int) {
+	files, err := List()
+	if err != nil {
+		return
+	}
+	for i := maxFiles; i < len(files); i++ {
+		_ = os.Remove(filepath.Join(d, files[i].Name))
+	}
+}
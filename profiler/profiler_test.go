@@ -0,0 +1,104 @@
+package profiler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestCapture(t *testing.T) {
+	d := t.TempDir()
+	lock.Lock()
+	conf = configs.ProfilerConfig{IsEnable: true, Dir: d, MaxFiles: 5, CoolDown: 1, CPUDuration: 1}
+	dir = d
+	lock.Unlock()
+	defer func() {
+		//等待后台的cpu profile结束
+		for atomic.LoadInt32(&capturing) == 1 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		lock.Lock()
+		conf, dir, lastTime = configs.ProfilerConfig{}, "", time.Time{}
+		lock.Unlock()
+	}()
+
+	//旧文件超过MaxFiles时被删除
+	for i := 0; i < 5; i++ {
+		name := filepath.Join(d, "old"+string(rune('0'+i))+".heap.pprof")
+		if err := os.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-time.Hour + time.Duration(i)*time.Second)
+		_ = os.Chtimes(name, old, old)
+	}
+
+	files, err := Capture("p99/100ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no profile captured")
+	}
+	if files[0] != filepath.Base(files[0]) || filepath.Ext(files[0]) != ".pprof" {
+		t.Fatalf("invalid file name: %s", files[0])
+	}
+	//CoolDown内不再采集
+	if files, _ := Capture("again"); files != nil {
+		t.Fatalf("should be in cool down, got %v", files)
+	}
+
+	list, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) > 5 {
+		t.Fatalf("len = %d, want <= 5", len(list))
+	}
+	if _, err := os.Stat(filepath.Join(d, "old0.heap.pprof")); !os.IsNotExist(err) {
+		t.Fatal("oldest file should be removed")
+	}
+
+	w := httptest.NewRecorder()
+	listHandler(w, httptest.NewRequest("GET", "/profiles", nil))
+	var got []File
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(list) {
+		t.Fatalf("len = %d, want %d", len(got), len(list))
+	}
+
+	w = httptest.NewRecorder()
+	downloadHandler(w, httptest.NewRequest("GET", "/profiles/download?name=../profiler.go", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("code = %d, want 404", w.Code)
+	}
+	w = httptest.NewRecorder()
+	downloadHandler(w, httptest.NewRequest("GET", "/profiles/download?name="+files[0], nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d, want 200", w.Code)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var list []time.Duration
+	for i := 1; i <= 100; i++ {
+		list = append(list, time.Duration(i)*time.Millisecond)
+	}
+	if p := percentile(list, 0.99); p != 99*time.Millisecond {
+		t.Fatalf("p99 = %s, want 99ms", p)
+	}
+}
+
+func TestGetRSS(t *testing.T) {
+	if rss := getRSS(); rss <= 0 {
+		t.Fatalf("rss = %d, want > 0", rss)
+	}
+}
@@ -0,0 +1,143 @@
+package prometheus
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolLock   = new(sync.RWMutex)
+	dbPools    = make(map[string]func() sql.DBStats)
+	redisPools = make(map[string]redisPool)
+	curlPools  = make(map[string]func() CurlStats)
+
+	poolLabels = []string{"app", "host", "name"}
+
+	dbOpenDesc       = prometheus.NewDesc("db_open_connections", "db open connections, in use and idle", poolLabels, nil)
+	dbInUseDesc      = prometheus.NewDesc("db_in_use_connections", "db connections in use", poolLabels, nil)
+	dbIdleDesc       = prometheus.NewDesc("db_idle_connections", "db idle connections", poolLabels, nil)
+	dbMaxOpenDesc    = prometheus.NewDesc("db_max_open_connections", "db max open connections, 0 is unlimited", poolLabels, nil)
+	dbWaitDesc       = prometheus.NewDesc("db_wait_count_total", "db connections waited for", poolLabels, nil)
+	dbWaitTimeDesc   = prometheus.NewDesc("db_wait_duration_seconds_total", "db time blocked waiting for a new connection", poolLabels, nil)
+	dbIdleClosedDesc = prometheus.NewDesc("db_max_idle_closed_total", "db connections closed due to max idle", poolLabels, nil)
+	dbLifeClosedDesc = prometheus.NewDesc("db_max_lifetime_closed_total", "db connections closed due to max lifetime", poolLabels, nil)
+
+	redisSizeDesc = prometheus.NewDesc("redis_pool_size", "redis pool size", poolLabels, nil)
+	redisIdleDesc = prometheus.NewDesc("redis_pool_idle_connections", "redis idle connections in pool", poolLabels, nil)
+
+	curlOpenDesc      = prometheus.NewDesc("curl_open_connections", "curl open connections", poolLabels, nil)
+	curlDialDesc      = prometheus.NewDesc("curl_dials_total", "curl connections dialed", poolLabels, nil)
+	curlDialErrDesc   = prometheus.NewDesc("curl_dial_errors_total", "curl dial errors", poolLabels, nil)
+	curlReusedDesc    = prometheus.NewDesc("curl_reused_connections_total", "curl requests on reused connections", poolLabels, nil)
+	curlNotReusedDesc = prometheus.NewDesc("curl_new_connections_total", "curl requests on new connections", poolLabels, nil)
+)
+
+//CurlStats curl客户端的连接
+type CurlStats struct {
+	OpenConnections int64
+	Dials           int64
+	DialErrors      int64
+	Reused          int64
+	NotReused       int64
+}
+
+type redisPool struct {
+	size int
+	idle func() int
+}
+
+//RegisterDBStats 注册数据库连接池，拉取数据时调用stats，name相同则覆盖
+//name里不要包含密码
+func RegisterDBStats(name string, stats func() sql.DBStats) {
+	poolLock.Lock()
+	defer poolLock.Unlock()
+	dbPools[name] = stats
+}
+
+func UnregisterDBStats(name string) {
+	poolLock.Lock()
+	defer poolLock.Unlock()
+	delete(dbPools, name)
+}
+
+//RegisterRedisPool size是连接池的大小，idle返回空闲的连接数，name相同则覆盖
+func RegisterRedisPool(name string, size int, idle func() int) {
+	poolLock.Lock()
+	defer poolLock.Unlock()
+	redisPools[name] = redisPool{size: size, idle: idle}
+}
+
+func UnregisterRedisPool(name string) {
+	poolLock.Lock()
+	defer poolLock.Unlock()
+	delete(redisPools, name)
+}
+
+//RegisterCurlStats 注册curl的客户端，name相同则覆盖
+func RegisterCurlStats(name string, stats func() CurlStats) {
+	poolLock.Lock()
+	defer poolLock.Unlock()
+	curlPools[name] = stats
+}
+
+func UnregisterCurlStats(name string) {
+	poolLock.Lock()
+	defer poolLock.Unlock()
+	delete(curlPools, name)
+}
+
+//poolCollector 拉取数据时采集连接池的状态
+type poolCollector struct{}
+
+func (poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		dbOpenDesc, dbInUseDesc, dbIdleDesc, dbMaxOpenDesc,
+		dbWaitDesc, dbWaitTimeDesc, dbIdleClosedDesc, dbLifeClosedDesc,
+		redisSizeDesc, redisIdleDesc,
+		curlOpenDesc, curlDialDesc, curlDialErrDesc, curlReusedDesc, curlNotReusedDesc,
+	} {
+		ch <- d
+	}
+}
+
+func (poolCollector) Collect(ch chan<- prometheus.Metric) {
+	app, host := common.GetAppName(), common.GetHostName()
+
+	poolLock.RLock()
+	defer poolLock.RUnlock()
+
+	for name, f := range dbPools {
+		s := f()
+		gauge := func(d *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, app, host, name)
+		}
+		counter := func(d *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, app, host, name)
+		}
+		gauge(dbOpenDesc, float64(s.OpenConnections))
+		gauge(dbInUseDesc, float64(s.InUse))
+		gauge(dbIdleDesc, float64(s.Idle))
+		gauge(dbMaxOpenDesc, float64(s.MaxOpenConnections))
+		counter(dbWaitDesc, float64(s.WaitCount))
+		counter(dbWaitTimeDesc, s.WaitDuration.Seconds())
+		counter(dbIdleClosedDesc, float64(s.MaxIdleClosed))
+		counter(dbLifeClosedDesc, float64(s.MaxLifetimeClosed))
+	}
+
+	for name, p := range redisPools {
+		ch <- prometheus.MustNewConstMetric(redisSizeDesc, prometheus.GaugeValue, float64(p.size), app, host, name)
+		ch <- prometheus.MustNewConstMetric(redisIdleDesc, prometheus.GaugeValue, float64(p.idle()), app, host, name)
+	}
+
+	for name, f := range curlPools {
+		s := f()
+		ch <- prometheus.MustNewConstMetric(curlOpenDesc, prometheus.GaugeValue, float64(s.OpenConnections), app, host, name)
+		ch <- prometheus.MustNewConstMetric(curlDialDesc, prometheus.CounterValue, float64(s.Dials), app, host, name)
+		ch <- prometheus.MustNewConstMetric(curlDialErrDesc, prometheus.CounterValue, float64(s.DialErrors), app, host, name)
+		ch <- prometheus.MustNewConstMetric(curlReusedDesc, prometheus.CounterValue, float64(s.Reused), app, host, name)
+		ch <- prometheus.MustNewConstMetric(curlNotReusedDesc, prometheus.CounterValue, float64(s.NotReused), app, host, name)
+	}
+}
@@ -14,9 +14,26 @@ var (
 	conf             configs.PrometheusConfig
 	requestsTotal    *prometheus.CounterVec
 	requestsCosttime *prometheus.SummaryVec
+	requestSize      *prometheus.HistogramVec
+	responseSize     *prometheus.HistogramVec
+	requestsInFlight *prometheus.GaugeVec
+	cronJobs         *prometheus.CounterVec
+	cronCosttime     *prometheus.SummaryVec
+	sessionCosttime  *prometheus.HistogramVec
+	breakerState     *prometheus.GaugeVec
+	breakerRequests  *prometheus.CounterVec
+	balancerGauges   map[string]*prometheus.GaugeVec
+	balancerPicks    *prometheus.CounterVec
 	float64Duration  = float64(time.Millisecond)
+	//64B到16MB
+	sizeBuckets = prometheus.ExponentialBuckets(64, 4, 10)
 )
 
+//IsEnable 未开启时调用方可以不准备监控数据
+func IsEnable() bool {
+	return conf.IsEnable
+}
+
 func Init(c configs.PrometheusConfig) {
 	if c.IsEnable == false {
 		return
@@ -27,7 +44,7 @@ func Init(c configs.PrometheusConfig) {
 			Name: c.RequestsTotal,
 			Help: strings.ReplaceAll(c.RequestsTotal, "_", " "),
 		},
-		[]string{"app", "host", "path", "method"},
+		[]string{"app", "host", "path", "method", "code", "err_class"},
 	)
 	requestsCosttime = promauto.NewSummaryVec(
 		prometheus.SummaryOpts{
@@ -38,8 +55,125 @@ func Init(c configs.PrometheusConfig) {
 		},
 		[]string{"app", "host", "path", "method"},
 	)
+	requestSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "request_size_bytes",
+			Help:    "request body size in bytes",
+			Buckets: sizeBuckets,
+		},
+		[]string{"app", "host", "path", "method"},
+	)
+	responseSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "response_size_bytes",
+			Help:    "response body size in bytes",
+			Buckets: sizeBuckets,
+		},
+		[]string{"app", "host", "path", "method"},
+	)
+	requestsInFlight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "requests_in_flight",
+			Help: "requests in flight, type is http or grpc",
+		},
+		[]string{"app", "host", "type"},
+	)
+	cronJobs = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cron_jobs_total",
+			Help: "cron jobs total, result is success, failure or panic",
+		},
+		[]string{"app", "host", "job", "result"},
+	)
+	cronCosttime = promauto.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name:       "cron_jobs_costtime",
+			Help:       "cron jobs costtime in milliseconds",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+		[]string{"app", "host", "job"},
+	)
+	sessionCosttime = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "session_store_costtime",
+			Help:    "session store costtime in milliseconds",
+			Buckets: []float64{0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000},
+		},
+		[]string{"app", "host", "store", "op"},
+	)
+	prometheus.MustRegister(poolCollector{})
+	breakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "circuit breaker state, 0 closed, 1 open, 2 half open",
+		},
+		[]string{"app", "host", "name"},
+	)
+	breakerRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "circuit_breaker_requests_total",
+			Help: "circuit breaker requests total",
+		},
+		[]string{"app", "host", "name", "result"},
+	)
+	balancerGauges = make(map[string]*prometheus.GaugeVec)
+	for name, help := range map[string]string{
+		"lag":      "ewma of grpc call latency in nanoseconds",
+		"inflight": "grpc calls in flight",
+		"success":  "ewma of grpc call success rate, 0-1",
+		"healthy":  "1 healthy, 0 unhealthy",
+		"load":     "load used by p2c picker",
+	} {
+		balancerGauges[name] = promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "grpc_balancer_endpoint_" + name,
+				Help: help,
+			},
+			[]string{"app", "host", "service", "address"},
+		)
+	}
+	balancerPicks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_balancer_picks_total",
+			Help: "grpc balancer picks total",
+		},
+		[]string{"app", "host", "service", "address"},
+	)
 }
 
+//Request 请求结束后的指标
+type Request struct {
+	//路由的模板，如/user/info，不要使用原始的path，避免基数过大
+	Path string
+	//http的method，grpc是GRPC或者Stream
+	Method string
+	//http的状态码或者grpc的code
+	Code string
+	//ErrNo的分类，见hfw的errNoClass
+	ErrClass string
+	//小于0表示未知，不统计
+	RequestSize  int64
+	ResponseSize int64
+	Duration     time.Duration
+}
+
+//RequestsDone 请求结束时调用，记录次数、耗时和大小
+func RequestsDone(r Request) {
+	if conf.IsEnable == false {
+		return
+	}
+	app, host := common.GetAppName(), common.GetHostName()
+	requestsTotal.WithLabelValues(app, host, r.Path, r.Method, r.Code, r.ErrClass).Inc()
+	requestsCosttime.WithLabelValues(app, host, r.Path, r.Method).Observe(float64(r.Duration) / float64Duration)
+	if r.RequestSize >= 0 {
+		requestSize.WithLabelValues(app, host, r.Path, r.Method).Observe(float64(r.RequestSize))
+	}
+	if r.ResponseSize >= 0 {
+		responseSize.WithLabelValues(app, host, r.Path, r.Method).Observe(float64(r.ResponseSize))
+	}
+}
+
+//RequestsTotal Deprecated: 使用RequestsDone，code和err_class为空
 func RequestsTotal(path, method string) {
 	if conf.IsEnable == false {
 		return
@@ -47,9 +181,10 @@ func RequestsTotal(path, method string) {
 	requestsTotal.WithLabelValues(common.GetAppName(),
 		common.GetHostName(),
 		path,
-		method).Inc()
+		method, "", "").Inc()
 }
 
+//RequestsCosttime Deprecated: 使用RequestsDone
 func RequestsCosttime(path, method string, duration time.Duration) {
 	if conf.IsEnable == false {
 		return
@@ -59,3 +194,97 @@ func RequestsCosttime(path, method string, duration time.Duration) {
 		path,
 		method).Observe(float64(duration) / float64Duration)
 }
+
+//RequestsInFlight 请求开始时delta为1，结束时为-1
+func RequestsInFlight(typ string, delta float64) {
+	if conf.IsEnable == false {
+		return
+	}
+	requestsInFlight.WithLabelValues(common.GetAppName(),
+		common.GetHostName(),
+		typ).Add(delta)
+}
+
+//CronJob result是success、failure、panic
+func CronJob(job, result string, duration time.Duration) {
+	if conf.IsEnable == false {
+		return
+	}
+	app, host := common.GetAppName(), common.GetHostName()
+	cronJobs.WithLabelValues(app, host, job, result).Inc()
+	cronCosttime.WithLabelValues(app, host, job).Observe(float64(duration) / float64Duration)
+}
+
+//SessionStore session存储的耗时，op是Put、Get等方法名
+func SessionStore(store, op string, duration time.Duration) {
+	if conf.IsEnable == false {
+		return
+	}
+	sessionCosttime.WithLabelValues(common.GetAppName(),
+		common.GetHostName(),
+		store,
+		op).Observe(float64(duration) / float64Duration)
+}
+
+//BreakerState 熔断器的状态
+func BreakerState(name string, state int) {
+	if conf.IsEnable == false {
+		return
+	}
+	breakerState.WithLabelValues(common.GetAppName(),
+		common.GetHostName(),
+		name).Set(float64(state))
+}
+
+//BreakerRequests result是success、failure、rejected
+func BreakerRequests(name, result string) {
+	if conf.IsEnable == false {
+		return
+	}
+	breakerRequests.WithLabelValues(common.GetAppName(),
+		common.GetHostName(),
+		name,
+		result).Inc()
+}
+
+//BalancerEndpoint 负载均衡里节点的状态，stats的key是lag、inflight、success、healthy、load
+func BalancerEndpoint(service, address string, stats map[string]float64) {
+	if conf.IsEnable == false {
+		return
+	}
+	for name, val := range stats {
+		if g, ok := balancerGauges[name]; ok {
+			g.WithLabelValues(common.GetAppName(),
+				common.GetHostName(),
+				service,
+				address).Set(val)
+		}
+	}
+}
+
+//DeleteBalancerEndpoint 节点下线后删除，同一个服务有多个ClientConn时需要调用方计数
+func DeleteBalancerEndpoint(service, address string) {
+	if conf.IsEnable == false {
+		return
+	}
+	for _, g := range balancerGauges {
+		g.DeleteLabelValues(common.GetAppName(),
+			common.GetHostName(),
+			service,
+			address)
+	}
+	balancerPicks.DeleteLabelValues(common.GetAppName(),
+		common.GetHostName(),
+		service,
+		address)
+}
+
+func BalancerPicks(service, address string) {
+	if conf.IsEnable == false {
+		return
+	}
+	balancerPicks.WithLabelValues(common.GetAppName(),
+		common.GetHostName(),
+		service,
+		address).Inc()
+}
@@ -0,0 +1,87 @@
+package prometheus
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func gather(t *testing.T) map[string]*dto.MetricFamily {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]*dto.MetricFamily, len(mfs))
+	for _, mf := range mfs {
+		m[mf.GetName()] = mf
+	}
+	return m
+}
+
+func label(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func TestMetrics(t *testing.T) {
+	Init(configs.PrometheusConfig{IsEnable: true, RequestsTotal: "requests_total", RequestsCosttime: "requests_costtime"})
+
+	RequestsDone(Request{Path: "/user/info", Method: "GET", Code: "200", ErrClass: "4xx",
+		RequestSize: -1, ResponseSize: 100, Duration: time.Millisecond})
+	RequestsInFlight("http", 1)
+	CronJob("job", "failure", time.Second)
+
+	RegisterDBStats("mysql://db", func() sql.DBStats {
+		return sql.DBStats{OpenConnections: 3, InUse: 1, Idle: 2, WaitCount: 5}
+	})
+	defer UnregisterDBStats("mysql://db")
+	RegisterRedisPool("redis", 10, func() int { return 7 })
+	defer UnregisterRedisPool("redis")
+
+	m := gather(t)
+	mf := m["requests_total"]
+	if mf == nil || len(mf.GetMetric()) != 1 {
+		t.Fatalf("unexpected requests_total: %v", mf)
+	}
+	if c := label(mf.GetMetric()[0], "code"); c != "200" {
+		t.Fatalf("code = %s, want 200", c)
+	}
+	if c := label(mf.GetMetric()[0], "err_class"); c != "4xx" {
+		t.Fatalf("err_class = %s, want 4xx", c)
+	}
+	//大小未知时不统计
+	if mf := m["request_size_bytes"]; mf != nil {
+		t.Fatalf("request size should not be observed: %v", mf)
+	}
+	if mf := m["response_size_bytes"]; mf == nil || mf.GetMetric()[0].GetHistogram().GetSampleSum() != 100 {
+		t.Fatalf("unexpected response_size_bytes: %v", mf)
+	}
+	if mf := m["requests_in_flight"]; mf == nil || mf.GetMetric()[0].GetGauge().GetValue() != 1 {
+		t.Fatalf("unexpected requests_in_flight: %v", mf)
+	}
+	if mf := m["cron_jobs_total"]; mf == nil || label(mf.GetMetric()[0], "result") != "failure" {
+		t.Fatalf("unexpected cron_jobs_total: %v", mf)
+	}
+	if mf := m["db_in_use_connections"]; mf == nil || mf.GetMetric()[0].GetGauge().GetValue() != 1 {
+		t.Fatalf("unexpected db_in_use_connections: %v", mf)
+	}
+	if mf := m["db_wait_count_total"]; mf == nil || mf.GetMetric()[0].GetCounter().GetValue() != 5 {
+		t.Fatalf("unexpected db_wait_count_total: %v", mf)
+	}
+	if mf := m["redis_pool_idle_connections"]; mf == nil || mf.GetMetric()[0].GetGauge().GetValue() != 7 {
+		t.Fatalf("unexpected redis_pool_idle_connections: %v", mf)
+	}
+
+	UnregisterRedisPool("redis")
+	if mf := gather(t)["redis_pool_idle_connections"]; mf != nil {
+		t.Fatalf("redis pool should be unregistered: %v", mf)
+	}
+}
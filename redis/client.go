@@ -1,10 +1,13 @@
 package redis
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/trace"
 	radix "github.com/mediocregopher/radix/v3"
 )
 
@@ -17,20 +20,50 @@ type Client struct {
 	Marshal func(interface{}) ([]byte, error)
 	//不管以下属性是否nil，MGet的结果都需要自行处理
 	Unmarshal func([]byte, interface{}) error
+
+	//用于追踪，ctx里有span时每个命令是一个子span
+	ctx context.Context
 }
 
 func New(redisConfig configs.RedisConfig) (c *Client, err error) {
 	return newClient(redisConfig)
 }
 
-func (c *Client) Do(a radix.Action) error {
+func (c *Client) Do(a radix.Action) (err error) {
 	if c == nil || c.client == nil {
 		return errors.New("redis instance not init")
 	}
 
+	if trace.SpanContextFromContext(c.ctx).IsValid() {
+		cmd := "redis"
+		if s, ok := a.(fmt.Stringer); ok {
+			if fields := strings.Fields(strings.Trim(s.String(), "[]")); len(fields) > 0 {
+				cmd = fields[0]
+			}
+		}
+		_, span := trace.Start(c.ctx, cmd, trace.SpanKindClient)
+		span.SetAttribute("db.system", "redis")
+		//不记录value
+		span.SetAttribute("db.statement", strings.TrimSpace(cmd+" "+strings.Join(a.Keys(), " ")))
+		defer func() {
+			span.SetError(err)
+			span.End()
+		}()
+	}
+
 	return c.client.Do(a)
 }
 
+//WithContext 返回使用ctx的Client，共用连接，如redis.DefaultIns.WithContext(httpCtx.Ctx).Get(...)
+func (c *Client) WithContext(ctx context.Context) *Client {
+	if c == nil {
+		return nil
+	}
+	nc := *c
+	nc.ctx = ctx
+	return &nc
+}
+
 func (c *Client) Close() error {
 	return closeClient(c)
 }
@@ -4,8 +4,8 @@ import (
 	"os"
 	"testing"
 
-	"github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/configs"
+	logger "github.com/hsyan2008/hfw/logging"
 	"github.com/stretchr/testify/assert"
 )
 
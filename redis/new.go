@@ -2,11 +2,13 @@ package redis
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/encoding"
+	"github.com/hsyan2008/hfw/prometheus"
 	radix "github.com/mediocregopher/radix/v3"
 )
 
@@ -18,6 +20,12 @@ var OK = "OK"
 var insMap = make(map[string]radix.Client)
 var l = new(sync.Mutex)
 
+//连接池在prometheus里的名字，Close时删除
+var poolMap = make(map[string]*[]string)
+
+//cluster在拓扑变化时会在其他goroutine里创建连接池
+var poolLock = new(sync.Mutex)
+
 func newClient(redisConfig configs.RedisConfig) (c *Client, err error) {
 	if len(redisConfig.Addresses) == 0 {
 		return c, errors.New("err redis config")
@@ -55,20 +63,37 @@ func newClient(redisConfig configs.RedisConfig) (c *Client, err error) {
 		)
 	}
 
+	//每个节点的连接池都上报空闲连接数
+	var pools []string
+	newPool := func(network, addr string) (*radix.Pool, error) {
+		p, err := radix.NewPool(network, addr, redisConfig.PoolSize, radix.PoolConnFunc(customConnFunc))
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("%s/%d", addr, redisConfig.Db)
+		prometheus.RegisterRedisPool(name, redisConfig.PoolSize, p.NumAvailConns)
+		poolLock.Lock()
+		pools = append(pools, name)
+		poolLock.Unlock()
+		return p, nil
+	}
+
 	if redisConfig.IsCluster {
 		clusterFunc := func(network, addr string) (radix.Client, error) {
-			return radix.NewPool(network, addr, redisConfig.PoolSize, radix.PoolConnFunc(customConnFunc))
+			return newPool(network, addr)
 		}
 		c.client, err = radix.NewCluster(redisConfig.Addresses, radix.ClusterPoolFunc(clusterFunc))
 	} else {
-		c.client, err = radix.NewPool("tcp", redisConfig.Addresses[0], redisConfig.PoolSize, radix.PoolConnFunc(customConnFunc))
+		c.client, err = newPool("tcp", redisConfig.Addresses[0])
 	}
 	if err != nil {
 		c.client = nil
+		unregisterPools(&pools)
 		return
 	}
 
 	insMap[key] = c.client
+	poolMap[key] = &pools
 
 	return
 }
@@ -88,6 +113,17 @@ func Clone(src ...*Client) (dst *Client, err error) {
 	return
 }
 
+func unregisterPools(names *[]string) {
+	if names == nil {
+		return
+	}
+	poolLock.Lock()
+	defer poolLock.Unlock()
+	for _, name := range *names {
+		prometheus.UnregisterRedisPool(name)
+	}
+}
+
 func closeClient(ins *Client) (err error) {
 	if ins == nil || ins.client == nil {
 		return nil
@@ -105,6 +141,8 @@ func closeClient(ins *Client) (err error) {
 	l.Lock()
 	defer l.Unlock()
 	delete(insMap, key)
+	unregisterPools(poolMap[key])
+	delete(poolMap, key)
 
 	return
 }
@@ -5,17 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	_ "net/http/pprof"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"sync/atomic"
 	"time"
 
-	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/dump"
 	"github.com/hsyan2008/hfw/grpc/server"
+	logger "github.com/hsyan2008/hfw/logging"
 	"github.com/hsyan2008/hfw/prometheus"
+	"github.com/hsyan2008/hfw/trace"
 )
 
 //Router 写测试用例会调用
@@ -33,24 +34,52 @@ func Router(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//记录状态码和大小
+	rec := newResponseRecorder(w)
+	w = rec
+	if dump.IsEnable() {
+		rec.dumpReq = dump.ReadBody(r)
+		rec.dumpResp = dump.NewBuffer()
+	}
+
 	//初始化httpCtx
 	httpCtx := initCtx(w, r)
 	defer httpCtx.Cancel()
+	withUpstreamCounter(httpCtx)
+
+	//上游没有traceparent时，使用日志的trace_id作为新trace的id
+	var span *trace.Span
+	httpCtx.Ctx, span = trace.Start(trace.ContextWithTraceID(trace.Extract(httpCtx.Ctx, r.Header.Get), httpCtx.GetTraceID()),
+		"HTTP "+r.Method, trace.SpanKindServer)
+	span.SetAttribute("http.method", r.Method)
+	span.SetAttribute("http.target", r.URL.Path)
+	defer func() {
+		span.SetAttribute("http.status_code", httpCtx.HTTPStatus)
+		if httpCtx.HTTPStatus >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("StatusCode:%d", httpCtx.HTTPStatus))
+		} else if httpCtx.ErrNo != 0 {
+			span.SetAttribute("err_no", httpCtx.ErrNo)
+		}
+		span.End()
+	}()
 
 	//如果用户关闭连接
 	go closeNotify(httpCtx)
 
-	prometheus.RequestsTotal(r.URL.Path, r.Method)
+	//路由的模板，匹配到路由之前是unmatched
+	route := "unmatched"
 	defer func(path, method string, startTime time.Time) {
 		costTime := time.Since(startTime)
 		httpCtx.Mixf("Path:%s Method:%s CostTime:%s", path, method, costTime)
-		prometheus.RequestsCosttime(path, method, costTime)
+		httpRequestDone(httpCtx, rec, route, costTime)
 	}(r.URL.Path, r.Method, time.Now())
 
 	onlineNum := atomic.AddUint32(&online, 1)
+	prometheus.RequestsInFlight("http", 1)
 	httpCtx.Mixf("From:%s Path:%s Online:%d", r.RemoteAddr, r.URL.String(), onlineNum)
 	defer func() {
 		atomic.AddUint32(&online, ^uint32(0))
+		prometheus.RequestsInFlight("http", -1)
 	}()
 	err := checkConcurrence(onlineNum)
 	if err != nil {
@@ -60,6 +89,7 @@ func Router(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(routeMap) == 0 && len(routeMapMethod) == 0 {
+		route = NotFound
 		httpCtx.Warn(httpCtx.Request.URL.Path, "nil routeMap or routeMapMethod")
 		(&Controller{}).NotFound(httpCtx)
 		return
@@ -70,6 +100,11 @@ func Router(w http.ResponseWriter, r *http.Request) {
 	}
 
 	instance, methodName := findInstanceByPath(httpCtx)
+	if methodName == NotFound {
+		route = NotFound
+	} else {
+		route = "/" + httpCtx.Path
+	}
 	httpCtx.Debugf("Path:%s -> Call:%s/%s", httpCtx.Request.URL.Path, httpCtx.Controller, httpCtx.Action)
 	reflectVal := instance.reflectVal
 
@@ -119,10 +154,6 @@ func checkConcurrence(onlineNum uint32) (err error) {
 	return nil
 }
 
-func init() {
-	http.HandleFunc("/logger/adjust", loggerAdjust)
-}
-
 var isInit bool
 
 //Handler 暂时只支持2段
@@ -189,24 +220,31 @@ func Handler(pattern string, handler ControllerInterface) (err error) {
 //HandlerFunc register HandlerFunc
 func HandlerFunc(pattern string, h http.HandlerFunc) {
 	logger.Infof("HandlerFunc: %s", pattern)
-	if pattern == "/" || pattern == "/logger/adjust" {
+	addExtraRoute(pattern, "HandlerFunc")
+	if pattern == "/" {
 		panic("http: multiple registrations for " + pattern)
 	}
 	http.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		rec := newResponseRecorder(w)
+		w = rec
 		httpCtx := initCtx(w, r)
 		defer httpCtx.Cancel()
+		withUpstreamCounter(httpCtx)
+		r = httpCtx.Request
 
-		prometheus.RequestsTotal(r.URL.Path, r.Method)
 		defer func(path, method string, startTime time.Time) {
 			costTime := time.Since(startTime)
 			httpCtx.Mixf("Path:%s Method:%s CostTime:%s", path, method, costTime)
-			prometheus.RequestsCosttime(path, method, costTime)
+			//pattern就是路由的模板
+			httpRequestDone(httpCtx, rec, pattern, costTime)
 		}(r.URL.Path, r.Method, time.Now())
 
 		onlineNum := atomic.AddUint32(&online, 1)
+		prometheus.RequestsInFlight("http", 1)
 		httpCtx.Mixf("From:%s Path:%s Online:%d", r.RemoteAddr, r.URL.String(), onlineNum)
 		defer func() {
 			atomic.AddUint32(&online, ^uint32(0))
+			prometheus.RequestsInFlight("http", -1)
 			if err := recover(); err != nil {
 				if err == ErrStopRun {
 					return
@@ -239,6 +277,7 @@ func StaticHandler(pattern string, dir string) {
 		pattern = "/" + strings.Trim(pattern, "/") + "/"
 	}
 	logger.Info("StaticHandler", pattern, dir)
+	addExtraRoute(pattern, "StaticHandler:"+dir)
 	http.Handle(pattern, http.FileServer(http.Dir(dir)))
 }
 
@@ -252,11 +291,7 @@ func StaticStripHandler(pattern string, dir string) {
 		pattern = "/" + strings.Trim(pattern, "/") + "/"
 	}
 	logger.Info("StaticStripHandler", pattern, dir)
+	addExtraRoute(pattern, "StaticStripHandler:"+dir)
 	http.Handle(pattern, http.StripPrefix(pattern, http.FileServer(http.Dir(dir))))
 }
 
-//调整logger的设置
-func loggerAdjust(w http.ResponseWriter, r *http.Request) {
-	logger.Info("change logger level to", r.FormValue("level"))
-	logger.SetLevelStr(r.FormValue("level"))
-}
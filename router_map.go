@@ -5,8 +5,8 @@ import (
 	"reflect"
 	"strings"
 
-	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/encoding"
+	logger "github.com/hsyan2008/hfw/logging"
 )
 
 type instance struct {
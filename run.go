@@ -3,6 +3,7 @@ package hfw
 import (
 	"net/http"
 
+	"github.com/hsyan2008/hfw/admin"
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/signal"
 )
@@ -30,6 +31,12 @@ func Run() (err error) {
 		return
 	}
 
+	//单独监听的管理接口
+	if err = admin.Start(); err != nil {
+		signalContext.Fatal(err)
+		return
+	}
+
 	//启动http
 	signalContext.IsHTTP = true
 
@@ -7,15 +7,21 @@ import (
 	"sync/atomic"
 	"time"
 
-	logger "github.com/hsyan2008/go-logger"
+	"github.com/hsyan2008/hfw/accesslog"
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/grpc/auth"
 	"github.com/hsyan2008/hfw/grpc/discovery"
 	"github.com/hsyan2008/hfw/grpc/server"
+	logger "github.com/hsyan2008/hfw/logging"
 	"github.com/hsyan2008/hfw/prometheus"
 	"github.com/hsyan2008/hfw/signal"
+	"github.com/hsyan2008/hfw/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 )
@@ -24,7 +30,25 @@ import (
 //如果是grpc，请配置好Server和GrpcServer并使用NewGrpcServer+hfw.RunGrpc
 //如果是grpc+http，请配置好Server和GrpcServer并使用NewGrpcServer+hfw.RunGrpc+hfw.Run
 
+//按方法限制调用方身份，在NewGrpcServer里根据配置初始化
+var identityACL *auth.IdentityACL
+
+//开启Server.Auth.IsEnable后，在拦截器里自动认证
+var authenticator *auth.Authenticator
+
+const healthServiceName = "grpc.health.v1.Health"
+
 func NewGrpcServer(config configs.AllConfig) (s *grpc.Server, err error) {
+	identityACL = auth.NewIdentityACL(config.Server.AllowedIdentities)
+	if config.Server.Auth.IsEnable {
+		authenticator, err = auth.NewAuthenticator(config.Server.Auth)
+		if err != nil {
+			return nil, err
+		}
+		if authenticator == nil {
+			return nil, errors.New("grpc auth is enabled, but no StaticKeys, APIKeys or JWT configured")
+		}
+	}
 	return server.NewServer(config.Server.ServerConfig, grpc.UnaryInterceptor(UnaryServerInterceptor),
 		grpc.StreamInterceptor(StreamServerInterceptor))
 }
@@ -65,6 +89,13 @@ func RunGrpc(s *grpc.Server, config configs.GrpcServerConfig) (err error) {
 		defer r.UnRegister()
 	}
 
+	//健康检查服务，客户端开启GrpcConfig.HealthCheck后使用
+	var healthServer *health.Server
+	if _, ok := s.GetServiceInfo()[healthServiceName]; !ok {
+		healthServer = health.NewServer()
+		healthpb.RegisterHealthServer(s, healthServer)
+	}
+
 	go func() {
 		signalContext.WgAdd()
 		defer signalContext.WgDone()
@@ -72,6 +103,10 @@ func RunGrpc(s *grpc.Server, config configs.GrpcServerConfig) (err error) {
 		case <-signalContext.Ctx.Done():
 			signalContext.Info("grpc server stoping...")
 			defer signalContext.Info("grpc server stoped")
+			if healthServer != nil {
+				//先让客户端不再调用
+				healthServer.Shutdown()
+			}
 			s.GracefulStop()
 		}
 	}()
@@ -92,6 +127,12 @@ func UnaryServerInterceptor(
 	defer httpCtx.Cancel()
 	httpCtx.AppendPrefix("Path:" + info.FullMethod)
 
+	httpCtx.Ctx = accesslog.ContextWithCounter(httpCtx.Ctx)
+	span := startGrpcServerSpan(httpCtx, info.FullMethod)
+	defer func() {
+		endGrpcSpan(span, err)
+	}()
+
 	httpCtx.Debug("Req:", req)
 	defer func() {
 		if err == nil {
@@ -104,17 +145,18 @@ func UnaryServerInterceptor(
 	}()
 
 	startTime := time.Now()
-	prometheus.RequestsTotal(info.FullMethod, "GRPC")
 	defer func() {
 		costTime := time.Since(startTime)
 		httpCtx.Mixf("Method:%s CostTime:%s", "GRPC", costTime)
-		prometheus.RequestsCosttime(info.FullMethod, "GRPC", costTime)
+		grpcRequestDone(httpCtx, info.FullMethod, "GRPC", req, resp, err, costTime)
 	}()
 
 	onlineNum := atomic.AddUint32(&online, 1)
+	prometheus.RequestsInFlight("grpc", 1)
 	httpCtx.Mixf("Online:%d", onlineNum)
 	defer func() {
 		atomic.AddUint32(&online, ^uint32(0))
+		prometheus.RequestsInFlight("grpc", -1)
 		if e := recover(); e != nil {
 			if e == ErrStopRun {
 				return
@@ -129,6 +171,16 @@ func UnaryServerInterceptor(
 		return
 	}
 
+	err = checkPeerIdentity(httpCtx, info.FullMethod)
+	if err != nil {
+		return
+	}
+
+	err = checkAuth(httpCtx, info.FullMethod)
+	if err != nil {
+		return
+	}
+
 	return handler(httpCtx, req)
 }
 
@@ -141,6 +193,12 @@ func StreamServerInterceptor(
 	defer httpCtx.Cancel()
 	httpCtx.AppendPrefix("Path:" + info.FullMethod)
 
+	httpCtx.Ctx = accesslog.ContextWithCounter(httpCtx.Ctx)
+	span := startGrpcServerSpan(httpCtx, info.FullMethod)
+	defer func() {
+		endGrpcSpan(span, err)
+	}()
+
 	defer func() {
 		if err != nil {
 			httpCtx.Warn("Err:", err)
@@ -148,17 +206,18 @@ func StreamServerInterceptor(
 	}()
 
 	startTime := time.Now()
-	prometheus.RequestsTotal(info.FullMethod, "Stream")
 	defer func() {
 		costTime := time.Since(startTime)
 		httpCtx.Mixf("Method:%s CostTime:%s", "Stream", costTime)
-		prometheus.RequestsCosttime(info.FullMethod, "Stream", costTime)
+		grpcRequestDone(httpCtx, info.FullMethod, "Stream", nil, nil, err, costTime)
 	}()
 
 	onlineNum := atomic.AddUint32(&online, 1)
+	prometheus.RequestsInFlight("grpc", 1)
 	httpCtx.Mixf("Online:%d", onlineNum)
 	defer func() {
 		atomic.AddUint32(&online, ^uint32(0))
+		prometheus.RequestsInFlight("grpc", -1)
 		if e := recover(); e != nil {
 			if e == ErrStopRun {
 				return
@@ -173,9 +232,70 @@ func StreamServerInterceptor(
 		return
 	}
 
+	err = checkPeerIdentity(httpCtx, info.FullMethod)
+	if err != nil {
+		return
+	}
+
+	err = checkAuth(httpCtx, info.FullMethod)
+	if err != nil {
+		return
+	}
+
 	return handler(srv, WarpServerStream(ss, httpCtx))
 }
 
+//startGrpcServerSpan 从metadata里取出上游的traceparent，没有则使用日志的trace_id作为新trace的id
+func startGrpcServerSpan(httpCtx *HTTPContext, fullMethod string) *trace.Span {
+	md, _ := metadata.FromIncomingContext(httpCtx.Ctx)
+	ctx := trace.Extract(httpCtx.Ctx, func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	})
+	var span *trace.Span
+	httpCtx.Ctx, span = trace.Start(trace.ContextWithTraceID(ctx, httpCtx.GetTraceID()), fullMethod, trace.SpanKindServer)
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.method", fullMethod)
+
+	return span
+}
+
+func endGrpcSpan(span *trace.Span, err error) {
+	code := status.Code(err)
+	span.SetAttribute("rpc.grpc.status_code", int(code))
+	if code != codes.OK {
+		span.SetError(err)
+	}
+	span.End()
+}
+
+//把客户端证书的身份放入httpCtx，并检查是否允许调用
+func checkPeerIdentity(httpCtx *HTTPContext, fullMethod string) error {
+	id := auth.GetPeerIdentity(httpCtx.Ctx)
+	if id != nil {
+		httpCtx.Ctx = auth.NewContextWithPeerIdentity(httpCtx.Ctx, id)
+		httpCtx.AppendPrefix("Peer:" + id.String())
+	}
+
+	return identityACL.Check(fullMethod, id)
+}
+
+//认证通过后，Claims放入httpCtx，handler里用auth.ClaimsFromContext(ctx)获取
+func checkAuth(httpCtx *HTTPContext, fullMethod string) error {
+	ctx, err := authenticator.Check(httpCtx.Ctx, fullMethod)
+	if err != nil {
+		return err
+	}
+	httpCtx.Ctx = ctx
+	if claims, ok := auth.ClaimsFromContext(ctx); ok {
+		httpCtx.AppendPrefix("Sub:" + claims.Subject)
+	}
+
+	return nil
+}
+
 func WarpServerStream(ss grpc.ServerStream, httpCtx *HTTPContext) *GrpcServerStream {
 	return &GrpcServerStream{
 		ServerStream: ss,
@@ -8,11 +8,11 @@ import (
 	"sync"
 	"time"
 
-	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/gracehttp"
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/grpc/discovery"
+	logger "github.com/hsyan2008/hfw/logging"
 )
 
 var listener net.Listener
@@ -0,0 +1,207 @@
+package discovery
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hsyan2008/hfw/grpc/balancer/p2c"
+	"github.com/hsyan2008/hfw/grpc/balancer/wrr"
+	"google.golang.org/grpc/resolver"
+)
+
+type balancePolicy uint
+
+const (
+	UnknownPolicy balancePolicy = iota
+	RobinPolicy
+	RandPolicy
+	//WeightedPolicy 平滑加权轮询，同grpc的weighted_round_robin
+	WeightedPolicy
+	//P2CPolicy 同grpc的p2c，选择耗时和并发较低的节点
+	P2CPolicy
+)
+
+const (
+	//统计衰减的时间，同grpc的p2c
+	decayTime   = int64(time.Second * 10)
+	initSuccess = 1000
+	//成功率低于一半的节点认为不健康，尽量不选择
+	throttleSuccess = initSuccess / 2
+	penalty         = int64(math.MaxInt32)
+	pickTimes       = 3
+)
+
+//policyByName 和GrpcConfig.BalancerName对应
+func policyByName(name string) balancePolicy {
+	switch name {
+	case "round_robin":
+		return RobinPolicy
+	case wrr.Name:
+		return WeightedPolicy
+	case p2c.Name:
+		return P2CPolicy
+	default:
+		return UnknownPolicy
+	}
+}
+
+//nodeStats 节点的统计，同一个地址在节点变化后继续使用
+type nodeStats struct {
+	lag      uint64
+	inflight int64
+	success  uint64
+	last     int64
+}
+
+func newNodeStats() *nodeStats {
+	return &nodeStats{success: initSuccess}
+}
+
+func (s *nodeStats) healthy() bool {
+	return atomic.LoadUint64(&s.success) > throttleSuccess
+}
+
+func (s *nodeStats) load() int64 {
+	lag := int64(math.Sqrt(float64(atomic.LoadUint64(&s.lag) + 1)))
+	load := lag * (atomic.LoadInt64(&s.inflight) + 1)
+	if load == 0 {
+		return penalty
+	}
+	return load
+}
+
+//start 选中节点时调用，返回请求结束时调用的函数
+func (s *nodeStats) start() func(error) {
+	atomic.AddInt64(&s.inflight, 1)
+	start := int64(p2c.Now())
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			atomic.AddInt64(&s.inflight, -1)
+			now := int64(p2c.Now())
+			td := now - atomic.SwapInt64(&s.last, now)
+			if td < 0 {
+				td = 0
+			}
+			w := math.Exp(float64(-td) / float64(decayTime))
+			lag := now - start
+			if lag < 0 {
+				lag = 0
+			}
+			olag := atomic.LoadUint64(&s.lag)
+			if olag == 0 {
+				w = 0
+			}
+			atomic.StoreUint64(&s.lag, uint64(float64(olag)*w+float64(lag)*(1-w)))
+			success := initSuccess
+			if err != nil {
+				success = 0
+			}
+			osucc := atomic.LoadUint64(&s.success)
+			atomic.StoreUint64(&s.success, uint64(float64(osucc)*w+float64(success)*(1-w)))
+		})
+	}
+}
+
+type node struct {
+	addr  resolver.Address
+	stats *nodeStats
+}
+
+type picker interface {
+	pick() *node
+}
+
+func newPicker(policy balancePolicy, nodes []*node) picker {
+	switch policy {
+	case RandPolicy:
+		return &randPicker{nodes: nodes, r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	case WeightedPolicy:
+		return newWeightedPicker(nodes)
+	case P2CPolicy:
+		return &p2cPicker{nodes: nodes, r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	default:
+		return &robinPicker{nodes: nodes}
+	}
+}
+
+//robinPicker 轮询
+type robinPicker struct {
+	nodes []*node
+	index uint64
+}
+
+func (p *robinPicker) pick() *node {
+	i := atomic.AddUint64(&p.index, 1) - 1
+	return p.nodes[i%uint64(len(p.nodes))]
+}
+
+//randPicker 随机
+type randPicker struct {
+	nodes []*node
+	r     *rand.Rand
+	lock  sync.Mutex
+}
+
+func (p *randPicker) pick() *node {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.nodes[p.r.Intn(len(p.nodes))]
+}
+
+//weightedPicker 复用grpc的平滑加权轮询
+type weightedPicker struct {
+	p     *wrr.Picker
+	nodes map[*wrr.Node]*node
+}
+
+func newWeightedPicker(nodes []*node) *weightedPicker {
+	wp := &weightedPicker{nodes: make(map[*wrr.Node]*node, len(nodes))}
+	list := make([]*wrr.Node, 0, len(nodes))
+	for _, n := range nodes {
+		wn := wrr.NewNode(nil, n.addr)
+		wp.nodes[wn] = n
+		list = append(list, wn)
+	}
+	wp.p = wrr.NewPicker(list)
+	return wp
+}
+
+func (p *weightedPicker) pick() *node {
+	return p.nodes[p.p.Next()]
+}
+
+//p2cPicker 随机选两个节点，使用负载低的
+type p2cPicker struct {
+	nodes []*node
+	r     *rand.Rand
+	lock  sync.Mutex
+}
+
+func (p *p2cPicker) pick() *node {
+	if len(p.nodes) == 1 {
+		return p.nodes[0]
+	}
+
+	p.lock.Lock()
+	a := p.r.Intn(len(p.nodes))
+	b := p.r.Intn(len(p.nodes) - 1)
+	p.lock.Unlock()
+	if b >= a {
+		b++
+	}
+	n1, n2 := p.nodes[a], p.nodes[b]
+	if n1.stats.healthy() != n2.stats.healthy() {
+		if n1.stats.healthy() {
+			return n1
+		}
+		return n2
+	}
+	if n1.stats.load() > n2.stats.load() {
+		return n2
+	}
+	return n1
+}
@@ -1,16 +1,31 @@
 package client
 
 import (
+	"fmt"
+	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/hashicorp/consul/api"
+	"github.com/hsyan2008/hfw/configs"
+	logger "github.com/hsyan2008/hfw/logging"
 )
 
 var consulClientMap = make(map[string]*api.Client)
 var consulClientRwLock = new(sync.RWMutex)
 
 func NewConsulClient(address string) (*api.Client, error) {
-	key := address
+	return NewConsulClientWithConfig([]string{address}, configs.ConsulConfig{})
+}
+
+//NewConsulClientWithConfig 相同的地址和配置共用一个client，多个地址时不可用则切换到下一个
+func NewConsulClientWithConfig(addresses []string, conf configs.ConsulConfig) (*api.Client, error) {
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("nil consul addresses")
+	}
+	key := fmt.Sprintf("%s_%s_%s_%s_%s_%s_%s_%t", strings.Join(addresses, ","), conf.Token, conf.Datacenter, conf.Namespace,
+		conf.CaFile, conf.CertFile, conf.KeyFile, conf.InsecureSkipVerify)
 	consulClientRwLock.RLock()
 	if cr, ok := consulClientMap[key]; ok {
 		consulClientRwLock.RUnlock()
@@ -26,7 +41,41 @@ func NewConsulClient(address string) (*api.Client, error) {
 	}
 
 	config := api.DefaultConfig()
-	config.Address = address
+	config.Token = conf.Token
+	config.Datacenter = conf.Datacenter
+	config.Namespace = conf.Namespace
+
+	hosts := make([]string, len(addresses))
+	for i, address := range addresses {
+		//地址可以带http://或者https://
+		if pos := strings.Index(address, "://"); pos > 0 {
+			config.Scheme = address[:pos]
+			address = address[pos+3:]
+		}
+		hosts[i] = address
+	}
+	config.Address = hosts[0]
+
+	transport := config.Transport
+	if conf.CaFile != "" || conf.CertFile != "" || conf.InsecureSkipVerify {
+		config.Scheme = "https"
+		tlsConfig, err := api.SetupTLSConfig(&api.TLSConfig{
+			CAFile:             absPath(conf.CaFile),
+			CertFile:           absPath(conf.CertFile),
+			KeyFile:            absPath(conf.KeyFile),
+			InsecureSkipVerify: conf.InsecureSkipVerify,
+		})
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	if len(hosts) > 1 {
+		config.HttpClient = &http.Client{Transport: &failoverTransport{base: transport, hosts: hosts}}
+	} else {
+		config.HttpClient = &http.Client{Transport: transport}
+	}
+
 	client, err := api.NewClient(config)
 	if err != nil {
 		return nil, err
@@ -35,3 +84,41 @@ func NewConsulClient(address string) (*api.Client, error) {
 
 	return client, nil
 }
+
+//failoverTransport 请求失败时按顺序使用下一个agent，成功后一直使用该agent
+type failoverTransport struct {
+	base    http.RoundTripper
+	hosts   []string
+	current uint32
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	n := uint32(len(t.hosts))
+	start := atomic.LoadUint32(&t.current)
+	for i := uint32(0); i < n; i++ {
+		index := (start + i) % n
+		r := req.Clone(req.Context())
+		r.URL.Host = t.hosts[index]
+		r.Host = t.hosts[index]
+		if i > 0 && req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, err
+			}
+			if r.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		resp, err = t.base.RoundTrip(r)
+		if err == nil {
+			if index != start && atomic.CompareAndSwapUint32(&t.current, start, index) {
+				logger.Warnf("consul agent %s is unavailable, switch to %s", t.hosts[start], t.hosts[index])
+			}
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
@@ -0,0 +1,25 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestConsulClientKey(t *testing.T) {
+	addresses := []string{"127.0.0.1:8500"}
+	c1, err := NewConsulClientWithConfig(addresses, configs.ConsulConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := NewConsulClientWithConfig(addresses, configs.ConsulConfig{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1 == c2 {
+		t.Fatal("different tls config should not share client")
+	}
+	if c3, _ := NewConsulClientWithConfig(addresses, configs.ConsulConfig{InsecureSkipVerify: true}); c3 != c2 {
+		t.Fatal("same config should share client")
+	}
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var defaultEtcdDialTimeout int64 = 5
+
+var etcdClientMap = make(map[string]*clientv3.Client)
+var etcdClientRwLock = new(sync.RWMutex)
+
+//NewEtcdClient 相同的地址和配置共用一个client
+func NewEtcdClient(endpoints []string, conf configs.EtcdConfig) (*clientv3.Client, error) {
+	key := etcdClientKey(endpoints, conf)
+	etcdClientRwLock.RLock()
+	if cli, ok := etcdClientMap[key]; ok {
+		etcdClientRwLock.RUnlock()
+		return cli, nil
+	}
+	etcdClientRwLock.RUnlock()
+
+	etcdClientRwLock.Lock()
+	defer etcdClientRwLock.Unlock()
+
+	if cli, ok := etcdClientMap[key]; ok {
+		return cli, nil
+	}
+
+	dialTimeout := conf.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultEtcdDialTimeout
+	}
+	config := clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: time.Duration(dialTimeout) * time.Second,
+		Username:    conf.Username,
+		Password:    conf.Password,
+	}
+	if conf.CaFile != "" {
+		tlsConfig, err := etcdTLSConfig(conf)
+		if err != nil {
+			return nil, err
+		}
+		config.TLS = tlsConfig
+	}
+	cli, err := clientv3.New(config)
+	if err != nil {
+		return nil, err
+	}
+	etcdClientMap[key] = cli
+
+	return cli, nil
+}
+
+//etcdClientKey 影响client的配置都要包含，Prefix不影响
+func etcdClientKey(endpoints []string, conf configs.EtcdConfig) string {
+	return fmt.Sprintf("%s_%s_%s_%s_%s_%s_%d", strings.Join(endpoints, ","), conf.Username, conf.Password,
+		conf.CaFile, conf.CertFile, conf.KeyFile, conf.DialTimeout)
+}
+
+func etcdTLSConfig(conf configs.EtcdConfig) (*tls.Config, error) {
+	ca, err := ioutil.ReadFile(absPath(conf.CaFile))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid etcd ca file: %s", conf.CaFile)
+	}
+	tlsConfig := &tls.Config{RootCAs: pool}
+	if conf.CertFile != "" && conf.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(absPath(conf.CertFile), absPath(conf.KeyFile))
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func absPath(file string) string {
+	if file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(common.GetAppPath(), file)
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestEtcdClientKey(t *testing.T) {
+	endpoints := []string{"127.0.0.1:2379"}
+	conf := configs.EtcdConfig{Username: "u", Password: "p1", CaFile: "ca.pem", CertFile: "a.pem", KeyFile: "a.key"}
+	key := etcdClientKey(endpoints, conf)
+
+	c := conf
+	c.Password = "p2"
+	if etcdClientKey(endpoints, c) == key {
+		t.Fatal("different password should not share client")
+	}
+	c = conf
+	c.CertFile = "b.pem"
+	if etcdClientKey(endpoints, c) == key {
+		t.Fatal("different cert should not share client")
+	}
+	c = conf
+	c.DialTimeout = 10
+	if etcdClientKey(endpoints, c) == key {
+		t.Fatal("different dial timeout should not share client")
+	}
+	c = conf
+	c.Prefix = "other"
+	if etcdClientKey(endpoints, c) != key {
+		t.Fatal("prefix should share client")
+	}
+}
@@ -0,0 +1,296 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	gdiscovery "github.com/hsyan2008/hfw/grpc/discovery"
+	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
+	logger "github.com/hsyan2008/hfw/logging"
+	"google.golang.org/grpc/resolver"
+)
+
+//Resolver http调用的服务发现，和grpc使用同一套resolver
+//支持consul、etcd、k8s、file、dns、memory、static，只使用健康的节点
+type Resolver struct {
+	watcher *gdiscovery.Watcher
+	key     string
+	//NewResolver的次数，Close到0时才关闭
+	refs int32
+
+	//节点需要包含全部的tag
+	tags []string
+	//路由规则，同GrpcConfig.Routes
+	routes []configs.GrpcRouteConfig
+	policy balancePolicy
+
+	lock    sync.Mutex
+	changed <-chan struct{}
+	nodes   []*node
+	//每个路由规则对应的picker，最后一个是不匹配任何规则的节点，没有节点则为nil
+	groups []picker
+	stats  map[string]*nodeStats
+}
+
+//ConsulResolver 兼容旧的名字
+type ConsulResolver = Resolver
+
+var resolverMap = make(map[string]*Resolver)
+var resolverRwLock = new(sync.RWMutex)
+
+//NewResolver 相同的配置共用一个Resolver，每次NewResolver都需要对应一次Close
+//opts里没有指定时，tag、路由规则和负载均衡策略使用cc里的配置，负载均衡默认是轮询
+func NewResolver(cc configs.GrpcConfig, opts ...CallOpt) (*Resolver, error) {
+	r := &Resolver{}
+	for _, f := range opts {
+		if err := f(r); err != nil {
+			return nil, err
+		}
+	}
+	if len(r.tags) == 0 && cc.Tag != "" {
+		r.tags = []string{cc.Tag}
+	}
+	//resolver按第一个tag查询，其他的tag在本地过滤
+	if len(r.tags) > 0 {
+		cc.Tag = r.tags[0]
+	}
+	if len(r.routes) == 0 {
+		r.routes = cc.Routes
+	}
+	if r.policy == UnknownPolicy {
+		r.policy = policyByName(cc.BalancerName)
+	}
+
+	r.key = fmt.Sprintf("%s_%s_%s_%s_%s_%d_%s_%v", cc.ResolverType, cc.ServerName, strings.Join(cc.ResolverAddresses, ","), cc.Consul.Datacenter,
+		strings.Join(cc.Addresses, ","), r.policy, strings.Join(r.tags, ","), r.routes)
+	resolverRwLock.RLock()
+	if cr, ok := resolverMap[r.key]; ok {
+		//Close需要写锁，这里只需要原子操作
+		atomic.AddInt32(&cr.refs, 1)
+		resolverRwLock.RUnlock()
+		return cr, nil
+	}
+	resolverRwLock.RUnlock()
+
+	resolverRwLock.Lock()
+	defer resolverRwLock.Unlock()
+
+	if cr, ok := resolverMap[r.key]; ok {
+		atomic.AddInt32(&cr.refs, 1)
+		return cr, nil
+	}
+
+	w, err := gdiscovery.Watch(cc)
+	if err != nil {
+		return nil, err
+	}
+	r.watcher = w
+	r.stats = make(map[string]*nodeStats)
+	r.refs = 1
+	resolverMap[r.key] = r
+
+	return r, nil
+}
+
+//Close 共用的Resolver，全部调用方都Close后才关闭，之后再NewResolver会重新创建
+func (r *Resolver) Close() {
+	resolverRwLock.Lock()
+	if resolverMap[r.key] != r || atomic.AddInt32(&r.refs, -1) > 0 {
+		resolverRwLock.Unlock()
+		return
+	}
+	delete(resolverMap, r.key)
+	resolverRwLock.Unlock()
+
+	r.watcher.Close()
+}
+
+func (r *Resolver) ServiceName() string {
+	return r.watcher.ServiceName()
+}
+
+//Addresses 按tag过滤后的节点
+func (r *Resolver) Addresses() []string {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.refresh()
+
+	addresses := make([]string, len(r.nodes))
+	for i, n := range r.nodes {
+		addresses[i] = n.addr.Addr
+	}
+	return addresses
+}
+
+//Endpoints 当前全部的节点，包含权重、区域和元数据
+func (r *Resolver) Endpoints() []resolver.Address {
+	return r.watcher.Addresses()
+}
+
+func (r *Resolver) Routes() []configs.GrpcRouteConfig {
+	return r.routes
+}
+
+func (r *Resolver) GetAddress() (address string, err error) {
+	return r.GetAddressByHeader(nil)
+}
+
+//GetAddressByHeader 配置了路由规则时，根据请求头选择节点
+func (r *Resolver) GetAddressByHeader(header http.Header) (address string, err error) {
+	address, done, err := r.Pick(header)
+	if err == nil {
+		//不统计结果
+		done(nil)
+	}
+	return
+}
+
+//Pick 选择节点，请求结束后需要调用done，用于p2c和排除失败较多的节点
+func (r *Resolver) Pick(header http.Header) (address string, done func(err error), err error) {
+	if r == nil {
+		return "", nil, errors.New("resolver not init")
+	}
+
+	r.lock.Lock()
+	r.refresh()
+	p := r.groups[len(r.groups)-1]
+	if i := dc.MatchRoute(r.routes, header.Get); i >= 0 && r.groups[i] != nil {
+		p = r.groups[i]
+	}
+	r.lock.Unlock()
+
+	if p == nil {
+		return "", nil, errors.New("addresses is nil")
+	}
+	var n *node
+	for i := 0; i < pickTimes; i++ {
+		if n = p.pick(); n.stats.healthy() {
+			break
+		}
+	}
+
+	return n.addr.Addr, n.stats.start(), nil
+}
+
+//refresh 节点有变化时重新生成picker，需要持有lock
+func (r *Resolver) refresh() {
+	if r.groups != nil {
+		select {
+		case <-r.changed:
+		default:
+			return
+		}
+	}
+	//先取changed，避免错过之后的变化
+	r.changed = r.watcher.Changed()
+	addrs := r.watcher.Addresses()
+
+	nodes := make([]*node, 0, len(addrs))
+	stats := make(map[string]*nodeStats, len(addrs))
+	for _, addr := range addrs {
+		if !hasAllTags(dc.GetAddressTags(addr), r.tags) {
+			continue
+		}
+		s, ok := r.stats[addr.Addr]
+		if !ok {
+			s = newNodeStats()
+		}
+		stats[addr.Addr] = s
+		nodes = append(nodes, &node{addr: addr, stats: s})
+	}
+	r.nodes, r.stats = nodes, stats
+
+	//命中规则的使用规则Meta匹配的节点，其他使用不匹配任何规则的节点
+	//没有匹配的节点则使用全部节点
+	filter := func(f func(meta map[string]string) bool) (list []*node) {
+		for _, n := range nodes {
+			if f(dc.GetAddressMeta(n.addr)) {
+				list = append(list, n)
+			}
+		}
+		return
+	}
+	r.groups = make([]picker, len(r.routes)+1)
+	for i, route := range r.routes {
+		if list := filter(func(meta map[string]string) bool {
+			return dc.MatchMeta(route.Meta, meta)
+		}); len(list) > 0 {
+			r.groups[i] = newPicker(r.policy, list)
+		}
+	}
+	list := filter(func(meta map[string]string) bool {
+		return !dc.MatchAnyRoute(r.routes, meta)
+	})
+	if len(list) == 0 {
+		list = nodes
+	}
+	if len(list) > 0 {
+		r.groups[len(r.routes)] = newPicker(r.policy, list)
+	}
+}
+
+//HasTag 是否有节点包含tag
+func (r *Resolver) HasTag(tag string) bool {
+	for _, addr := range r.watcher.Addresses() {
+		if common.IsInStringArray(tag, dc.GetAddressTags(addr)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAllTags(has, tags []string) bool {
+	for _, tag := range tags {
+		if !common.IsInStringArray(tag, has) {
+			return false
+		}
+	}
+	return true
+}
+
+type CallOpt func(*Resolver) error
+
+func TagCallOpt(tags ...string) CallOpt {
+	return func(cr *Resolver) error {
+		cr.tags = tags
+		return nil
+	}
+}
+
+func BalancePolicyCallOpt(balancePolicy balancePolicy) CallOpt {
+	return func(cr *Resolver) error {
+		cr.policy = balancePolicy
+		return nil
+	}
+}
+
+//PassingOnlyCallOpt 已废弃，同grpc一样只使用通过健康检查的节点，不支持false
+func PassingOnlyCallOpt(passingOnly bool) CallOpt {
+	return func(cr *Resolver) error {
+		if !passingOnly {
+			return errors.New("PassingOnlyCallOpt(false) is not supported, only passing nodes are used")
+		}
+		logger.Warn("PassingOnlyCallOpt is deprecated, only passing nodes are used")
+		return nil
+	}
+}
+
+//RouteCallOpt 路由规则，如灰度
+func RouteCallOpt(routes ...configs.GrpcRouteConfig) CallOpt {
+	return func(cr *Resolver) error {
+		cr.routes = routes
+		return nil
+	}
+}
+
+var NewTagCallOpt = TagCallOpt
+var NewBalancePolicyCallOpt = BalancePolicyCallOpt
@@ -0,0 +1,170 @@
+package discovery
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	dc "github.com/hsyan2008/hfw/grpc/discovery/common"
+	"github.com/hsyan2008/hfw/grpc/discovery/memory"
+)
+
+func TestResolver(t *testing.T) {
+	registry := memory.Get("http_resolver")
+	register := func(id, addr string, tags []string, meta map[string]string) {
+		err := registry.Register(memory.Instance{ID: id, Name: "hello", Addr: addr, Tags: tags, Meta: meta}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	register("1", "127.0.0.1:1001", []string{"http", "v1"}, map[string]string{dc.WeightKey: "300"})
+	register("2", "127.0.0.1:1002", []string{"http", "v1"}, map[string]string{dc.WeightKey: "100"})
+	register("3", "127.0.0.1:1003", []string{"http"}, map[string]string{dc.VersionKey: "v2"})
+
+	cc := configs.GrpcConfig{
+		ServerName:        "hello",
+		ResolverType:      dc.MemoryResolver,
+		ResolverAddresses: []string{"http_resolver"},
+	}
+
+	//多个tag在本地过滤
+	r, err := NewResolver(cc, TagCallOpt("http", "v1"), BalancePolicyCallOpt(WeightedPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if addrs := r.Addresses(); len(addrs) != 2 {
+		t.Fatalf("unexpected addresses: %v", addrs)
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 400; i++ {
+		addr, err := r.GetAddress()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[addr]++
+	}
+	if counts["127.0.0.1:1001"] != 300 || counts["127.0.0.1:1002"] != 100 {
+		t.Fatalf("unexpected weighted counts: %v", counts)
+	}
+
+	//路由规则
+	r2, err := NewResolver(cc, RouteCallOpt(configs.GrpcRouteConfig{
+		Headers: map[string]string{"x-canary": "1"},
+		Meta:    map[string]string{dc.VersionKey: "v2"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	header := http.Header{}
+	header.Set("x-canary", "1")
+	if addr, _ := r2.GetAddressByHeader(header); addr != "127.0.0.1:1003" {
+		t.Fatalf("canary request to %s", addr)
+	}
+	for i := 0; i < 4; i++ {
+		if addr, _ := r2.GetAddress(); addr == "127.0.0.1:1003" {
+			t.Fatal("normal request to canary node")
+		}
+	}
+
+	//失败的节点尽量不选择
+	r3, err := NewResolver(cc, TagCallOpt("v1"), BalancePolicyCallOpt(P2CPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r3.Close()
+	for i := 0; i < 20; i++ {
+		addr, done, err := r3.Pick(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr == "127.0.0.1:1002" {
+			done(errors.New("failed"))
+		} else {
+			done(nil)
+		}
+	}
+	counts = make(map[string]int)
+	for i := 0; i < 20; i++ {
+		addr, done, _ := r3.Pick(nil)
+		done(nil)
+		counts[addr]++
+	}
+	if counts["127.0.0.1:1001"] != 20 {
+		t.Fatalf("unexpected p2c counts: %v", counts)
+	}
+
+	//节点变化
+	registry.Deregister("hello", "1")
+	deadline := time.Now().Add(time.Second)
+	for len(r.Addresses()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected addresses after deregister: %v", r.Addresses())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestResolverShared(t *testing.T) {
+	registry := memory.Get("http_resolver_shared")
+	if err := registry.Register(memory.Instance{ID: "1", Name: "hello", Addr: "127.0.0.1:1001"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	cc := configs.GrpcConfig{
+		ServerName:        "hello",
+		ResolverType:      dc.MemoryResolver,
+		ResolverAddresses: []string{"http_resolver_shared"},
+	}
+
+	r1, err := NewResolver(cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := NewResolver(cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1 != r2 {
+		t.Fatal("same config should share resolver")
+	}
+
+	//其他调用方Close后仍然可以使用
+	r1.Close()
+	resolverRwLock.RLock()
+	_, ok := resolverMap[r2.key]
+	resolverRwLock.RUnlock()
+	if !ok {
+		t.Fatal("resolver closed while still in use")
+	}
+	if addr, err := r2.GetAddress(); err != nil || addr != "127.0.0.1:1001" {
+		t.Fatalf("unexpected address: %s %v", addr, err)
+	}
+
+	r2.Close()
+	resolverRwLock.RLock()
+	_, ok = resolverMap[r2.key]
+	resolverRwLock.RUnlock()
+	if ok {
+		t.Fatal("resolver should be removed after last Close")
+	}
+	//多余的Close不影响新创建的
+	r3, err := NewResolver(cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r3.Close()
+	r2.Close()
+	if r3 == r2 {
+		t.Fatal("resolver should be recreated")
+	}
+	if addr, err := r3.GetAddress(); err != nil || addr != "127.0.0.1:1001" {
+		t.Fatalf("unexpected address: %s %v", addr, err)
+	}
+
+	if _, err = NewResolver(cc, PassingOnlyCallOpt(false)); err == nil {
+		t.Fatal("PassingOnlyCallOpt(false) should fail")
+	}
+}
@@ -1,11 +1,14 @@
 package session
 
 import (
+	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/prometheus"
 )
 
 type sessionStoreInterface interface {
@@ -26,6 +29,23 @@ type Session struct {
 	cookieName string
 	reName     bool
 	expiration int64
+	storeName  string
+}
+
+//storeNamer 可选，用于prometheus的store标签，没有实现则使用类型名
+type storeNamer interface {
+	Name() string
+}
+
+func getStoreName(store sessionStoreInterface) string {
+	if n, ok := store.(storeNamer); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", store)
+}
+
+func (s *Session) observe(op string, start time.Time) {
+	prometheus.SessionStore(s.storeName, op, time.Since(start))
 }
 
 var sessPool = sync.Pool{
@@ -59,6 +79,7 @@ func NewSession(request *http.Request, store sessionStoreInterface, config confi
 	}
 
 	s.store = store
+	s.storeName = getStoreName(store)
 	s.store.SetExpiration(s.expiration)
 
 	return
@@ -85,28 +106,34 @@ func (s *Session) Close(request *http.Request, response http.ResponseWriter) {
 }
 
 func (s *Session) IsExist(k string) bool {
+	defer s.observe("IsExist", time.Now())
 	v, _ := s.store.IsExist(s.id, k)
 	return v
 }
 
 func (s *Session) Set(k string, v interface{}) {
+	defer s.observe("Put", time.Now())
 	_ = s.store.Put(s.id, k, v)
 }
 
 func (s *Session) Get(value interface{}, k string) {
+	defer s.observe("Get", time.Now())
 	s.store.Get(value, s.id, k)
 }
 
 func (s *Session) Del(k string) {
+	defer s.observe("Del", time.Now())
 	_ = s.store.Del(s.id, k)
 }
 
 func (s *Session) Destroy() {
+	defer s.observe("Destroy", time.Now())
 	_ = s.store.Destroy(s.id)
 }
 
 func (s *Session) Rename() (err error) {
 	if s.id != s.newid {
+		defer s.observe("Rename", time.Now())
 		return s.store.Rename(s.id, s.newid)
 	}
 
@@ -31,6 +31,10 @@ func NewSessRedisStore(redisIns *redis.Client, config configs.RedisConfig) *sess
 	return sessRedisStoreIns
 }
 
+func (s *sessRedisStore) Name() string {
+	return "redis"
+}
+
 func (s *sessRedisStore) SetExpiration(expiration int64) {
 	if expiration > 0 {
 		s.expiration = expiration
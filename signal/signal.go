@@ -13,8 +13,8 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/common"
+	logger "github.com/hsyan2008/hfw/logging"
 )
 
 type signalContext struct {
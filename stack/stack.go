@@ -9,7 +9,7 @@ import (
 	"syscall"
 	"time"
 
-	logger "github.com/hsyan2008/go-logger"
+	logger "github.com/hsyan2008/hfw/logging"
 )
 
 // kill -USR1 pid
@@ -48,9 +48,19 @@ func SetupStack(file string) {
 }
 
 func dumpStacks() {
+	writeStack(Dump())
+}
+
+//Dump 所有goroutine的堆栈，最多64M
+func Dump() []byte {
 	buf := make([]byte, 1638400)
-	buf = buf[:runtime.Stack(buf, true)]
-	writeStack(buf)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
 }
 
 func writeStack(buf []byte) {
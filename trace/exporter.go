@@ -0,0 +1,206 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Exporter 批量导出结束的span
+type Exporter interface {
+	Export(spans []*Span) error
+	Close() error
+}
+
+//spanJSON 本地输出的格式，一行一个span
+type spanJSON struct {
+	Name       string                 `json:"name"`
+	Kind       string                 `json:"kind"`
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Start      time.Time              `json:"start"`
+	Duration   string                 `json:"duration"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+type writerExporter struct {
+	lock sync.Mutex
+	w    io.Writer
+	c    io.Closer
+}
+
+//NewWriterExporter 每个span输出一行json，如os.Stdout，不会关闭w
+func NewWriterExporter(w io.Writer) Exporter {
+	return &writerExporter{w: w}
+}
+
+//NewFileExporter 追加写入文件，关闭时关闭文件
+func NewFileExporter(file string) (Exporter, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &writerExporter{w: f, c: f}, nil
+}
+
+func (e *writerExporter) Export(spans []*Span) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, s := range spans {
+		js := spanJSON{
+			Name:       s.Name,
+			Kind:       s.Kind.String(),
+			TraceID:    s.SpanContext.TraceID.String(),
+			SpanID:     s.SpanContext.SpanID.String(),
+			Start:      s.StartTime,
+			Duration:   s.EndTime.Sub(s.StartTime).String(),
+			Attributes: s.Attributes,
+			Error:      s.StatusMessage,
+		}
+		if s.ParentSpanID.IsValid() {
+			js.ParentID = s.ParentSpanID.String()
+		}
+		if err := enc.Encode(js); err != nil {
+			return err
+		}
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+func (e *writerExporter) Close() error {
+	if e.c != nil {
+		return e.c.Close()
+	}
+	return nil
+}
+
+type otlpExporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+}
+
+//NewOTLPExporter 使用OTLP/HTTP的json格式发送到collector，endpoint没有path则使用/v1/traces
+func NewOTLPExporter(endpoint string, headers map[string]string, serviceName string) Exporter {
+	if u, err := url.Parse(endpoint); err == nil && (u.Path == "" || u.Path == "/") {
+		endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return &otlpExporter{
+		endpoint:    endpoint,
+		headers:     headers,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *otlpExporter) Export(spans []*Span) error {
+	list := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		span := map[string]interface{}{
+			"traceId":           s.SpanContext.TraceID.String(),
+			"spanId":            s.SpanContext.SpanID.String(),
+			"name":              s.Name,
+			"kind":              int(s.Kind),
+			"startTimeUnixNano": strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.Attributes),
+			"status":            map[string]interface{}{"code": int(s.Status), "message": s.StatusMessage},
+		}
+		if s.ParentSpanID.IsValid() {
+			span["parentSpanId"] = s.ParentSpanID.String()
+		}
+		list = append(list, span)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": e.serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "github.com/hsyan2008/hfw/trace"},
+						"spans": list,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp collector response status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (e *otlpExporter) Close() error {
+	return nil
+}
+
+//otlpAttributes OTLP的KeyValue格式，int64是字符串
+func otlpAttributes(attrs map[string]interface{}) []interface{} {
+	list := make([]interface{}, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]interface{}
+		switch i := v.(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": i}
+		case bool:
+			value = map[string]interface{}{"boolValue": i}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(int64(i), 10)}
+		case int32:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(int64(i), 10)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(i, 10)}
+		case uint:
+			value = map[string]interface{}{"intValue": strconv.FormatUint(uint64(i), 10)}
+		case uint32:
+			value = map[string]interface{}{"intValue": strconv.FormatUint(uint64(i), 10)}
+		case uint64:
+			value = map[string]interface{}{"intValue": strconv.FormatUint(i, 10)}
+		case float32:
+			value = map[string]interface{}{"doubleValue": float64(i)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": i}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(i)}
+		}
+		list = append(list, map[string]interface{}{"key": k, "value": value})
+	}
+	return list
+}
@@ -0,0 +1,233 @@
+package trace
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	logger "github.com/hsyan2008/hfw/logging"
+	"github.com/hsyan2008/hfw/signal"
+)
+
+var (
+	defaultBatchSize           = 512
+	defaultFlushInterval int64 = 5000
+	//缓存的span超过则丢弃
+	maxQueueSize = 4096
+)
+
+type sampler struct {
+	rate float64
+	lock sync.Mutex
+	r    *rand.Rand
+}
+
+func (s *sampler) sample() bool {
+	if s.rate >= 1 {
+		return true
+	}
+	if s.rate <= 0 {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.r.Float64() < s.rate
+}
+
+type processor struct {
+	exporter  Exporter
+	batchSize int
+
+	lock    sync.Mutex
+	spans   []*Span
+	trigger chan struct{}
+	flushed chan chan struct{}
+	closing chan struct{}
+	done    chan struct{}
+}
+
+var (
+	lock       = new(sync.RWMutex)
+	curSampler *sampler
+	curProc    *processor
+)
+
+func getSampler() *sampler {
+	lock.RLock()
+	defer lock.RUnlock()
+	return curSampler
+}
+
+func export(s *Span) {
+	lock.RLock()
+	p := curProc
+	lock.RUnlock()
+	if p != nil {
+		p.add(s)
+	}
+}
+
+//Init 根据配置开启，Exporter支持otlp、stdout、file
+func Init(conf configs.TraceConfig) error {
+	if !conf.IsEnable {
+		return nil
+	}
+	if conf.ServiceName == "" {
+		conf.ServiceName = common.GetAppName()
+	}
+
+	var exporter Exporter
+	switch strings.ToLower(conf.Exporter) {
+	case "otlp":
+		if conf.Endpoint == "" {
+			return fmt.Errorf("nil trace endpoint")
+		}
+		exporter = NewOTLPExporter(conf.Endpoint, conf.Headers, conf.ServiceName)
+	case "file":
+		if conf.File == "" {
+			return fmt.Errorf("nil trace file")
+		}
+		file := conf.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(common.GetAppPath(), file)
+		}
+		var err error
+		if exporter, err = NewFileExporter(file); err != nil {
+			return err
+		}
+	case "", "stdout":
+		exporter = NewWriterExporter(os.Stdout)
+	default:
+		return fmt.Errorf("unsupport trace exporter: %s", conf.Exporter)
+	}
+
+	SetExporter(exporter, conf)
+	logger.Infof("trace is enabled, exporter: %s", conf.Exporter)
+
+	return nil
+}
+
+//SetExporter 使用自定义的Exporter开启，conf里只使用SampleRate、BatchSize和FlushInterval
+//之前的Exporter会在导出剩余的span后关闭
+func SetExporter(exporter Exporter, conf configs.TraceConfig) {
+	if conf.SampleRate <= 0 {
+		conf.SampleRate = 1
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = defaultBatchSize
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = defaultFlushInterval
+	}
+
+	p := &processor{
+		exporter:  exporter,
+		batchSize: conf.BatchSize,
+		trigger:   make(chan struct{}, 1),
+		flushed:   make(chan chan struct{}),
+		closing:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go p.run(time.Duration(conf.FlushInterval) * time.Millisecond)
+
+	lock.Lock()
+	old := curProc
+	curSampler = &sampler{rate: conf.SampleRate, r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	curProc = p
+	lock.Unlock()
+
+	if old != nil {
+		old.close()
+	}
+}
+
+//Flush 导出缓存的span，一般用于测试
+func Flush() {
+	lock.RLock()
+	p := curProc
+	lock.RUnlock()
+	if p == nil {
+		return
+	}
+	ch := make(chan struct{})
+	select {
+	case p.flushed <- ch:
+		<-ch
+	case <-p.done:
+	}
+}
+
+func (p *processor) add(s *Span) {
+	p.lock.Lock()
+	if len(p.spans) >= maxQueueSize {
+		p.lock.Unlock()
+		return
+	}
+	p.spans = append(p.spans, s)
+	full := len(p.spans) >= p.batchSize
+	p.lock.Unlock()
+
+	if full {
+		select {
+		case p.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *processor) run(interval time.Duration) {
+	defer close(p.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ctx := signal.GetSignalContext().Ctx
+	for {
+		select {
+		case <-ctx.Done():
+			p.flush()
+			p.exporter.Close()
+			return
+		case <-p.closing:
+			p.flush()
+			p.exporter.Close()
+			return
+		case ch := <-p.flushed:
+			p.flush()
+			close(ch)
+		case <-p.trigger:
+			p.flush()
+		case <-ticker.C:
+			p.flush()
+		}
+	}
+}
+
+func (p *processor) flush() {
+	for {
+		p.lock.Lock()
+		n := len(p.spans)
+		if n > p.batchSize {
+			n = p.batchSize
+		}
+		spans := p.spans[:n:n]
+		p.spans = p.spans[n:]
+		p.lock.Unlock()
+		if len(spans) == 0 {
+			return
+		}
+		if err := p.exporter.Export(spans); err != nil {
+			logger.Warnf("export %d spans error: %v", len(spans), err)
+		}
+	}
+}
+
+//close 导出剩余的span后关闭Exporter
+func (p *processor) close() {
+	close(p.closing)
+	<-p.done
+}
@@ -0,0 +1,313 @@
+//Package trace 兼容OpenTelemetry的分布式追踪，使用W3C traceparent在http和grpc之间传递
+//Usage:
+//ctx, span := trace.Start(ctx, "query user", trace.SpanKindInternal)
+//defer span.End()
+//span.SetAttribute("user.id", id)
+//未开启时Start返回nil的Span，调用其方法是安全的
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+type SpanID [8]byte
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+//TraceIDFromString 取前32位16进制字符，用于把日志里的trace_id作为新trace的id
+func TraceIDFromString(s string) (t TraceID, ok bool) {
+	if len(s) < 32 {
+		return t, false
+	}
+	if _, err := hex.Decode(t[:], []byte(s[:32])); err != nil {
+		return TraceID{}, false
+	}
+	return t, t.IsValid()
+}
+
+func newTraceID() (t TraceID) {
+	_, _ = rand.Read(t[:])
+	return
+}
+
+func newSpanID() (s SpanID) {
+	_, _ = rand.Read(s[:])
+	return
+}
+
+//SpanContext 需要传递给下游的部分
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+//SpanKind 同OTLP的定义
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota + 1
+	SpanKindServer
+	SpanKindClient
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	default:
+		return "internal"
+	}
+}
+
+//StatusCode 同OTLP的定义
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+type Span struct {
+	Name         string
+	Kind         SpanKind
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]interface{}
+	Status       StatusCode
+	//Status是StatusError时的错误信息
+	StatusMessage string
+
+	lock  sync.Mutex
+	ended bool
+}
+
+//SetAttribute value支持string、bool、整数和浮点数，其他类型转为字符串
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	switch value.(type) {
+	case string, bool, int, int64, int32, uint, uint32, uint64, float64, float32:
+	default:
+		value = fmt.Sprint(value)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ended {
+		return
+	}
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]interface{})
+	}
+	s.Attributes[key] = value
+}
+
+//SetError err为nil则不处理
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ended {
+		return
+	}
+	s.Status = StatusError
+	s.StatusMessage = err.Error()
+}
+
+//End 结束后导出，多次调用只有第一次有效
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.lock.Unlock()
+
+	if s.SpanContext.Sampled {
+		export(s)
+	}
+}
+
+//Context 用于传递给下游
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.SpanContext
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+type traceIDKey struct{}
+
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+//SpanFromContext 没有则返回nil
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+//ContextWithRemoteSpanContext 上游传递过来的SpanContext，作为下一个span的parent
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+//SpanContextFromContext 优先当前的span，其次是上游传递过来的
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.SpanContext
+	}
+	if ctx == nil {
+		return SpanContext{}
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+//ContextWithTraceID 没有parent时，新trace使用日志里的trace_id，便于通过日志查找
+func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	if t, ok := TraceIDFromString(traceID); ok {
+		return context.WithValue(ctx, traceIDKey{}, t)
+	}
+	return ctx
+}
+
+//Start 创建ctx里span的子span，没有开启时返回nil
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	sampler := getSampler()
+	if sampler == nil {
+		return ctx, nil
+	}
+
+	s := &Span{
+		Name:      name,
+		Kind:      kind,
+		StartTime: time.Now(),
+	}
+	if parent := SpanContextFromContext(ctx); parent.IsValid() {
+		s.SpanContext.TraceID = parent.TraceID
+		s.SpanContext.Sampled = parent.Sampled
+		s.ParentSpanID = parent.SpanID
+	} else {
+		if t, ok := ctx.Value(traceIDKey{}).(TraceID); ok {
+			s.SpanContext.TraceID = t
+		} else {
+			s.SpanContext.TraceID = newTraceID()
+		}
+		s.SpanContext.Sampled = sampler.sample()
+	}
+	s.SpanContext.SpanID = newSpanID()
+
+	return ContextWithSpan(ctx, s), s
+}
+
+//TraceparentKey http header和grpc metadata里的key
+const TraceparentKey = "traceparent"
+
+var errTraceparent = errors.New("invalid traceparent")
+
+//Traceparent W3C格式，00-traceid-spanid-flags
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+func ParseTraceparent(s string) (sc SpanContext, err error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errTraceparent
+	}
+	//00版本只有4段
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, errTraceparent
+	}
+	if _, err = hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, errTraceparent
+	}
+	if _, err = hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, errTraceparent
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, errTraceparent
+	}
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return SpanContext{}, errTraceparent
+	}
+
+	return sc, nil
+}
+
+//Inject 把ctx里的SpanContext写入header或者metadata，如Inject(ctx, req.Header.Set)
+func Inject(ctx context.Context, set func(key, value string)) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		set(TraceparentKey, sc.Traceparent())
+	}
+}
+
+//Extract 从header或者metadata里取出上游的SpanContext，如Extract(ctx, req.Header.Get)
+func Extract(ctx context.Context, get func(key string) string) context.Context {
+	v := get(TraceparentKey)
+	if v == "" {
+		return ctx
+	}
+	sc, err := ParseTraceparent(v)
+	if err != nil {
+		return ctx
+	}
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
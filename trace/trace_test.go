@@ -0,0 +1,139 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+type memoryExporter struct {
+	lock  sync.Mutex
+	spans []*Span
+}
+
+func (e *memoryExporter) Export(spans []*Span) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memoryExporter) Close() error {
+	return nil
+}
+
+func TestTraceparent(t *testing.T) {
+	s := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected span context: %+v", sc)
+	}
+	if sc.Traceparent() != s {
+		t.Fatalf("traceparent = %s", sc.Traceparent())
+	}
+
+	for _, v := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-xx",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(v); err == nil {
+			t.Fatalf("%s should be invalid", v)
+		}
+	}
+}
+
+func TestSpan(t *testing.T) {
+	exporter := &memoryExporter{}
+	SetExporter(exporter, configs.TraceConfig{})
+
+	header := http.Header{}
+	header.Set(TraceparentKey, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, server := Start(Extract(context.Background(), header.Get), "server", SpanKindServer)
+	_, client := Start(ctx, "client", SpanKindClient)
+	client.SetAttribute("http.status_code", 500)
+	client.SetError(errors.New("failed"))
+	out := http.Header{}
+	Inject(ContextWithSpan(ctx, client), out.Set)
+	client.End()
+	server.End()
+	Flush()
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("exported %d spans", len(exporter.spans))
+	}
+	c, s := exporter.spans[0], exporter.spans[1]
+	if s.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ParentSpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("server span should continue upstream trace: %+v", s)
+	}
+	if c.SpanContext.TraceID != s.SpanContext.TraceID || c.ParentSpanID != s.SpanContext.SpanID {
+		t.Fatalf("client span should be child of server span: %+v", c)
+	}
+	if c.Status != StatusError || c.Attributes["http.status_code"] != 500 {
+		t.Fatalf("unexpected client span: %+v", c)
+	}
+	if out.Get(TraceparentKey) != c.SpanContext.Traceparent() {
+		t.Fatalf("injected traceparent = %s", out.Get(TraceparentKey))
+	}
+
+	//没有上游时使用日志的trace_id
+	_, root := Start(ContextWithTraceID(context.Background(), "0123456789abcdef0123456789abcdef_xxx"), "root", SpanKindServer)
+	if root.SpanContext.TraceID.String() != "0123456789abcdef0123456789abcdef" || root.ParentSpanID.IsValid() {
+		t.Fatalf("unexpected root span: %+v", root)
+	}
+
+	//不采样的不导出，但是继续传递
+	SetExporter(exporter, configs.TraceConfig{SampleRate: 0.000001})
+	exporter.spans = nil
+	ctx, root = Start(context.Background(), "root", SpanKindServer)
+	_, child := Start(ctx, "child", SpanKindInternal)
+	child.End()
+	root.End()
+	Flush()
+	if len(exporter.spans) != 0 || child.SpanContext.TraceID != root.SpanContext.TraceID {
+		t.Fatalf("unsampled spans should not be exported: %d", len(exporter.spans))
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &body)
+	}))
+	defer ts.Close()
+
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	span := &Span{Name: "test", Kind: SpanKindServer, SpanContext: sc, Attributes: map[string]interface{}{"n": 1}}
+	e := NewOTLPExporter(ts.URL, map[string]string{"Authorization": "token"}, "hello")
+	if err := e.Export([]*Span{span}); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	spans := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	got := spans[0].(map[string]interface{})
+	if got["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" || got["name"] != "test" || got["kind"] != float64(SpanKindServer) {
+		t.Fatalf("unexpected otlp span: %v", got)
+	}
+	attr := got["attributes"].([]interface{})[0].(map[string]interface{})
+	if attr["value"].(map[string]interface{})["intValue"] != "1" {
+		t.Fatalf("unexpected otlp attribute: %v", attr)
+	}
+}
@@ -4,9 +4,9 @@ import (
 	"runtime"
 
 	"github.com/Nerdmaster/terminal"
-	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw"
 	"github.com/hsyan2008/hfw/common"
+	logger "github.com/hsyan2008/hfw/logging"
 	"github.com/webview/webview"
 )
 